@@ -5,8 +5,20 @@ import "fmt"
 type AppError struct {
 	Code    int
 	Message string
+	Fields  []FieldError //invalid fields of request, if any
+}
+
+// Reason why a request field is invalid
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
 }
 
 func (e AppError) Error() string {
 	return fmt.Sprintf("%d: %s", e.Code, e.Message)
 }
+
+// Bad request listing every invalid field, message is the first field's message
+func NewValidationError(fields []FieldError) *AppError {
+	return &AppError{Code: 400, Message: fields[0].Message, Fields: fields}
+}
@@ -0,0 +1,40 @@
+package config
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Reads duration from environment, falls back to default when variable is missing or invalid
+func GetDuration(key string, defaultValue time.Duration) time.Duration {
+	value, ok := os.LookupEnv(key)
+	if !ok || len(value) == 0 {
+		return defaultValue
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Invalid duration %s=%s, using %s", key, value, defaultValue)
+		return defaultValue
+	}
+
+	return duration
+}
+
+// Reads integer from environment, falls back to default when variable is missing or invalid
+func GetInt(key string, defaultValue int) int {
+	value, ok := os.LookupEnv(key)
+	if !ok || len(value) == 0 {
+		return defaultValue
+	}
+
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Invalid number %s=%s, using %d", key, value, defaultValue)
+		return defaultValue
+	}
+
+	return number
+}
@@ -0,0 +1,69 @@
+package controller
+
+import (
+	"expvar"
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"tweet/controller/json"
+	"tweet/model"
+	"tweet/service/circuit_breaker"
+)
+
+type AdminController struct {
+	breakers *circuit_breaker.Breakers
+	tracer   trace.Tracer
+}
+
+func NewAdminController(breakers *circuit_breaker.Breakers, tracer trace.Tracer) *AdminController {
+	return &AdminController{
+		breakers,
+		tracer,
+	}
+}
+
+func (c *AdminController) GetCircuitBreakers(w http.ResponseWriter, req *http.Request) {
+	ctx, span := c.tracer.Start(req.Context(), "AdminController.GetCircuitBreakers")
+	defer span.End()
+
+	authUser := ctx.Value("authUser").(model.AuthUser)
+	if authUser.Role != "ROLE_ADMIN" {
+		http.Error(w, "You are not an admin", 403)
+		return
+	}
+
+	json.EncodeJson(w, c.breakers.States())
+}
+
+func (c *AdminController) ResetCircuitBreaker(w http.ResponseWriter, req *http.Request) {
+	ctx, span := c.tracer.Start(req.Context(), "AdminController.ResetCircuitBreaker")
+	defer span.End()
+
+	authUser := ctx.Value("authUser").(model.AuthUser)
+	if authUser.Role != "ROLE_ADMIN" {
+		http.Error(w, "You are not an admin", 403)
+		return
+	}
+
+	name := mux.Vars(req)["name"]
+	if !c.breakers.Reset(name) {
+		http.Error(w, "Circuit breaker not found", 404)
+		return
+	}
+
+	json.EncodeJson(w, c.breakers.States())
+}
+
+// Process metrics include command line and memory stats, so they are shown to admins only
+func (c *AdminController) GetMetrics(w http.ResponseWriter, req *http.Request) {
+	ctx, span := c.tracer.Start(req.Context(), "AdminController.GetMetrics")
+	defer span.End()
+
+	authUser := ctx.Value("authUser").(model.AuthUser)
+	if authUser.Role != "ROLE_ADMIN" {
+		http.Error(w, "You are not an admin", 403)
+		return
+	}
+
+	expvar.Handler().ServeHTTP(w, req)
+}
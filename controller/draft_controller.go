@@ -0,0 +1,113 @@
+package controller
+
+import (
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"tweet/controller/json"
+	"tweet/model"
+	"tweet/service"
+)
+
+type DraftController struct {
+	draftService *service.DraftService
+	tracer       trace.Tracer
+}
+
+func NewDraftController(draftService *service.DraftService, tracer trace.Tracer) *DraftController {
+	return &DraftController{
+		draftService,
+		tracer,
+	}
+}
+
+func (c *DraftController) CreateDraft(w http.ResponseWriter, req *http.Request) {
+	ctx, span := c.tracer.Start(req.Context(), "DraftController.CreateDraft")
+	defer span.End()
+
+	draft, err := json.DecodeJson[model.Draft](req.Body)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	newDraft, appErr := c.draftService.CreateDraft(ctx, draft)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		writeError(w, appErr)
+		return
+	}
+
+	json.EncodeJsonStatus(w, http.StatusCreated, newDraft)
+}
+
+func (c *DraftController) GetDrafts(w http.ResponseWriter, req *http.Request) {
+	ctx, span := c.tracer.Start(req.Context(), "DraftController.GetDrafts")
+	defer span.End()
+
+	drafts, appErr := c.draftService.GetDrafts(ctx)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		http.Error(w, appErr.Message, appErr.Code)
+		return
+	}
+
+	json.EncodeJson(w, drafts)
+}
+
+func (c *DraftController) UpdateDraft(w http.ResponseWriter, req *http.Request) {
+	ctx, span := c.tracer.Start(req.Context(), "DraftController.UpdateDraft")
+	defer span.End()
+
+	id := mux.Vars(req)["id"]
+
+	draft, err := json.DecodeJson[model.Draft](req.Body)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	updated, appErr := c.draftService.UpdateDraft(ctx, id, draft)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		writeError(w, appErr)
+		return
+	}
+
+	json.EncodeJson(w, updated)
+}
+
+func (c *DraftController) DeleteDraft(w http.ResponseWriter, req *http.Request) {
+	ctx, span := c.tracer.Start(req.Context(), "DraftController.DeleteDraft")
+	defer span.End()
+
+	id := mux.Vars(req)["id"]
+
+	appErr := c.draftService.DeleteDraft(ctx, id)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		http.Error(w, appErr.Message, appErr.Code)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *DraftController) PublishDraft(w http.ResponseWriter, req *http.Request) {
+	ctx, span := c.tracer.Start(req.Context(), "DraftController.PublishDraft")
+	defer span.End()
+
+	id := mux.Vars(req)["id"]
+
+	tweet, appErr := c.draftService.PublishDraft(ctx, id)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		writeError(w, appErr)
+		return
+	}
+
+	json.EncodeJson(w, tweet)
+}
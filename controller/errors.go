@@ -0,0 +1,25 @@
+package controller
+
+import (
+	"net/http"
+	"tweet/app_errors"
+	"tweet/controller/json"
+)
+
+type validationErrorResponse struct {
+	Message string                  `json:"message"`
+	Errors  []app_errors.FieldError `json:"errors"`
+}
+
+// Field errors are sent as JSON, other errors as plain text
+func writeError(w http.ResponseWriter, appErr *app_errors.AppError) {
+	if len(appErr.Fields) == 0 {
+		http.Error(w, appErr.Message, appErr.Code)
+		return
+	}
+
+	json.EncodeJsonStatus(w, appErr.Code, validationErrorResponse{
+		Message: appErr.Message,
+		Errors:  appErr.Fields,
+	})
+}
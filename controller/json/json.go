@@ -18,6 +18,19 @@ func EncodeJson(w http.ResponseWriter, v interface{}) error {
 	return nil
 }
 
+func EncodeJsonStatus(w http.ResponseWriter, status int, v interface{}) error {
+	js, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(js)
+
+	return nil
+}
+
 func DecodeJson[V any](r io.Reader) (V, error) {
 	dec := json.NewDecoder(r)
 	dec.DisallowUnknownFields()
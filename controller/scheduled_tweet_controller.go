@@ -0,0 +1,97 @@
+package controller
+
+import (
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"tweet/controller/json"
+	"tweet/model"
+	"tweet/service"
+)
+
+type ScheduledTweetController struct {
+	scheduledTweetService *service.ScheduledTweetService
+	tracer                trace.Tracer
+}
+
+func NewScheduledTweetController(scheduledTweetService *service.ScheduledTweetService, tracer trace.Tracer) *ScheduledTweetController {
+	return &ScheduledTweetController{
+		scheduledTweetService,
+		tracer,
+	}
+}
+
+func (c *ScheduledTweetController) ScheduleTweet(w http.ResponseWriter, req *http.Request) {
+	ctx, span := c.tracer.Start(req.Context(), "ScheduledTweetController.ScheduleTweet")
+	defer span.End()
+
+	scheduled, err := json.DecodeJson[model.ScheduledTweet](req.Body)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	newScheduled, appErr := c.scheduledTweetService.ScheduleTweet(ctx, scheduled)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		writeError(w, appErr)
+		return
+	}
+
+	json.EncodeJsonStatus(w, http.StatusCreated, newScheduled)
+}
+
+func (c *ScheduledTweetController) GetScheduledTweets(w http.ResponseWriter, req *http.Request) {
+	ctx, span := c.tracer.Start(req.Context(), "ScheduledTweetController.GetScheduledTweets")
+	defer span.End()
+
+	scheduledTweets, appErr := c.scheduledTweetService.GetScheduledTweets(ctx)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		http.Error(w, appErr.Message, appErr.Code)
+		return
+	}
+
+	json.EncodeJson(w, scheduledTweets)
+}
+
+func (c *ScheduledTweetController) EditScheduledTweet(w http.ResponseWriter, req *http.Request) {
+	ctx, span := c.tracer.Start(req.Context(), "ScheduledTweetController.EditScheduledTweet")
+	defer span.End()
+
+	id := mux.Vars(req)["id"]
+
+	scheduled, err := json.DecodeJson[model.ScheduledTweet](req.Body)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	edited, appErr := c.scheduledTweetService.EditScheduledTweet(ctx, id, scheduled)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		writeError(w, appErr)
+		return
+	}
+
+	json.EncodeJson(w, edited)
+}
+
+func (c *ScheduledTweetController) CancelScheduledTweet(w http.ResponseWriter, req *http.Request) {
+	ctx, span := c.tracer.Start(req.Context(), "ScheduledTweetController.CancelScheduledTweet")
+	defer span.End()
+
+	id := mux.Vars(req)["id"]
+
+	appErr := c.scheduledTweetService.CancelScheduledTweet(ctx, id)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		http.Error(w, appErr.Message, appErr.Code)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,38 @@
+package controller
+
+import (
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"tweet/controller/json"
+	"tweet/service"
+)
+
+type SearchController struct {
+	searchService *service.SearchService
+	tracer        trace.Tracer
+}
+
+func NewSearchController(searchService *service.SearchService, tracer trace.Tracer) *SearchController {
+	return &SearchController{
+		searchService,
+		tracer,
+	}
+}
+
+func (c *SearchController) Search(w http.ResponseWriter, req *http.Request) {
+	ctx, span := c.tracer.Start(req.Context(), "SearchController.Search")
+	defer span.End()
+
+	query := req.URL.Query().Get("q")
+	cursor := req.URL.Query().Get("cursor")
+
+	result, appErr := c.searchService.Search(ctx, query, cursor)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		http.Error(w, appErr.Message, appErr.Code)
+		return
+	}
+
+	json.EncodeJson(w, result)
+}
@@ -0,0 +1,48 @@
+package controller
+
+import (
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"strconv"
+	"tweet/controller/json"
+	"tweet/service"
+)
+
+type TrendsController struct {
+	trendsService *service.TrendsService
+	tracer        trace.Tracer
+}
+
+func NewTrendsController(trendsService *service.TrendsService, tracer trace.Tracer) *TrendsController {
+	return &TrendsController{
+		trendsService,
+		tracer,
+	}
+}
+
+func (c *TrendsController) GetTrends(w http.ResponseWriter, req *http.Request) {
+	ctx, span := c.tracer.Start(req.Context(), "TrendsController.GetTrends")
+	defer span.End()
+
+	window := req.URL.Query().Get("window")
+
+	limit := 0
+	if value := req.URL.Query().Get("limit"); len(value) > 0 {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			http.Error(w, "Limit must be a positive number", 400)
+			return
+		}
+	}
+
+	trends, appErr := c.trendsService.GetTrends(ctx, window, limit)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		http.Error(w, appErr.Message, appErr.Code)
+		return
+	}
+
+	json.EncodeJson(w, trends)
+}
@@ -30,19 +30,14 @@ func (c *TweetController) CreateTweet(w http.ResponseWriter, req *http.Request)
 
 	if err != nil {
 		span.SetStatus(codes.Error, err.Error())
-		http.Error(w, err.Error(), 500)
-		return
-	}
-
-	if len(tweet.Text) == 0 && len(tweet.ImageId) == 0 {
-		http.Error(w, "Text and image can't be blank", 500)
+		http.Error(w, err.Error(), 400)
 		return
 	}
 
 	newTweet, appErr := c.tweetService.CreateTweet(ctx, tweet)
 	if appErr != nil {
 		span.SetStatus(codes.Error, appErr.Error())
-		http.Error(w, appErr.Message, appErr.Code)
+		writeError(w, appErr)
 		return
 	}
 
@@ -62,19 +57,14 @@ func (c *TweetController) CreateAd(w http.ResponseWriter, req *http.Request) {
 	ad, err := json.DecodeJson[model.Ad](req.Body)
 	if err != nil {
 		span.SetStatus(codes.Error, err.Error())
-		http.Error(w, err.Error(), 500)
-		return
-	}
-
-	if len(ad.Tweet.Text) == 0 && len(ad.Tweet.ImageId) == 0 {
-		http.Error(w, "Text and image can't be blank", 500)
+		http.Error(w, err.Error(), 400)
 		return
 	}
 
 	newAd, appErr := c.tweetService.CreateAd(ctx, ad, authUser)
 	if appErr != nil {
 		span.SetStatus(codes.Error, appErr.Error())
-		http.Error(w, appErr.Message, appErr.Code)
+		writeError(w, appErr)
 		return
 	}
 
@@ -113,6 +103,141 @@ func (c *TweetController) DeleteLike(w http.ResponseWriter, req *http.Request) {
 	json.EncodeJson(w, id)
 }
 
+func (c *TweetController) DeleteTweet(w http.ResponseWriter, req *http.Request) {
+	ctx, span := c.tracer.Start(req.Context(), "TweetController.DeleteTweet")
+	defer span.End()
+
+	id := mux.Vars(req)["id"]
+
+	appErr := c.tweetService.DeleteTweet(ctx, id)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		writeError(w, appErr)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *TweetController) EditTweet(w http.ResponseWriter, req *http.Request) {
+	ctx, span := c.tracer.Start(req.Context(), "TweetController.EditTweet")
+	defer span.End()
+
+	id := mux.Vars(req)["id"]
+
+	tweet, err := json.DecodeJson[model.Tweet](req.Body)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	edited, appErr := c.tweetService.EditTweet(ctx, id, tweet)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		writeError(w, appErr)
+		return
+	}
+
+	json.EncodeJson(w, edited)
+}
+
+func (c *TweetController) GetTweetHistory(w http.ResponseWriter, req *http.Request) {
+	ctx, span := c.tracer.Start(req.Context(), "TweetController.GetTweetHistory")
+	defer span.End()
+
+	id := mux.Vars(req)["id"]
+
+	history, appErr := c.tweetService.GetTweetHistory(ctx, id)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		http.Error(w, appErr.Message, appErr.Code)
+		return
+	}
+
+	json.EncodeJson(w, history)
+}
+
+func (c *TweetController) PinTweet(w http.ResponseWriter, req *http.Request) {
+	ctx, span := c.tracer.Start(req.Context(), "TweetController.PinTweet")
+	defer span.End()
+
+	id := mux.Vars(req)["id"]
+
+	appErr := c.tweetService.PinTweet(ctx, id)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		http.Error(w, appErr.Message, appErr.Code)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *TweetController) UnpinTweet(w http.ResponseWriter, req *http.Request) {
+	ctx, span := c.tracer.Start(req.Context(), "TweetController.UnpinTweet")
+	defer span.End()
+
+	id := mux.Vars(req)["id"]
+
+	appErr := c.tweetService.UnpinTweet(ctx, id)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		http.Error(w, appErr.Message, appErr.Code)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *TweetController) CreateBookmark(w http.ResponseWriter, req *http.Request) {
+	ctx, span := c.tracer.Start(req.Context(), "TweetController.CreateBookmark")
+	defer span.End()
+
+	id := mux.Vars(req)["id"]
+
+	appErr := c.tweetService.CreateBookmark(ctx, id)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		http.Error(w, appErr.Message, appErr.Code)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *TweetController) DeleteBookmark(w http.ResponseWriter, req *http.Request) {
+	ctx, span := c.tracer.Start(req.Context(), "TweetController.DeleteBookmark")
+	defer span.End()
+
+	id := mux.Vars(req)["id"]
+
+	appErr := c.tweetService.DeleteBookmark(ctx, id)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		http.Error(w, appErr.Message, appErr.Code)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *TweetController) GetBookmarks(w http.ResponseWriter, req *http.Request) {
+	ctx, span := c.tracer.Start(req.Context(), "TweetController.GetBookmarks")
+	defer span.End()
+
+	cursor := req.URL.Query().Get("cursor")
+
+	page, appErr := c.tweetService.GetBookmarks(ctx, cursor)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		http.Error(w, appErr.Message, appErr.Code)
+		return
+	}
+
+	json.EncodeJson(w, page)
+}
+
 func (c *TweetController) GetTimelineTweets(w http.ResponseWriter, req *http.Request) {
 	ctx, span := c.tracer.Start(req.Context(), "TweetController.GetProfileTweets")
 	defer span.End()
@@ -130,6 +255,39 @@ func (c *TweetController) GetTimelineTweets(w http.ResponseWriter, req *http.Req
 	json.EncodeJson(w, tweets)
 }
 
+func (c *TweetController) GetMentions(w http.ResponseWriter, req *http.Request) {
+	ctx, span := c.tracer.Start(req.Context(), "TweetController.GetMentions")
+	defer span.End()
+
+	lastTweetId := req.URL.Query().Get("beforeId")
+
+	tweets, appErr := c.tweetService.GetMentions(ctx, lastTweetId)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		http.Error(w, appErr.Message, appErr.Code)
+		return
+	}
+
+	json.EncodeJson(w, tweets)
+}
+
+func (c *TweetController) GetHashtagTweets(w http.ResponseWriter, req *http.Request) {
+	ctx, span := c.tracer.Start(req.Context(), "TweetController.GetHashtagTweets")
+	defer span.End()
+
+	tag := mux.Vars(req)["tag"]
+	lastTweetId := req.URL.Query().Get("beforeId")
+
+	tweets, appErr := c.tweetService.GetHashtagTweets(ctx, tag, lastTweetId)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		http.Error(w, appErr.Message, appErr.Code)
+		return
+	}
+
+	json.EncodeJson(w, tweets)
+}
+
 func (c *TweetController) GetLikesByTweet(w http.ResponseWriter, req *http.Request) {
 	ctx, span := c.tracer.Start(req.Context(), "TweetController.GetLikesByTweet")
 	defer span.End()
@@ -0,0 +1,107 @@
+package controller
+
+import (
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"tweet/controller/json"
+	"tweet/model"
+	"tweet/service"
+)
+
+type WebhookController struct {
+	webhookService *service.WebhookService
+	tracer         trace.Tracer
+}
+
+func NewWebhookController(webhookService *service.WebhookService, tracer trace.Tracer) *WebhookController {
+	return &WebhookController{
+		webhookService,
+		tracer,
+	}
+}
+
+func (c *WebhookController) CreateWebhook(w http.ResponseWriter, req *http.Request) {
+	ctx, span := c.tracer.Start(req.Context(), "WebhookController.CreateWebhook")
+	defer span.End()
+
+	webhook, err := json.DecodeJson[model.Webhook](req.Body)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	newWebhook, appErr := c.webhookService.CreateWebhook(ctx, webhook)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		http.Error(w, appErr.Message, appErr.Code)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.EncodeJson(w, newWebhook)
+}
+
+func (c *WebhookController) GetWebhooks(w http.ResponseWriter, req *http.Request) {
+	ctx, span := c.tracer.Start(req.Context(), "WebhookController.GetWebhooks")
+	defer span.End()
+
+	webhooks, appErr := c.webhookService.GetWebhooks(ctx)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		http.Error(w, appErr.Message, appErr.Code)
+		return
+	}
+
+	json.EncodeJson(w, webhooks)
+}
+
+func (c *WebhookController) DeleteWebhook(w http.ResponseWriter, req *http.Request) {
+	ctx, span := c.tracer.Start(req.Context(), "WebhookController.DeleteWebhook")
+	defer span.End()
+
+	id := mux.Vars(req)["id"]
+
+	appErr := c.webhookService.DeleteWebhook(ctx, id)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		http.Error(w, appErr.Message, appErr.Code)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *WebhookController) EnableWebhook(w http.ResponseWriter, req *http.Request) {
+	ctx, span := c.tracer.Start(req.Context(), "WebhookController.EnableWebhook")
+	defer span.End()
+
+	id := mux.Vars(req)["id"]
+
+	webhook, appErr := c.webhookService.EnableWebhook(ctx, id)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		http.Error(w, appErr.Message, appErr.Code)
+		return
+	}
+
+	json.EncodeJson(w, webhook)
+}
+
+func (c *WebhookController) GetWebhookDeliveries(w http.ResponseWriter, req *http.Request) {
+	ctx, span := c.tracer.Start(req.Context(), "WebhookController.GetWebhookDeliveries")
+	defer span.End()
+
+	id := mux.Vars(req)["id"]
+
+	attempts, appErr := c.webhookService.GetWebhookDeliveries(ctx, id)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		http.Error(w, appErr.Message, appErr.Code)
+		return
+	}
+
+	json.EncodeJson(w, attempts)
+}
@@ -0,0 +1,328 @@
+package entities
+
+import (
+	"net/url"
+	"strings"
+	"tweet/model"
+	"unicode"
+	"unicode/utf16"
+)
+
+const (
+	Mention = "mention"
+	Hashtag = "hashtag"
+	Cashtag = "cashtag"
+	URL     = "url"
+)
+
+// Longest tag that is recognized as a hashtag
+const maxHashtagLength = 100
+
+// Longest username that is recognized as a mention
+const maxUsernameLength = 64
+
+// Longest symbol of a cashtag, without the class suffix as in $BRK.A
+const maxCashtagLength = 6
+
+// Finds entities in tweet text. Entities don't overlap and are ordered by position.
+// Offsets are given both in code points and in UTF-16 code units, end is exclusive.
+func Parse(text string) []model.Entity {
+	runes := []rune(text)
+	entities := []model.Entity{}
+
+	for i := 0; i < len(runes); i++ {
+		var entity *model.Entity
+		if startsURL(runes, i) {
+			entity = parseURL(runes, i)
+		} else if boundaryBefore(runes, i) {
+			switch runes[i] {
+			case '@', '＠':
+				entity = parseMention(runes, i)
+			case '#', '＃':
+				entity = parseHashtag(runes, i)
+			case '$':
+				entity = parseCashtag(runes, i)
+			}
+		}
+
+		if entity != nil {
+			entities = append(entities, *entity)
+			i = entity.End - 1
+		}
+	}
+
+	if len(entities) > 0 {
+		setUTF16Offsets(runes, entities)
+	}
+
+	return entities
+}
+
+func parseMention(runes []rune, start int) *model.Entity {
+	end := start + 1
+	for end < len(runes) && isUsernameRune(runes[end]) {
+		end++
+	}
+
+	// "@a@b" and over long names are not mentions
+	if end == start+1 || end-start-1 > maxUsernameLength || (end < len(runes) && isMentionSign(runes[end])) {
+		return nil
+	}
+
+	return &model.Entity{
+		Type:  Mention,
+		Text:  string(runes[start+1 : end]),
+		Start: start,
+		End:   end,
+	}
+}
+
+// Hashtag is made of letters, digits and underscores, but not only of digits
+func parseHashtag(runes []rune, start int) *model.Entity {
+	end := start + 1
+	onlyDigits := true
+	for end < len(runes) && isHashtagRune(runes[end]) {
+		if !unicode.IsDigit(runes[end]) {
+			onlyDigits = false
+		}
+		end++
+	}
+
+	if end == start+1 || onlyDigits || end-start-1 > maxHashtagLength || (end < len(runes) && isHashtagSign(runes[end])) {
+		return nil
+	}
+
+	return &model.Entity{
+		Type:  Hashtag,
+		Text:  string(runes[start+1 : end]),
+		Start: start,
+		End:   end,
+	}
+}
+
+// Cashtag is a ticker symbol of latin letters with an optional class suffix, as $TWTR or $BRK.A
+func parseCashtag(runes []rune, start int) *model.Entity {
+	end := start + 1
+	for end < len(runes) && isLatinLetter(runes[end]) {
+		end++
+	}
+	if end == start+1 || end-start-1 > maxCashtagLength {
+		return nil
+	}
+
+	if end+1 < len(runes) && (runes[end] == '.' || runes[end] == '_') && isLatinLetter(runes[end+1]) {
+		suffixEnd := end + 1
+		for suffixEnd < len(runes) && isLatinLetter(runes[suffixEnd]) {
+			suffixEnd++
+		}
+		if suffixEnd-end-1 <= 2 {
+			end = suffixEnd
+		}
+	}
+
+	if end < len(runes) && (isHashtagRune(runes[end]) || runes[end] == '$') {
+		return nil
+	}
+
+	return &model.Entity{
+		Type:  Cashtag,
+		Text:  string(runes[start+1 : end]),
+		Start: start,
+		End:   end,
+	}
+}
+
+// URL has to start with http://, https:// or www., it runs to the next white space.
+// Trailing punctuation and unbalanced closing brackets are not part of it.
+func parseURL(runes []rune, start int) *model.Entity {
+	end := start
+	for end < len(runes) && !unicode.IsSpace(runes[end]) && !strings.ContainsRune(`<>"`, runes[end]) {
+		end++
+	}
+
+	for end > start {
+		last := runes[end-1]
+		if strings.ContainsRune(".,:;!?'*", last) {
+			end--
+			continue
+		}
+		if closing, ok := closingBrackets[last]; ok && !balanced(runes[start:end], closing, last) {
+			end--
+			continue
+		}
+		break
+	}
+
+	text := string(runes[start:end])
+	expanded := text
+	if !hasPrefixFold(runes[start:end], "http://") && !hasPrefixFold(runes[start:end], "https://") {
+		expanded = "http://" + text
+	}
+
+	parsed, err := url.Parse(expanded)
+	if err != nil || len(parsed.Hostname()) == 0 || !validHost(parsed.Hostname()) {
+		return nil
+	}
+
+	return &model.Entity{
+		Type:  URL,
+		Text:  text,
+		URL:   expanded,
+		Start: start,
+		End:   end,
+	}
+}
+
+var closingBrackets = map[rune]rune{
+	')': '(',
+	']': '[',
+	'}': '{',
+}
+
+// Closing bracket belongs to the URL when it closes a bracket opened in it, as in wikipedia links
+func balanced(runes []rune, opening rune, closing rune) bool {
+	depth := 0
+	for _, r := range runes {
+		switch r {
+		case opening:
+			depth++
+		case closing:
+			depth--
+		}
+	}
+	return depth >= 0
+}
+
+// Host needs a dot with a label on both sides, "www." alone is not a link
+func validHost(host string) bool {
+	labels := strings.Split(host, ".")
+	if len(labels) < 2 {
+		return false
+	}
+	for _, label := range labels {
+		if len(label) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Links can follow any character that can't be part of a word or of a path
+func startsURL(runes []rune, i int) bool {
+	if !hasPrefixFold(runes[i:], "http://") && !hasPrefixFold(runes[i:], "https://") && !hasPrefixFold(runes[i:], "www.") {
+		return false
+	}
+	if i == 0 {
+		return true
+	}
+
+	previous := runes[i-1]
+	return !isHashtagRune(previous) && !strings.ContainsRune("@＠#＃$./:", previous)
+}
+
+func hasPrefixFold(runes []rune, prefix string) bool {
+	if len(runes) < len(prefix) {
+		return false
+	}
+	return strings.EqualFold(string(runes[:len(prefix)]), prefix)
+}
+
+// Code unit offsets are counted in one pass, characters outside the BMP take two units
+func setUTF16Offsets(runes []rune, entities []model.Entity) {
+	offsets := make([]int, len(runes)+1)
+	for i, r := range runes {
+		length := utf16.RuneLen(r)
+		if length < 0 {
+			length = 1
+		}
+		offsets[i+1] = offsets[i] + length
+	}
+
+	for i := range entities {
+		entities[i].StartUTF16 = offsets[entities[i].Start]
+		entities[i].EndUTF16 = offsets[entities[i].End]
+	}
+}
+
+// Mentioned usernames without duplicates, normalized to lower case, in order of appearance
+func Mentions(entities []model.Entity) []string {
+	var usernames []string
+	seen := make(map[string]bool)
+	for _, entity := range entities {
+		username := NormalizeUsername(entity.Text)
+		if entity.Type == Mention && !seen[username] {
+			seen[username] = true
+			usernames = append(usernames, username)
+		}
+	}
+
+	return usernames
+}
+
+// Usernames differing only in case are the same user, mentions are stored and looked up by this form
+func NormalizeUsername(username string) string {
+	return strings.ToLower(username)
+}
+
+// Hashtags without duplicates, normalized to lower case, in order of appearance
+func Hashtags(entities []model.Entity) []string {
+	var tags []string
+	seen := make(map[string]bool)
+	for _, entity := range entities {
+		tag := NormalizeHashtag(entity.Text)
+		if entity.Type == Hashtag && !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+
+	return tags
+}
+
+// Hashtags differing only in case are the same, leading # is optional
+func NormalizeHashtag(tag string) string {
+	return strings.ToLower(strings.TrimLeft(tag, "#＃"))
+}
+
+// Whole text has to be a single hashtag, with or without leading #
+func ValidHashtag(tag string) bool {
+	runes := []rune(tag)
+	if len(runes) == 0 || !isHashtagSign(runes[0]) {
+		runes = append([]rune{'#'}, runes...)
+	}
+
+	entity := parseHashtag(runes, 0)
+	return entity != nil && entity.End == len(runes)
+}
+
+// Entity can't continue a word, so "mail@example.com" has no mention and "C#" has no hashtag
+func boundaryBefore(runes []rune, i int) bool {
+	if i == 0 {
+		return true
+	}
+
+	previous := runes[i-1]
+	return !isHashtagRune(previous) && !isMentionSign(previous) && !isHashtagSign(previous) && previous != '$' && previous != '&'
+}
+
+func isMentionSign(r rune) bool {
+	return r == '@' || r == '＠'
+}
+
+func isHashtagSign(r rune) bool {
+	return r == '#' || r == '＃'
+}
+
+// Letters of any script, combining marks used by scripts such as Devanagari and Arabic
+// and zero width non-joiner used in Persian
+func isHashtagRune(r rune) bool {
+	return r == '_' || r == '\u200c' || unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.In(r, unicode.Mn, unicode.Mc)
+}
+
+func isUsernameRune(r rune) bool {
+	return r == '_' || isLatinLetter(r) || (r >= '0' && r <= '9')
+}
+
+func isLatinLetter(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+}
@@ -0,0 +1,256 @@
+package entities
+
+import (
+	"reflect"
+	"testing"
+	"tweet/model"
+)
+
+func entity(entityType string, text string, start int, end int, startUTF16 int, endUTF16 int) model.Entity {
+	return model.Entity{
+		Type:       entityType,
+		Text:       text,
+		Start:      start,
+		End:        end,
+		StartUTF16: startUTF16,
+		EndUTF16:   endUTF16,
+	}
+}
+
+func link(text string, url string, start int, end int, startUTF16 int, endUTF16 int) model.Entity {
+	e := entity(URL, text, start, end, startUTF16, endUTF16)
+	e.URL = url
+	return e
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		expected []model.Entity
+	}{
+		{
+			name:     "empty",
+			text:     "",
+			expected: []model.Entity{},
+		},
+		{
+			name: "ascii",
+			text: "hi @alice #go $TWTR https://example.com/x",
+			expected: []model.Entity{
+				entity(Mention, "alice", 3, 9, 3, 9),
+				entity(Hashtag, "go", 10, 13, 10, 13),
+				entity(Cashtag, "TWTR", 14, 19, 14, 19),
+				link("https://example.com/x", "https://example.com/x", 20, 41, 20, 41),
+			},
+		},
+		{
+			name: "mention keeps its case",
+			text: "@Alice",
+			expected: []model.Entity{
+				entity(Mention, "Alice", 0, 6, 0, 6),
+			},
+		},
+		{
+			name: "full width signs",
+			text: "＠bob ＃tag",
+			expected: []model.Entity{
+				entity(Mention, "bob", 0, 4, 0, 4),
+				entity(Hashtag, "tag", 5, 9, 5, 9),
+			},
+		},
+		{
+			name: "emoji before mention",
+			text: "😀 @bob",
+			expected: []model.Entity{
+				entity(Mention, "bob", 2, 6, 3, 7),
+			},
+		},
+		{
+			name: "emoji right before hashtag",
+			text: "🎉#party",
+			expected: []model.Entity{
+				entity(Hashtag, "party", 1, 7, 2, 8),
+			},
+		},
+		{
+			name: "emoji ends hashtag and mention",
+			text: "#fun😀 @Alice😀",
+			expected: []model.Entity{
+				entity(Hashtag, "fun", 0, 4, 0, 4),
+				entity(Mention, "Alice", 6, 12, 7, 13),
+			},
+		},
+		{
+			name: "zwj sequence",
+			text: "👨\u200d👩\u200d👧 #family @mom",
+			expected: []model.Entity{
+				entity(Hashtag, "family", 6, 13, 9, 16),
+				entity(Mention, "mom", 14, 18, 17, 21),
+			},
+		},
+		{
+			name: "zwj sequence between entities",
+			text: "#a👩\u200d💻#b",
+			expected: []model.Entity{
+				entity(Hashtag, "a", 0, 2, 0, 2),
+				entity(Hashtag, "b", 5, 7, 7, 9),
+			},
+		},
+		{
+			name: "flag and skin tone",
+			text: "🇷🇸👍🏽 $ABC",
+			expected: []model.Entity{
+				entity(Cashtag, "ABC", 5, 9, 9, 13),
+			},
+		},
+		{
+			name: "letter outside bmp in hashtag",
+			text: "#𝒳yz",
+			expected: []model.Entity{
+				entity(Hashtag, "𝒳yz", 0, 4, 0, 5),
+			},
+		},
+		{
+			name: "arabic",
+			text: "مرحبا #سلام @ali",
+			expected: []model.Entity{
+				entity(Hashtag, "سلام", 6, 11, 6, 11),
+				entity(Mention, "ali", 12, 16, 12, 16),
+			},
+		},
+		{
+			name: "persian hashtag with zero width non-joiner",
+			text: "#می\u200cخواهم",
+			expected: []model.Entity{
+				entity(Hashtag, "می\u200cخواهم", 0, 9, 0, 9),
+			},
+		},
+		{
+			name: "hebrew with url and right-to-left mark",
+			text: "שלום\u200f https://example.co.il/path.",
+			expected: []model.Entity{
+				link("https://example.co.il/path", "https://example.co.il/path", 6, 32, 6, 32),
+			},
+		},
+		{
+			name: "devanagari combining marks",
+			text: "#नमस्ते दोस्तों",
+			expected: []model.Entity{
+				entity(Hashtag, "नमस्ते", 0, 7, 0, 7),
+			},
+		},
+		{
+			name: "decomposed accent",
+			text: "#cafe\u0301 ok",
+			expected: []model.Entity{
+				entity(Hashtag, "cafe\u0301", 0, 6, 0, 6),
+			},
+		},
+		{
+			name: "combining mark after emoji",
+			text: "😀\u0301 #x",
+			expected: []model.Entity{
+				entity(Hashtag, "x", 3, 5, 4, 6),
+			},
+		},
+		{
+			name:     "combining mark continues a word",
+			text:     "cafe\u0301#x",
+			expected: []model.Entity{},
+		},
+		{
+			name: "www link with brackets",
+			text: "(see www.example.com/a_(b)) ok",
+			expected: []model.Entity{
+				link("www.example.com/a_(b)", "http://www.example.com/a_(b)", 5, 26, 5, 26),
+			},
+		},
+		{
+			name: "link after emoji",
+			text: "🔗https://example.com",
+			expected: []model.Entity{
+				link("https://example.com", "https://example.com", 1, 20, 2, 21),
+			},
+		},
+		{
+			name: "cashtag with class",
+			text: "$BRK.A up",
+			expected: []model.Entity{
+				entity(Cashtag, "BRK.A", 0, 6, 0, 6),
+			},
+		},
+		{
+			name:     "not entities",
+			text:     "mail@example.com C# #123 $1234 @a@b $TOOLONGX www. http://localhost",
+			expected: []model.Entity{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual := Parse(test.text)
+			if !reflect.DeepEqual(actual, test.expected) {
+				t.Errorf("Parse(%q)\n got: %+v\nwant: %+v", test.text, actual, test.expected)
+			}
+		})
+	}
+}
+
+func TestMentions(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected []string
+	}{
+		{text: "no mentions", expected: nil},
+		{text: "@Alice @alice @ALICE", expected: []string{"alice"}},
+		{text: "@Bob then @carol and @BOB", expected: []string{"bob", "carol"}},
+		{text: "😀@Dave", expected: []string{"dave"}},
+	}
+
+	for _, test := range tests {
+		actual := Mentions(Parse(test.text))
+		if !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("Mentions(%q) = %v, want %v", test.text, actual, test.expected)
+		}
+	}
+}
+
+func TestHashtags(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected []string
+	}{
+		{text: "#Go #go #GO", expected: []string{"go"}},
+		{text: "#İstanbul #straße", expected: []string{"istanbul", "straße"}},
+		{text: "$TWTR @x", expected: nil},
+	}
+
+	for _, test := range tests {
+		actual := Hashtags(Parse(test.text))
+		if !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("Hashtags(%q) = %v, want %v", test.text, actual, test.expected)
+		}
+	}
+}
+
+func TestValidHashtag(t *testing.T) {
+	tests := []struct {
+		tag   string
+		valid bool
+	}{
+		{tag: "go", valid: true},
+		{tag: "#go", valid: true},
+		{tag: "＃سلام", valid: true},
+		{tag: "go lang", valid: false},
+		{tag: "123", valid: false},
+		{tag: "#", valid: false},
+		{tag: "", valid: false},
+	}
+
+	for _, test := range tests {
+		if actual := ValidHashtag(test.tag); actual != test.valid {
+			t.Errorf("ValidHashtag(%q) = %t, want %t", test.tag, actual, test.valid)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gocql/gocql"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"time"
+)
+
+// Event types, subject of an event is "tweets." followed by its type
+const (
+	TweetCreated   = "tweet.created"
+	TweetLiked     = "tweet.liked"
+	TweetUnliked   = "tweet.unliked"
+	TweetRetweeted = "tweet.retweeted"
+	TweetDeleted   = "tweet.deleted"
+	TweetMentioned = "tweet.mentioned"
+	TweetEdited    = "tweet.edited"
+)
+
+// Version of data schema, bumped on incompatible changes of an event type
+const SchemaVersion = 1
+
+// Envelope of every published event
+type Event struct {
+	ID         string    `json:"id"`
+	Type       string    `json:"type"`
+	Version    int       `json:"version"`
+	OccurredAt time.Time `json:"occurredAt"`
+	// W3C trace context of the request that caused the event
+	TraceContext map[string]string `json:"traceContext,omitempty"`
+	Data         json.RawMessage   `json:"data"`
+}
+
+type TweetCreatedData struct {
+	TweetId          string   `json:"tweetId"`
+	PostedBy         string   `json:"postedBy"`
+	Text             string   `json:"text"`
+	MediaIds         []string `json:"mediaIds"`
+	Ad               bool     `json:"ad"`
+	Retweet          bool     `json:"retweet"`
+	OriginalPostedBy string   `json:"originalPostedBy,omitempty"`
+}
+
+type TweetLikedData struct {
+	TweetId  string `json:"tweetId"`
+	PostedBy string `json:"postedBy"`
+	Username string `json:"username"`
+}
+
+type TweetUnlikedData struct {
+	TweetId  string `json:"tweetId"`
+	PostedBy string `json:"postedBy"`
+	Username string `json:"username"`
+}
+
+type TweetRetweetedData struct {
+	TweetId          string `json:"tweetId"`
+	RetweetId        string `json:"retweetId"`
+	OriginalPostedBy string `json:"originalPostedBy"`
+	Username         string `json:"username"`
+}
+
+type TweetDeletedData struct {
+	TweetId  string `json:"tweetId"`
+	PostedBy string `json:"postedBy"`
+}
+
+// Published once for every user mentioned in a new tweet
+type TweetMentionedData struct {
+	TweetId  string `json:"tweetId"`
+	PostedBy string `json:"postedBy"`
+	Username string `json:"username"`
+}
+
+// Published on every edit, text is the new version of tweet text.
+// Ads service has no edit call, edits of ads reach it through this event.
+type TweetEditedData struct {
+	TweetId  string   `json:"tweetId"`
+	PostedBy string   `json:"postedBy"`
+	Text     string   `json:"text"`
+	Version  int      `json:"version"`
+	MediaIds []string `json:"mediaIds"`
+	Ad       bool     `json:"ad"`
+}
+
+type Publisher interface {
+	Publish(ctx context.Context, event Event) error
+	Close() error
+}
+
+// Publisher whose subscribers receive events published by every replica
+type Bus interface {
+	Publisher
+	Subscribe(handler func(ctx context.Context, event Event)) error
+}
+
+// Creates event carrying trace context of ctx, so consumers can continue the trace
+func NewEvent(ctx context.Context, eventType string, data interface{}) (Event, error) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return Event{}, err
+	}
+
+	traceContext := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, traceContext)
+
+	return Event{
+		ID:           gocql.TimeUUID().String(),
+		Type:         eventType,
+		Version:      SchemaVersion,
+		OccurredAt:   time.Now(),
+		TraceContext: traceContext,
+		Data:         payload,
+	}, nil
+}
+
+// Context of consumer continues the trace of the request that caused the event
+func ContextFromEvent(ctx context.Context, event Event) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(event.TraceContext))
+}
+
+func Subject(eventType string) string {
+	return "tweets." + eventType
+}
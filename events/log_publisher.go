@@ -0,0 +1,44 @@
+package events
+
+import (
+	"context"
+	"log"
+	"sync"
+)
+
+// Logs events and passes them to in-process subscribers, used when no event bus is configured.
+// Subscribers only see events of their own replica, so it fits a single replica only.
+type LogPublisher struct {
+	mu          sync.Mutex
+	subscribers []func(ctx context.Context, event Event)
+}
+
+func NewLogPublisher() *LogPublisher {
+	return &LogPublisher{}
+}
+
+func (p *LogPublisher) Publish(ctx context.Context, event Event) error {
+	log.Printf("Event %s %s", event.Type, event.ID)
+
+	p.mu.Lock()
+	subscribers := append([]func(ctx context.Context, event Event){}, p.subscribers...)
+	p.mu.Unlock()
+
+	for _, subscriber := range subscribers {
+		subscriber(ctx, event)
+	}
+
+	return nil
+}
+
+func (p *LogPublisher) Subscribe(handler func(ctx context.Context, event Event)) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.subscribers = append(p.subscribers, handler)
+	return nil
+}
+
+func (p *LogPublisher) Close() error {
+	return nil
+}
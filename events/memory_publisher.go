@@ -0,0 +1,50 @@
+package events
+
+import (
+	"context"
+	"sync"
+)
+
+// Keeps every published event in memory and passes them to in-process subscribers.
+// Events are never dropped, so it is meant for tests only.
+type InMemoryPublisher struct {
+	mu          sync.Mutex
+	events      []Event
+	subscribers []func(ctx context.Context, event Event)
+}
+
+func NewInMemoryPublisher() *InMemoryPublisher {
+	return &InMemoryPublisher{}
+}
+
+func (p *InMemoryPublisher) Publish(ctx context.Context, event Event) error {
+	p.mu.Lock()
+	p.events = append(p.events, event)
+	subscribers := append([]func(ctx context.Context, event Event){}, p.subscribers...)
+	p.mu.Unlock()
+
+	for _, subscriber := range subscribers {
+		subscriber(ctx, event)
+	}
+
+	return nil
+}
+
+func (p *InMemoryPublisher) Subscribe(subscriber func(ctx context.Context, event Event)) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.subscribers = append(p.subscribers, subscriber)
+	return nil
+}
+
+func (p *InMemoryPublisher) Events() []Event {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]Event{}, p.events...)
+}
+
+func (p *InMemoryPublisher) Close() error {
+	return nil
+}
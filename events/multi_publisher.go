@@ -0,0 +1,39 @@
+package events
+
+import (
+	"context"
+)
+
+// Passes every event to all publishers, a failing publisher doesn't stop the others.
+// First error is returned.
+type MultiPublisher struct {
+	publishers []Publisher
+}
+
+func NewMultiPublisher(publishers ...Publisher) *MultiPublisher {
+	return &MultiPublisher{
+		publishers: publishers,
+	}
+}
+
+func (p *MultiPublisher) Publish(ctx context.Context, event Event) error {
+	var firstErr error
+	for _, publisher := range p.publishers {
+		if err := publisher.Publish(ctx, event); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+func (p *MultiPublisher) Close() error {
+	var firstErr error
+	for _, publisher := range p.publishers {
+		if err := publisher.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
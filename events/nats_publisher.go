@@ -0,0 +1,59 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/nats-io/nats.go"
+	"log"
+)
+
+// Publishes events to NATS, trace context is also sent in message headers
+type NatsPublisher struct {
+	conn *nats.Conn
+}
+
+func NewNatsPublisher(url string) (*NatsPublisher, error) {
+	conn, err := nats.Connect(url, nats.Name("tweet"), nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, err
+	}
+
+	return &NatsPublisher{
+		conn: conn,
+	}, nil
+}
+
+func (p *NatsPublisher) Publish(ctx context.Context, event Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	msg := nats.NewMsg(Subject(event.Type))
+	msg.Data = data
+	msg.Header.Set("Event-Type", event.Type)
+	for key, value := range event.TraceContext {
+		msg.Header.Set(key, value)
+	}
+
+	return p.conn.PublishMsg(msg)
+}
+
+// Every replica subscribes without a queue group, so each of them receives all events
+func (p *NatsPublisher) Subscribe(handler func(ctx context.Context, event Event)) error {
+	_, err := p.conn.Subscribe(Subject(">"), func(msg *nats.Msg) {
+		var event Event
+		if err := json.Unmarshal(msg.Data, &event); err != nil {
+			log.Printf("Invalid event on %s: %v", msg.Subject, err)
+			return
+		}
+
+		handler(ContextFromEvent(context.Background(), event), event)
+	})
+
+	return err
+}
+
+func (p *NatsPublisher) Close() error {
+	return p.conn.Drain()
+}
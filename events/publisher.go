@@ -0,0 +1,19 @@
+package events
+
+import (
+	"log"
+	"os"
+)
+
+// Selects publisher by EVENT_BUS, events are only logged unless it is set to nats
+func NewPublisher() (Bus, error) {
+	switch os.Getenv("EVENT_BUS") {
+	case "nats":
+		return NewNatsPublisher(os.Getenv("NATS_URL"))
+	case "", "log":
+		return NewLogPublisher(), nil
+	default:
+		log.Printf("Unknown event bus %s, events are only logged", os.Getenv("EVENT_BUS"))
+		return NewLogPublisher(), nil
+	}
+}
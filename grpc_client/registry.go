@@ -0,0 +1,90 @@
+package grpc_client
+
+import (
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/keepalive"
+	"log"
+	"sync"
+	"time"
+	"tweet/config"
+	"tweet/resilience"
+	"tweet/tls"
+)
+
+const (
+	SocialGraphAddress = "social-graph:9001"
+	AdsAddress         = "ads:9001"
+)
+
+// Keeps one long-lived connection per downstream service.
+// Connections reconnect with backoff on their own, so they are never redialed.
+type Registry struct {
+	mu       sync.Mutex
+	conns    map[string]*grpc.ClientConn
+	policies *resilience.Policies
+}
+
+func NewRegistry(policies *resilience.Policies) *Registry {
+	return &Registry{
+		conns:    make(map[string]*grpc.ClientConn),
+		policies: policies,
+	}
+}
+
+// Dialing doesn't block, connection is established on first call
+func (r *Registry) Conn(address string) (*grpc.ClientConn, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if conn, ok := r.conns[address]; ok {
+		return conn, nil
+	}
+
+	tlsConfig, err := tls.GetReloadingClientTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := grpc.Dial(
+		address,
+		grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)),
+		// every retry and hedge is traced on its own
+		grpc.WithChainUnaryInterceptor(r.policies.UnaryClientInterceptor(), otelgrpc.UnaryClientInterceptor()),
+		grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			// servers reject pings more frequent than 5 minutes by default
+			Time:    config.GetDuration("GRPC_KEEPALIVE_TIME", 5*time.Minute),
+			Timeout: config.GetDuration("GRPC_KEEPALIVE_TIMEOUT", 20*time.Second),
+		}),
+		grpc.WithConnectParams(grpc.ConnectParams{
+			Backoff: backoff.Config{
+				BaseDelay:  time.Second,
+				Multiplier: 1.6,
+				Jitter:     0.2,
+				MaxDelay:   config.GetDuration("GRPC_MAX_BACKOFF", 30*time.Second),
+			},
+			MinConnectTimeout: 5 * time.Second,
+		}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	r.conns[address] = conn
+
+	return conn, nil
+}
+
+func (r *Registry) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for address, conn := range r.conns {
+		if err := conn.Close(); err != nil {
+			log.Printf("Failed to close gRPC connection to %s: %v", address, err)
+		}
+		delete(r.conns, address)
+	}
+}
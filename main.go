@@ -20,8 +20,12 @@ import (
 	"time"
 	"tweet/controller"
 	"tweet/controller/jwt"
+	"tweet/events"
+	"tweet/grpc_client"
 	"tweet/repository/cassandra"
 	"tweet/repository/redis"
+	"tweet/resilience"
+	"tweet/search"
 	"tweet/service"
 	"tweet/service/circuit_breaker"
 	"tweet/tls"
@@ -29,7 +33,7 @@ import (
 )
 
 func main() {
-	quit := make(chan os.Signal)
+	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
 
 	ctx := context.Background()
@@ -51,12 +55,79 @@ func main() {
 		log.Fatal(err)
 	}
 
+	// "reindex" rebuilds search index from the database and exits, service has to be stopped
+	if len(os.Args) > 1 && os.Args[1] == "reindex" {
+		if _, err := service.ReindexSearch(ctx, cassandraRepository, search.IndexPath()); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	searchIndex, err := search.Open(search.IndexPath())
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	redisRepository := redis.NewRedisTweetRepository(tracer)
 
-	socialGraphCircuitBreaker := circuit_breaker.NewSocialGraphCircuitBreaker(tracer)
-	tweetService := service.NewTweetService(cassandraRepository, redisRepository, tracer, socialGraphCircuitBreaker)
+	visibilityRepository := redis.NewRedisVisibilityRepository(tracer)
+
+	grpcClients := grpc_client.NewRegistry(resilience.NewPolicies())
+
+	breakers := circuit_breaker.NewBreakers()
+
+	socialGraphCircuitBreaker := circuit_breaker.NewSocialGraphCircuitBreaker(tracer, visibilityRepository, grpcClients, breakers)
+	adsCircuitBreaker := circuit_breaker.NewAdsCircuitBreaker(tracer, grpcClients, breakers)
+	publisher, err := events.NewPublisher()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	webhookDispatcher := service.NewWebhookDispatcher(cassandraRepository, tracer)
+
+	trendsRepository := redis.NewRedisTrendsRepository(tracer)
+	trendsRecorder := service.NewTrendsRecorder(trendsRepository, tracer, service.SystemClock{})
+
+	// index is fed from the bus, so it also gets tweets posted by other replicas
+	if err := publisher.Subscribe(search.NewIndexer(searchIndex, tracer).Handle); err != nil {
+		log.Fatal(err)
+	}
+
+	tweetService := service.NewTweetService(cassandraRepository, redisRepository, tracer, socialGraphCircuitBreaker, events.NewMultiPublisher(publisher, webhookDispatcher, trendsRecorder))
+	webhookService := service.NewWebhookService(cassandraRepository, tracer)
+	trendsService := service.NewTrendsService(trendsRepository, tracer, service.SystemClock{})
+	searchService := service.NewSearchService(searchIndex, cassandraRepository, tweetService, tracer)
+	scheduledTweetService := service.NewScheduledTweetService(cassandraRepository, tweetService, tracer)
+	draftService := service.NewDraftService(cassandraRepository, tweetService, tracer)
+
+	workersCtx, stopWorkers := context.WithCancel(ctx)
+
+	imageCleaner := service.NewImageCleaner(cassandraRepository, tracer)
+	imageCleaner.Start(workersCtx)
+
+	leaseRepository := redis.NewRedisLeaseRepository(tracer)
+
+	fanoutReplayer := service.NewFanoutReplayer(cassandraRepository, leaseRepository, socialGraphCircuitBreaker, tracer)
+	fanoutReplayer.Start(workersCtx)
+
+	adsOutboxRelay := service.NewAdsOutboxRelay(cassandraRepository, leaseRepository, adsCircuitBreaker, tracer)
+	adsOutboxRelay.Start(workersCtx)
+
+	webhookDispatcher.Start(workersCtx)
+
+	webhookWorker := service.NewWebhookWorker(cassandraRepository, leaseRepository, tracer)
+	webhookWorker.Start(workersCtx)
+
+	tweetScheduler := service.NewTweetScheduler(cassandraRepository, leaseRepository, tweetService, tracer)
+	tweetScheduler.Start(workersCtx)
 
 	tweetController := controller.NewTweetController(tweetService, tracer)
+	adminController := controller.NewAdminController(breakers, tracer)
+	webhookController := controller.NewWebhookController(webhookService, tracer)
+	trendsController := controller.NewTrendsController(trendsService, tracer)
+	searchController := controller.NewSearchController(searchService, tracer)
+	scheduledTweetController := controller.NewScheduledTweetController(scheduledTweetService, tracer)
+	draftController := controller.NewDraftController(draftService, tracer)
 
 	router := mux.NewRouter()
 	router.StrictSlash(true)
@@ -69,14 +140,43 @@ func main() {
 	router.HandleFunc("/tweets/ads", tweetController.CreateAd).Methods("POST")
 	router.HandleFunc("/tweets/{id}/like", tweetController.CreateLike).Methods("PUT")
 	router.HandleFunc("/tweets/{id}/unlike", tweetController.DeleteLike).Methods("PUT")
+	router.HandleFunc("/tweets/{id}/pin", tweetController.PinTweet).Methods("PUT")
+	router.HandleFunc("/tweets/{id}/unpin", tweetController.UnpinTweet).Methods("PUT")
+	router.HandleFunc("/tweets/{id}/bookmark", tweetController.CreateBookmark).Methods("PUT")
+	router.HandleFunc("/tweets/{id}/unbookmark", tweetController.DeleteBookmark).Methods("PUT")
+	router.HandleFunc("/tweets/bookmarks", tweetController.GetBookmarks).Methods("GET")
 	router.HandleFunc("/tweets/profile/{username}", tweetController.GetTimelineTweets).Methods("GET")
 	router.HandleFunc("/tweets/{id}/likes", tweetController.GetLikesByTweet).Methods("GET")
 	router.HandleFunc("/tweets/feed", tweetController.GetHomeFeed).Methods("GET")
+	router.HandleFunc("/tweets/mentions", tweetController.GetMentions).Methods("GET")
+	router.HandleFunc("/tweets/hashtags/{tag}", tweetController.GetHashtagTweets).Methods("GET")
+	router.HandleFunc("/tweets/trends", trendsController.GetTrends).Methods("GET")
+	router.HandleFunc("/tweets/search", searchController.Search).Methods("GET")
+	router.HandleFunc("/tweets/scheduled", scheduledTweetController.ScheduleTweet).Methods("POST")
+	router.HandleFunc("/tweets/scheduled", scheduledTweetController.GetScheduledTweets).Methods("GET")
+	router.HandleFunc("/tweets/scheduled/{id}", scheduledTweetController.EditScheduledTweet).Methods("PUT")
+	router.HandleFunc("/tweets/scheduled/{id}", scheduledTweetController.CancelScheduledTweet).Methods("DELETE")
+	router.HandleFunc("/tweets/drafts", draftController.CreateDraft).Methods("POST")
+	router.HandleFunc("/tweets/drafts", draftController.GetDrafts).Methods("GET")
+	router.HandleFunc("/tweets/drafts/{id}", draftController.UpdateDraft).Methods("PUT")
+	router.HandleFunc("/tweets/drafts/{id}", draftController.DeleteDraft).Methods("DELETE")
+	router.HandleFunc("/tweets/drafts/{id}/publish", draftController.PublishDraft).Methods("POST")
+	router.HandleFunc("/tweets/{id}", tweetController.DeleteTweet).Methods("DELETE")
+	router.HandleFunc("/tweets/{id}", tweetController.EditTweet).Methods("PUT")
+	router.HandleFunc("/tweets/{id}/history", tweetController.GetTweetHistory).Methods("GET")
 	router.HandleFunc("/tweets/{id}/retweet", tweetController.Retweet).Methods("POST")
 	router.HandleFunc("/tweets/image", tweetController.SaveImage).Methods("POST")
+	router.HandleFunc("/tweets/webhooks", webhookController.CreateWebhook).Methods("POST")
+	router.HandleFunc("/tweets/webhooks", webhookController.GetWebhooks).Methods("GET")
+	router.HandleFunc("/tweets/webhooks/{id}", webhookController.DeleteWebhook).Methods("DELETE")
+	router.HandleFunc("/tweets/webhooks/{id}/enable", webhookController.EnableWebhook).Methods("POST")
+	router.HandleFunc("/tweets/webhooks/{id}/deliveries", webhookController.GetWebhookDeliveries).Methods("GET")
+	router.HandleFunc("/tweets/metrics", adminController.GetMetrics).Methods("GET")
+	router.HandleFunc("/tweets/admin/circuit-breakers", adminController.GetCircuitBreakers).Methods("GET")
+	router.HandleFunc("/tweets/admin/circuit-breakers/{name}/reset", adminController.ResetCircuitBreaker).Methods("POST")
 
 	allowedHeaders := handlers.AllowedHeaders([]string{"X-Requested-With", "Content-Type", "Authorization"})
-	allowedMethods := handlers.AllowedMethods([]string{"GET", "POST", "PUT", "PATCH", "HEAD", "OPTIONS"})
+	allowedMethods := handlers.AllowedMethods([]string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"})
 	allowedOrigins := handlers.AllowedOrigins([]string{"*"})
 
 	// start server
@@ -111,17 +211,23 @@ func main() {
 		grpc.UnaryInterceptor(otelgrpc.UnaryServerInterceptor()),
 	)
 
-	tweet.RegisterTweetServiceServer(grpcServer, service.NewgRPCTweetService(tracer, cassandraRepository))
+	tweet.RegisterTweetServiceServer(grpcServer, service.NewgRPCTweetService(tracer, cassandraRepository, visibilityRepository))
+	service.RegisterVisibilityCacheServiceServer(grpcServer, service.NewgRPCVisibilityCacheService(tracer, visibilityRepository))
 	reflection.Register(grpcServer)
-	err = grpcServer.Serve(lis)
-	if err != nil {
-		return
-	}
+
+	go func() {
+		if err := grpcServer.Serve(lis); err != nil {
+			log.Fatal(err)
+		}
+	}()
 
 	<-quit
 
 	log.Println("service shutting down ...")
 
+	stopWorkers()
+	grpcServer.GracefulStop()
+
 	// gracefully stop server
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
@@ -129,5 +235,13 @@ func main() {
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Fatal(err)
 	}
+
+	grpcClients.Close()
+	if err := publisher.Close(); err != nil {
+		log.Println(err)
+	}
+	if err := searchIndex.Close(); err != nil {
+		log.Println(err)
+	}
 	log.Println("server stopped")
 }
@@ -1,6 +1,7 @@
 package model
 
 import (
+	"encoding/json"
 	"github.com/gocql/gocql"
 	"time"
 )
@@ -13,28 +14,246 @@ type AuthUser struct {
 }
 
 type Tweet struct {
-	ID               gocql.UUID `json:"id"`
-	PostedBy         string     `json:"postedBy"`
-	Text             string     `json:"text"`
-	ImageId          string     `json:"imageId"`
-	Timestamp        time.Time  `json:"timestamp"`
-	Retweet          bool       `json:"retweet"`
-	OriginalPostedBy string     `json:"originalPostedBy"`
-	Ad               bool       `json:"ad"`
+	ID               gocql.UUID  `json:"id"`
+	PostedBy         string      `json:"postedBy"`
+	Text             string      `json:"text"`
+	Entities         []Entity    `json:"entities"`
+	Media            []Media     `json:"media"`
+	Timestamp        time.Time   `json:"timestamp"`
+	Retweet          bool        `json:"retweet"`
+	OriginalPostedBy string      `json:"originalPostedBy"`
+	OriginalTweetId  *gocql.UUID `json:"originalTweetId,omitempty"` //retweets made before edits have none
+	Ad               bool        `json:"ad"`
+	EditedAt         *time.Time  `json:"editedAt,omitempty"`
+	// Deprecated: use Media, accepted as the only attachment until clients move to media
+	ImageId string `json:"imageId,omitempty"`
 }
 
 type TweetDTO struct {
-	ID               gocql.UUID `json:"id"`
-	PostedBy         string     `json:"postedBy"`
-	Text             string     `json:"text"`
-	ImageId          string     `json:"-"` //only for backend
-	Image            []byte     `json:"image"`
-	Timestamp        time.Time  `json:"timestamp"`
-	Retweet          bool       `json:"retweet"`
-	OriginalPostedBy string     `json:"originalPostedBy"`
-	LikesCount       int16      `json:"likesCount"`
-	LikedByMe        bool       `json:"likedByMe"`
-	Ad               bool       `json:"ad"`
+	ID               gocql.UUID  `json:"id"`
+	PostedBy         string      `json:"postedBy"`
+	Text             string      `json:"text"`
+	Entities         []Entity    `json:"entities"`
+	Media            []Media     `json:"media"`
+	ImageUnavailable bool        `json:"imageUnavailable"`
+	Timestamp        time.Time   `json:"timestamp"`
+	Retweet          bool        `json:"retweet"`
+	OriginalPostedBy string      `json:"originalPostedBy"`
+	OriginalTweetId  *gocql.UUID `json:"originalTweetId,omitempty"`
+	EditedAt         *time.Time  `json:"editedAt,omitempty"`
+	LikesCount       int16       `json:"likesCount"`
+	LikedByMe        bool        `json:"likedByMe"`
+	BookmarkedByMe   bool        `json:"bookmarkedByMe"`
+	Ad               bool        `json:"ad"`
+	Pinned           bool        `json:"pinned,omitempty"`
+	Degraded         bool        `json:"degraded,omitempty"` //fan-out to followers is delayed
+}
+
+// Responses still carry deprecated imageId, the id of the first attachment, for older clients
+func (t TweetDTO) MarshalJSON() ([]byte, error) {
+	type tweetDTO TweetDTO
+
+	legacy := struct {
+		tweetDTO
+		ImageId string `json:"imageId,omitempty"`
+	}{tweetDTO: tweetDTO(t)}
+
+	if len(t.Media) > 0 {
+		legacy.ImageId = t.Media[0].ID
+	}
+
+	return json.Marshal(legacy)
+}
+
+// Media of a request, deprecated imageId is taken as the only attachment when media is not given
+func (t Tweet) RequestMedia() []Media {
+	if len(t.Media) == 0 && len(t.ImageId) > 0 {
+		return []Media{{ID: t.ImageId}}
+	}
+
+	return t.Media
+}
+
+// Attachment of a tweet, stored as media UDT in cassandra
+type Media struct {
+	ID       string `json:"id" cql:"id"`
+	AltText  string `json:"altText" cql:"alt_text"`
+	Width    int    `json:"width" cql:"width"`
+	Height   int    `json:"height" cql:"height"`
+	Position int    `json:"position" cql:"position"`
+	Hash     string `json:"-" cql:"hash"`
+	Image    []byte `json:"image,omitempty"` //only in responses
+}
+
+// Key of stored image content, media attached before deduplication has no hash
+func (m Media) BlobKey() string {
+	if len(m.Hash) > 0 {
+		return m.Hash
+	}
+	return m.ID
+}
+
+// Version of tweet text, version 0 is the text tweet was posted with
+type TweetEdit struct {
+	TweetId  gocql.UUID `json:"tweetId"`
+	Version  int        `json:"version"`
+	Text     string     `json:"text"`
+	Entities []Entity   `json:"entities"`
+	EditedAt time.Time  `json:"editedAt"`
+}
+
+// Tweet posted by scheduler at PublishAt, LastError is set when posting failed for good.
+// Version grows with every change, a change is applied only to the version it was made from.
+// Scheduler takes a new version while it posts the tweet, so it can't be changed meanwhile.
+type ScheduledTweet struct {
+	ID         gocql.UUID `json:"id"`
+	Username   string     `json:"username"`
+	Text       string     `json:"text"`
+	Media      []Media    `json:"media"`
+	PublishAt  time.Time  `json:"publishAt"`
+	LastError  string     `json:"lastError,omitempty"`
+	Version    int        `json:"-"`
+	Publishing bool       `json:"-"`
+	Attempts   int        `json:"-"`
+	// chosen on first attempt, every retry posts under the same id
+	TweetId *gocql.UUID `json:"-"`
+}
+
+// Unposted tweet visible only to its owner. Version grows with every update,
+// an update made from an outdated copy of the draft is rejected.
+type Draft struct {
+	ID        gocql.UUID `json:"id"`
+	Username  string     `json:"username"`
+	Text      string     `json:"text"`
+	Media     []Media    `json:"media"`
+	Version   int        `json:"version"`
+	UpdatedAt time.Time  `json:"updatedAt"`
+}
+
+// Part of tweet text, stored as entity UDT in cassandra.
+// Offsets are given in code points and in UTF-16 code units, end is exclusive.
+type Entity struct {
+	Type       string `json:"type" cql:"type"`
+	Text       string `json:"text" cql:"text"`         //without leading @, # or $
+	URL        string `json:"url,omitempty" cql:"url"` //links only, with scheme
+	Start      int    `json:"start" cql:"start_index"`
+	End        int    `json:"end" cql:"end_index"`
+	StartUTF16 int    `json:"startUtf16" cql:"start_utf16"`
+	EndUTF16   int    `json:"endUtf16" cql:"end_utf16"`
+}
+
+// Page of search results, next page is requested with NextCursor
+type SearchResult struct {
+	Tweets     []TweetDTO `json:"tweets"`
+	NextCursor string     `json:"nextCursor,omitempty"`
+}
+
+// Page of bookmarked tweets, most recently bookmarked first, next page is requested with NextCursor
+type BookmarkPage struct {
+	Tweets     []TweetDTO `json:"tweets"`
+	NextCursor string     `json:"nextCursor,omitempty"`
+}
+
+// Number of tweets using a hashtag in some period
+type HashtagCount struct {
+	Tag   string
+	Count int64
+}
+
+// Hashtag used more than its baseline predicts
+type Trend struct {
+	Tag      string  `json:"tag"`
+	Count    int64   `json:"count"`
+	Expected float64 `json:"expected"` //count predicted by the baseline
+	Score    float64 `json:"score"`
+}
+
+// Uploaded image info
+type Image struct {
+	ID         string    `json:"id"`
+	UploadedBy string    `json:"uploadedBy"`
+	Width      int       `json:"width"`
+	Height     int       `json:"height"`
+	Size       int64     `json:"size"`
+	Hash       string    `json:"hash"`
+	UploadedAt time.Time `json:"uploadedAt"`
+	// tweets, scheduled tweets and drafts the image is attached to, image is an orphan when there are none
+	UsedBy []string `json:"-"`
+}
+
+// Tweet that wasn't delivered to followers' feeds yet.
+// Ad also has its target group when the group couldn't be resolved at the time of posting.
+type PendingFanout struct {
+	TweetId     gocql.UUID
+	PostedBy    string
+	TargetGroup *TargetGroup
+	Attempts    int
+	LastError   string
+}
+
+// Event for ads service, written together with the change it describes and delivered later
+type OutboxEvent struct {
+	Shard    int
+	Bucket   time.Time
+	EventId  gocql.UUID
+	TweetId  string
+	Type     string
+	Payload  string
+	Attempts int
+}
+
+// Position of ads outbox relay in a shard, events up to EventId in Bucket were delivered.
+// EventId is nil when nothing in Bucket was delivered yet.
+type OutboxCursor struct {
+	Shard   int
+	Bucket  time.Time
+	EventId *gocql.UUID
+}
+
+// Partner subscription to events of one account, secret is shown only when webhook is created
+type Webhook struct {
+	ID             gocql.UUID `json:"id"`
+	Owner          string     `json:"owner"`
+	Account        string     `json:"account"`
+	URL            string     `json:"url"`
+	Secret         string     `json:"secret,omitempty"`
+	Events         []string   `json:"events"`
+	Enabled        bool       `json:"enabled"`
+	Failures       int        `json:"failures"` //consecutive failed attempts
+	DisabledReason string     `json:"disabledReason,omitempty"`
+	CreatedAt      time.Time  `json:"createdAt"`
+}
+
+// Event waiting to be delivered to a webhook, queued in the bucket of its next attempt
+type WebhookDelivery struct {
+	Shard         int
+	Bucket        time.Time
+	DeliveryId    gocql.UUID
+	WebhookId     gocql.UUID
+	EventType     string
+	Payload       string
+	Attempts      int
+	NextAttemptAt time.Time
+}
+
+// Oldest delivery bucket of a shard that may still have deliveries in it
+type WebhookCursor struct {
+	Shard  int
+	Bucket time.Time
+}
+
+// Entry of webhook delivery log
+type WebhookAttempt struct {
+	WebhookId   gocql.UUID `json:"webhookId"`
+	AttemptId   gocql.UUID `json:"-"`
+	DeliveryId  gocql.UUID `json:"deliveryId"`
+	EventType   string     `json:"eventType"`
+	Attempt     int        `json:"attempt"`
+	Outcome     string     `json:"outcome"`
+	StatusCode  int        `json:"statusCode,omitempty"`
+	Error       string     `json:"error,omitempty"`
+	DurationMs  int64      `json:"durationMs"`
+	AttemptedAt time.Time  `json:"attemptedAt"`
 }
 
 type Like struct {
@@ -42,15 +261,23 @@ type Like struct {
 	TweetId  gocql.UUID `json:"tweetId"`
 }
 
+// Private bookmark, BookmarkId orders bookmarks of a user by time they were made
+type Bookmark struct {
+	Username   string     `json:"username"`
+	BookmarkId gocql.UUID `json:"bookmarkId"`
+	TweetId    gocql.UUID `json:"tweetId"`
+}
+
 // Ad proof of concept structs
 type Ad struct {
 	Tweet       Tweet       `json:"tweet"`
 	TargetGroup TargetGroup `json:"targetGroup"`
 }
 
+// Stored as target_group UDT in cassandra
 type TargetGroup struct {
-	Town   string `json:"town"`
-	Gender string `json:"gender"`
-	MinAge int32  `json:"minAge"`
-	MaxAge int32  `json:"maxAge"`
+	Town   string `json:"town" cql:"town"`
+	Gender string `json:"gender" cql:"gender"`
+	MinAge int32  `json:"minAge" cql:"min_age"`
+	MaxAge int32  `json:"maxAge" cql:"max_age"`
 }
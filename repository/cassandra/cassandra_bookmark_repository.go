@@ -0,0 +1,84 @@
+package cassandra
+
+import (
+	"context"
+	"github.com/gocql/gocql"
+	"tweet/model"
+)
+
+// Bookmark is saved in user's list and in the lookup by tweet in one logged batch
+func (r *CassandraTweetRepository) SaveBookmark(ctx context.Context, bookmark *model.Bookmark) error {
+	_, span := r.tracer.Start(ctx, "CassandraTweetRepository.SaveBookmark")
+	defer span.End()
+
+	batch := r.session.NewBatch(gocql.LoggedBatch).WithContext(ctx)
+	batch.Query("INSERT INTO bookmarks_by_user (username, bookmark_id, tweet_id) VALUES (?, ?, ?)",
+		bookmark.Username, bookmark.BookmarkId, bookmark.TweetId)
+	batch.Query("INSERT INTO bookmark_lookup (username, tweet_id, bookmark_id) VALUES (?, ?, ?)",
+		bookmark.Username, bookmark.TweetId, bookmark.BookmarkId)
+
+	return r.session.ExecuteBatch(batch)
+}
+
+func (r *CassandraTweetRepository) FindBookmark(ctx context.Context, username string, tweetId *gocql.UUID) (model.Bookmark, error) {
+	_, span := r.tracer.Start(ctx, "CassandraTweetRepository.FindBookmark")
+	defer span.End()
+
+	var bookmark model.Bookmark
+	err := r.session.Query("SELECT username, tweet_id, bookmark_id FROM bookmark_lookup WHERE username = ? AND tweet_id = ?").
+		Bind(username, tweetId).
+		Scan(&bookmark.Username, &bookmark.TweetId, &bookmark.BookmarkId)
+
+	return bookmark, err
+}
+
+func (r *CassandraTweetRepository) DeleteBookmark(ctx context.Context, bookmark *model.Bookmark) error {
+	_, span := r.tracer.Start(ctx, "CassandraTweetRepository.DeleteBookmark")
+	defer span.End()
+
+	batch := r.session.NewBatch(gocql.LoggedBatch).WithContext(ctx)
+	batch.Query("DELETE FROM bookmarks_by_user WHERE username = ? AND bookmark_id = ?",
+		bookmark.Username, bookmark.BookmarkId)
+	batch.Query("DELETE FROM bookmark_lookup WHERE username = ? AND tweet_id = ?",
+		bookmark.Username, bookmark.TweetId)
+
+	return r.session.ExecuteBatch(batch)
+}
+
+// Most recent bookmarks first, lastBookmarkId continues from the previous page
+func (r *CassandraTweetRepository) GetBookmarks(ctx context.Context, username string, lastBookmarkId string, limit int) ([]model.Bookmark, error) {
+	_, span := r.tracer.Start(ctx, "CassandraTweetRepository.GetBookmarks")
+	defer span.End()
+
+	var bookmarks []model.Bookmark
+	var bookmark model.Bookmark
+
+	var iter *gocql.Iter
+
+	if len(lastBookmarkId) > 0 {
+		iter = r.session.Query("SELECT username, bookmark_id, tweet_id FROM bookmarks_by_user WHERE username = ? AND bookmark_id < ? LIMIT ?").
+			Bind(username, lastBookmarkId, limit).Iter()
+	} else {
+		iter = r.session.Query("SELECT username, bookmark_id, tweet_id FROM bookmarks_by_user WHERE username = ? LIMIT ?").
+			Bind(username, limit).Iter()
+	}
+
+	for iter.Scan(&bookmark.Username, &bookmark.BookmarkId, &bookmark.TweetId) {
+		bookmarks = append(bookmarks, bookmark)
+	}
+
+	return bookmarks, iter.Close()
+}
+
+func (r *CassandraTweetRepository) BookmarkedByMe(ctx context.Context, tweetId *gocql.UUID) (bool, error) {
+	_, span := r.tracer.Start(ctx, "CassandraTweetRepository.BookmarkedByMe")
+	defer span.End()
+
+	authUser := ctx.Value("authUser").(model.AuthUser)
+
+	var count int16
+	err := r.session.Query("SELECT COUNT(*) FROM bookmark_lookup WHERE username = ? AND tweet_id = ?").
+		Bind(authUser.Username, tweetId).Consistency(gocql.One).Scan(&count)
+
+	return count >= 1, err
+}
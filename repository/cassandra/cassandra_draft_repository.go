@@ -0,0 +1,72 @@
+package cassandra
+
+import (
+	"context"
+	"github.com/gocql/gocql"
+	"tweet/model"
+)
+
+func (r *CassandraTweetRepository) SaveDraft(ctx context.Context, draft *model.Draft) error {
+	_, span := r.tracer.Start(ctx, "CassandraTweetRepository.SaveDraft")
+	defer span.End()
+
+	err := r.session.Query("INSERT INTO drafts_by_user (username, draft_id, text, media, version, updated_at) VALUES (?, ?, ?, ?, ?, ?)").
+		Bind(draft.Username, draft.ID, draft.Text, draft.Media, draft.Version, draft.UpdatedAt).
+		Exec()
+
+	return err
+}
+
+// Draft is updated only if it still has expected version, reports whether it was updated
+func (r *CassandraTweetRepository) UpdateDraft(ctx context.Context, draft *model.Draft, expectedVersion int) (bool, error) {
+	_, span := r.tracer.Start(ctx, "CassandraTweetRepository.UpdateDraft")
+	defer span.End()
+
+	var currentVersion int
+	applied, err := r.session.Query("UPDATE drafts_by_user SET text = ?, media = ?, version = ?, updated_at = ? WHERE username = ? AND draft_id = ? IF version = ?").
+		Bind(draft.Text, draft.Media, draft.Version, draft.UpdatedAt, draft.Username, draft.ID, expectedVersion).
+		ScanCAS(&currentVersion)
+
+	return applied, err
+}
+
+func (r *CassandraTweetRepository) FindDraft(ctx context.Context, username string, draftId *gocql.UUID) (model.Draft, error) {
+	_, span := r.tracer.Start(ctx, "CassandraTweetRepository.FindDraft")
+	defer span.End()
+
+	var draft model.Draft
+	err := r.session.Query("SELECT username, draft_id, text, media, version, updated_at FROM drafts_by_user WHERE username = ? AND draft_id = ?").
+		Bind(username, draftId).
+		Scan(&draft.Username, &draft.ID, &draft.Text, &draft.Media, &draft.Version, &draft.UpdatedAt)
+
+	return draft, err
+}
+
+func (r *CassandraTweetRepository) FindDraftsByUser(ctx context.Context, username string) ([]model.Draft, error) {
+	_, span := r.tracer.Start(ctx, "CassandraTweetRepository.FindDraftsByUser")
+	defer span.End()
+
+	var drafts []model.Draft
+	var draft model.Draft
+
+	iter := r.session.Query("SELECT username, draft_id, text, media, version, updated_at FROM drafts_by_user WHERE username = ?").
+		Bind(username).Iter()
+
+	for iter.Scan(&draft.Username, &draft.ID, &draft.Text, &draft.Media, &draft.Version, &draft.UpdatedAt) {
+		drafts = append(drafts, draft)
+	}
+
+	return drafts, iter.Close()
+}
+
+// Draft is deleted only if it is still at its version, so media added on another device is not lost track of
+func (r *CassandraTweetRepository) DeleteDraft(ctx context.Context, draft *model.Draft) (bool, error) {
+	_, span := r.tracer.Start(ctx, "CassandraTweetRepository.DeleteDraft")
+	defer span.End()
+
+	applied, err := r.session.Query("DELETE FROM drafts_by_user WHERE username = ? AND draft_id = ? IF version = ?").
+		Bind(draft.Username, draft.ID, draft.Version).
+		MapScanCAS(make(map[string]interface{}))
+
+	return applied, err
+}
@@ -0,0 +1,192 @@
+package cassandra
+
+import (
+	"context"
+	"github.com/gocql/gocql"
+	"tweet/entities"
+	"tweet/model"
+)
+
+// Version is saved only if it doesn't exist yet, of two concurrent edits to the same version only one is applied
+func (r *CassandraTweetRepository) SaveTweetEdit(ctx context.Context, edit *model.TweetEdit) (bool, error) {
+	_, span := r.tracer.Start(ctx, "CassandraTweetRepository.SaveTweetEdit")
+	defer span.End()
+
+	applied, err := r.session.Query("INSERT INTO tweet_edits (tweet_id, version, text, entities, edited_at) VALUES (?, ?, ?, ?, ?) IF NOT EXISTS").
+		Bind(edit.TweetId, edit.Version, edit.Text, edit.Entities, edit.EditedAt).
+		MapScanCAS(make(map[string]interface{}))
+
+	return applied, err
+}
+
+// Target group is kept so that ad info can be sent to ads service again when the ad is edited
+func (r *CassandraTweetRepository) SaveAdTargetGroup(ctx context.Context, tweetId *gocql.UUID, targetGroup *model.TargetGroup) error {
+	_, span := r.tracer.Start(ctx, "CassandraTweetRepository.SaveAdTargetGroup")
+	defer span.End()
+
+	err := r.session.Query("INSERT INTO ad_target_groups (tweet_id, target_group) VALUES (?, ?)").
+		Bind(tweetId, targetGroup).
+		Exec()
+
+	return err
+}
+
+func (r *CassandraTweetRepository) FindAdTargetGroup(ctx context.Context, tweetId *gocql.UUID) (model.TargetGroup, error) {
+	_, span := r.tracer.Start(ctx, "CassandraTweetRepository.FindAdTargetGroup")
+	defer span.End()
+
+	var targetGroup model.TargetGroup
+	err := r.session.Query("SELECT target_group FROM ad_target_groups WHERE tweet_id = ?").
+		Bind(tweetId).
+		Scan(&targetGroup)
+
+	return targetGroup, err
+}
+
+// Oldest version first, tweets that were never edited have no versions
+func (r *CassandraTweetRepository) FindTweetEdits(ctx context.Context, tweetId *gocql.UUID) ([]model.TweetEdit, error) {
+	_, span := r.tracer.Start(ctx, "CassandraTweetRepository.FindTweetEdits")
+	defer span.End()
+
+	var edits []model.TweetEdit
+	var edit model.TweetEdit
+
+	iter := r.session.Query("SELECT tweet_id, version, text, entities, edited_at FROM tweet_edits WHERE tweet_id = ?").
+		Bind(tweetId).Iter()
+
+	for iter.Scan(&edit.TweetId, &edit.Version, &edit.Text, &edit.Entities, &edit.EditedAt) {
+		edits = append(edits, edit)
+	}
+
+	return edits, iter.Close()
+}
+
+// Writes new text of the tweet to its timeline row, feed copies and retweets.
+// Outbox events are written together with the timeline row.
+// Mention and hashtag rows that edit removed are deleted, current ones are saved by the caller.
+func (r *CassandraTweetRepository) EditTweet(ctx context.Context, tweet *model.Tweet, previous []model.Entity, events ...model.OutboxEvent) error {
+	_, span := r.tracer.Start(ctx, "CassandraTweetRepository.EditTweet")
+	defer span.End()
+
+	err := r.updateTweetCopies(ctx, tweet.ID, tweet.PostedBy, tweet, events)
+	if err != nil {
+		return err
+	}
+
+	var retweetId gocql.UUID
+	var retweetedBy string
+	iter := r.session.Query("SELECT retweet_id, retweeted_by FROM retweets_by_tweet WHERE tweet_id = ?").
+		Bind(tweet.ID).Iter()
+	for iter.Scan(&retweetId, &retweetedBy) {
+		err = r.updateTweetCopies(ctx, retweetId, retweetedBy, tweet, nil)
+		if err != nil {
+			iter.Close()
+			return err
+		}
+	}
+	if err = iter.Close(); err != nil {
+		return err
+	}
+
+	err = r.deleteMentions(tweet, removed(entities.Mentions(previous), entities.Mentions(tweet.Entities)))
+	if err != nil {
+		return err
+	}
+
+	return r.deleteHashtags(tweet, removed(entities.Hashtags(previous), entities.Hashtags(tweet.Entities)))
+}
+
+// Updates timeline row of given tweet or retweet and all of its feed copies
+func (r *CassandraTweetRepository) updateTweetCopies(ctx context.Context, tweetId gocql.UUID, postedBy string, edited *model.Tweet, events []model.OutboxEvent) error {
+	err := r.execWithOutbox(ctx, "UPDATE timeline_by_user SET text = ?, entities = ?, edited_at = ? WHERE posted_by = ? AND tweet_id = ?",
+		[]interface{}{edited.Text, edited.Entities, edited.EditedAt, postedBy, tweetId},
+		events)
+	if err != nil {
+		return err
+	}
+
+	// poster's own copy is not tracked for tweets posted before copies were tracked
+	usernames := []string{postedBy}
+
+	var username string
+	iter := r.session.Query("SELECT username FROM feed_copies_by_tweet WHERE tweet_id = ?").
+		Bind(tweetId).Iter()
+	for iter.Scan(&username) {
+		if username != postedBy {
+			usernames = append(usernames, username)
+		}
+	}
+	if err = iter.Close(); err != nil {
+		return err
+	}
+
+	for _, username := range usernames {
+		err = r.session.Query("UPDATE feed_by_user SET text = ?, entities = ?, edited_at = ? WHERE username = ? AND tweet_id = ?").
+			Bind(edited.Text, edited.Entities, edited.EditedAt, username, tweetId).
+			Exec()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Retweets are tracked per original tweet so that edits can reach them
+func (r *CassandraTweetRepository) saveRetweetRef(retweet *model.TweetDTO) error {
+	return r.session.Query("INSERT INTO retweets_by_tweet (tweet_id, retweet_id, retweeted_by) VALUES (?, ?, ?)").
+		Bind(retweet.OriginalTweetId, retweet.ID, retweet.PostedBy).
+		Exec()
+}
+
+func (r *CassandraTweetRepository) FindRetweetIds(ctx context.Context, tweetId *gocql.UUID) ([]gocql.UUID, error) {
+	_, span := r.tracer.Start(ctx, "CassandraTweetRepository.FindRetweetIds")
+	defer span.End()
+
+	var retweetIds []gocql.UUID
+	var retweetId gocql.UUID
+
+	iter := r.session.Query("SELECT retweet_id FROM retweets_by_tweet WHERE tweet_id = ?").
+		Bind(tweetId).Iter()
+	for iter.Scan(&retweetId) {
+		retweetIds = append(retweetIds, retweetId)
+	}
+
+	return retweetIds, iter.Close()
+}
+
+func (r *CassandraTweetRepository) deleteRetweetRef(retweet *model.Tweet) error {
+	return r.session.Query("DELETE FROM retweets_by_tweet WHERE tweet_id = ? AND retweet_id = ?").
+		Bind(retweet.OriginalTweetId, retweet.ID).
+		Exec()
+}
+
+// History and retweet references of a deleted original tweet
+func (r *CassandraTweetRepository) deleteEdits(tweet *model.Tweet) error {
+	err := r.session.Query("DELETE FROM tweet_edits WHERE tweet_id = ?").
+		Bind(tweet.ID).
+		Exec()
+	if err != nil {
+		return err
+	}
+
+	return r.session.Query("DELETE FROM retweets_by_tweet WHERE tweet_id = ?").
+		Bind(tweet.ID).
+		Exec()
+}
+
+func removed(previous []string, current []string) []string {
+	kept := make(map[string]bool)
+	for _, s := range current {
+		kept[s] = true
+	}
+
+	var result []string
+	for _, s := range previous {
+		if !kept[s] {
+			result = append(result, s)
+		}
+	}
+
+	return result
+}
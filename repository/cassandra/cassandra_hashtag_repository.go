@@ -0,0 +1,120 @@
+package cassandra
+
+import (
+	"context"
+	"github.com/gocql/gocql"
+	"time"
+	"tweet/model"
+)
+
+const (
+	hashtagBucketSize = 24 * time.Hour
+	hashtagPageSize   = 20
+)
+
+// Tweets of a hashtag are partitioned by day, so popular tags don't make huge partitions
+func hashtagBucket(t time.Time) int {
+	return int(t.Unix() / int64(hashtagBucketSize/time.Second))
+}
+
+func (r *CassandraTweetRepository) SaveHashtags(ctx context.Context, tweet *model.TweetDTO, tags []string) error {
+	_, span := r.tracer.Start(ctx, "CassandraTweetRepository.SaveHashtags")
+	defer span.End()
+
+	bucket := hashtagBucket(tweet.ID.Time())
+
+	for _, tag := range tags {
+		// reads walk only listed buckets, so the bucket is listed before the tweet is written into it
+		err := r.session.Query("INSERT INTO hashtag_buckets (tag, bucket) VALUES (?, ?)").
+			Bind(tag, bucket).
+			Exec()
+		if err != nil {
+			return err
+		}
+
+		err = r.session.Query("INSERT INTO tweets_by_hashtag (tag, bucket, tweet_id, posted_by, text, media, entities, edited_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)").
+			Bind(tag, bucket, tweet.ID, tweet.PostedBy, tweet.Text, tweet.Media, tweet.Entities, tweet.EditedAt).
+			Exec()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Walks day buckets of the tag from newest to oldest until the page is full
+func (r *CassandraTweetRepository) GetHashtagTweets(ctx context.Context, tag string, lastTweetId string) ([]model.TweetDTO, error) {
+	repoCtx, span := r.tracer.Start(ctx, "CassandraTweetRepository.GetHashtagTweets")
+	defer span.End()
+
+	before := gocql.MaxTimeUUID(time.Now())
+	if len(lastTweetId) > 0 {
+		cursor, err := gocql.ParseUUID(lastTweetId)
+		if err != nil {
+			return nil, err
+		}
+		before = cursor
+	}
+
+	var buckets []int
+	var bucket int
+	bucketIter := r.session.Query("SELECT bucket FROM hashtag_buckets WHERE tag = ? AND bucket <= ?").
+		Bind(tag, hashtagBucket(before.Time())).Iter()
+	for bucketIter.Scan(&bucket) {
+		buckets = append(buckets, bucket)
+	}
+	if err := bucketIter.Close(); err != nil {
+		return nil, err
+	}
+
+	var tweets []model.TweetDTO
+	var tweet model.TweetDTO
+	var err error
+
+	for _, bucket := range buckets {
+		iter := r.session.Query("SELECT tweet_id, posted_by, text, media, entities, toTimestamp(tweet_id), edited_at FROM tweets_by_hashtag WHERE tag = ? AND bucket = ? AND tweet_id < ? LIMIT ?").
+			Bind(tag, bucket, before, hashtagPageSize-len(tweets)).Iter()
+
+		for iter.Scan(&tweet.ID, &tweet.PostedBy, &tweet.Text, &tweet.Media, &tweet.Entities, &tweet.Timestamp, &tweet.EditedAt) {
+			tweet.LikesCount, err = r.CountLikes(repoCtx, &tweet.ID)
+			if err != nil {
+				tweet.LikesCount = 0
+			}
+
+			tweet.LikedByMe, err = r.LikedByMe(repoCtx, &tweet.ID)
+			if err != nil {
+				tweet.LikedByMe = false
+			}
+
+			tweet.BookmarkedByMe, err = r.BookmarkedByMe(repoCtx, &tweet.ID)
+			if err != nil {
+				tweet.BookmarkedByMe = false
+			}
+
+			tweets = append(tweets, tweet)
+		}
+		if err = iter.Close(); err != nil {
+			return nil, err
+		}
+
+		if len(tweets) >= hashtagPageSize {
+			break
+		}
+	}
+
+	return tweets, nil
+}
+
+func (r *CassandraTweetRepository) deleteHashtags(tweet *model.Tweet, tags []string) error {
+	for _, tag := range tags {
+		err := r.session.Query("DELETE FROM tweets_by_hashtag WHERE tag = ? AND bucket = ? AND tweet_id = ?").
+			Bind(tag, hashtagBucket(tweet.ID.Time()), tweet.ID).
+			Exec()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,76 @@
+package cassandra
+
+import (
+	"context"
+	"github.com/gocql/gocql"
+	"tweet/model"
+)
+
+func (r *CassandraTweetRepository) SaveMentions(ctx context.Context, tweet *model.TweetDTO, usernames []string) error {
+	_, span := r.tracer.Start(ctx, "CassandraTweetRepository.SaveMentions")
+	defer span.End()
+
+	for _, username := range usernames {
+		err := r.session.Query("INSERT INTO mentions_by_user (username, tweet_id, posted_by, text, media, entities, edited_at) VALUES (?, ?, ?, ?, ?, ?, ?)").
+			Bind(username, tweet.ID, tweet.PostedBy, tweet.Text, tweet.Media, tweet.Entities, tweet.EditedAt).
+			Exec()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *CassandraTweetRepository) GetMentionTweets(ctx context.Context, username string, lastTweetId string) ([]model.TweetDTO, error) {
+	repoCtx, span := r.tracer.Start(ctx, "CassandraTweetRepository.GetMentionTweets")
+	defer span.End()
+
+	var tweets []model.TweetDTO
+	var tweet model.TweetDTO
+
+	var err error
+	var iter *gocql.Iter
+
+	if len(lastTweetId) > 0 {
+		iter = r.session.Query("SELECT tweet_id, posted_by, text, media, entities, toTimestamp(tweet_id), edited_at FROM mentions_by_user WHERE username = ? AND tweet_id < ? LIMIT 20").
+			Bind(username, lastTweetId).Iter()
+	} else {
+		iter = r.session.Query("SELECT tweet_id, posted_by, text, media, entities, toTimestamp(tweet_id), edited_at FROM mentions_by_user WHERE username = ? LIMIT 20").
+			Bind(username).Iter()
+	}
+
+	for iter.Scan(&tweet.ID, &tweet.PostedBy, &tweet.Text, &tweet.Media, &tweet.Entities, &tweet.Timestamp, &tweet.EditedAt) {
+		tweet.LikesCount, err = r.CountLikes(repoCtx, &tweet.ID)
+		if err != nil {
+			tweet.LikesCount = 0
+		}
+
+		tweet.LikedByMe, err = r.LikedByMe(repoCtx, &tweet.ID)
+		if err != nil {
+			tweet.LikedByMe = false
+		}
+
+		tweet.BookmarkedByMe, err = r.BookmarkedByMe(repoCtx, &tweet.ID)
+		if err != nil {
+			tweet.BookmarkedByMe = false
+		}
+
+		tweets = append(tweets, tweet)
+	}
+
+	return tweets, iter.Close()
+}
+
+func (r *CassandraTweetRepository) deleteMentions(tweet *model.Tweet, usernames []string) error {
+	for _, username := range usernames {
+		err := r.session.Query("DELETE FROM mentions_by_user WHERE username = ? AND tweet_id = ?").
+			Bind(username, tweet.ID).
+			Exec()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
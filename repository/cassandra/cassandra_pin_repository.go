@@ -0,0 +1,56 @@
+package cassandra
+
+import (
+	"context"
+	"github.com/gocql/gocql"
+)
+
+// User has at most one pinned tweet, pinning another one replaces it
+func (r *CassandraTweetRepository) PinTweet(ctx context.Context, username string, tweetId *gocql.UUID) error {
+	_, span := r.tracer.Start(ctx, "CassandraTweetRepository.PinTweet")
+	defer span.End()
+
+	err := r.session.Query("INSERT INTO pinned_tweets (username, tweet_id) VALUES (?, ?)").
+		Bind(username, tweetId).
+		Exec()
+
+	return err
+}
+
+// Tweet is unpinned only if it is still the pinned one
+func (r *CassandraTweetRepository) UnpinTweet(ctx context.Context, username string, tweetId *gocql.UUID) error {
+	_, span := r.tracer.Start(ctx, "CassandraTweetRepository.UnpinTweet")
+	defer span.End()
+
+	return r.unpin(username, *tweetId)
+}
+
+// Returns gocql.ErrNotFound when user has no pinned tweet
+func (r *CassandraTweetRepository) FindPinnedTweet(ctx context.Context, username string) (gocql.UUID, error) {
+	_, span := r.tracer.Start(ctx, "CassandraTweetRepository.FindPinnedTweet")
+	defer span.End()
+
+	var tweetId gocql.UUID
+	err := r.session.Query("SELECT tweet_id FROM pinned_tweets WHERE username = ?").
+		Bind(username).
+		Scan(&tweetId)
+
+	return tweetId, err
+}
+
+func (r *CassandraTweetRepository) unpin(username string, tweetId gocql.UUID) error {
+	var pinnedId gocql.UUID
+	err := r.session.Query("SELECT tweet_id FROM pinned_tweets WHERE username = ?").
+		Bind(username).
+		Scan(&pinnedId)
+	if err == gocql.ErrNotFound || (err == nil && pinnedId != tweetId) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return r.session.Query("DELETE FROM pinned_tweets WHERE username = ?").
+		Bind(username).
+		Exec()
+}
@@ -0,0 +1,157 @@
+package cassandra
+
+import (
+	"context"
+	"github.com/gocql/gocql"
+	"hash/fnv"
+	"sort"
+	"time"
+	"tweet/model"
+)
+
+// Number of due queue partitions, changing it loses track of tweets that are already scheduled
+const scheduledShards = 8
+
+func scheduledShard(scheduledId gocql.UUID) int {
+	h := fnv.New32a()
+	h.Write(scheduledId.Bytes())
+	return int(h.Sum32() % scheduledShards)
+}
+
+// Tweet is saved for its owner and queued by publish time in one logged batch
+func (r *CassandraTweetRepository) SaveScheduledTweet(ctx context.Context, scheduled *model.ScheduledTweet) error {
+	_, span := r.tracer.Start(ctx, "CassandraTweetRepository.SaveScheduledTweet")
+	defer span.End()
+
+	batch := r.session.NewBatch(gocql.LoggedBatch).WithContext(ctx)
+	batch.Query("INSERT INTO scheduled_tweets_by_user (username, scheduled_id, text, media, publish_at, last_error, version, publishing, attempts) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		scheduled.Username, scheduled.ID, scheduled.Text, scheduled.Media, scheduled.PublishAt, scheduled.LastError, scheduled.Version, scheduled.Publishing, scheduled.Attempts)
+	batch.Query("INSERT INTO scheduled_tweets_due (shard, publish_at, scheduled_id, username) VALUES (?, ?, ?, ?)",
+		scheduledShard(scheduled.ID), scheduled.PublishAt, scheduled.ID, scheduled.Username)
+
+	return r.session.ExecuteBatch(batch)
+}
+
+// Replaces the tweet if it is still at previous version and moves it in the due queue when publish time changed.
+// New queue entry is written first, an entry left behind by an update that wasn't applied is skipped by the scheduler.
+func (r *CassandraTweetRepository) UpdateScheduledTweet(ctx context.Context, previous *model.ScheduledTweet, scheduled *model.ScheduledTweet) (bool, error) {
+	_, span := r.tracer.Start(ctx, "CassandraTweetRepository.UpdateScheduledTweet")
+	defer span.End()
+
+	err := r.session.Query("INSERT INTO scheduled_tweets_due (shard, publish_at, scheduled_id, username) VALUES (?, ?, ?, ?)").
+		Bind(scheduledShard(scheduled.ID), scheduled.PublishAt, scheduled.ID, scheduled.Username).
+		Exec()
+	if err != nil {
+		return false, err
+	}
+
+	applied, err := r.session.Query("UPDATE scheduled_tweets_by_user SET text = ?, media = ?, publish_at = ?, last_error = ?, version = ?, publishing = ?, attempts = ? WHERE username = ? AND scheduled_id = ? IF version = ?").
+		Bind(scheduled.Text, scheduled.Media, scheduled.PublishAt, scheduled.LastError, scheduled.Version, scheduled.Publishing, scheduled.Attempts, scheduled.Username, scheduled.ID, previous.Version).
+		MapScanCAS(make(map[string]interface{}))
+	if err != nil || !applied {
+		return applied, err
+	}
+
+	if !previous.PublishAt.Equal(scheduled.PublishAt) {
+		err = r.DeleteScheduledTweetDue(ctx, previous)
+	}
+
+	return true, err
+}
+
+// Changes publishing state of the tweet if it is still at expected version
+func (r *CassandraTweetRepository) UpdateScheduledTweetState(ctx context.Context, scheduled *model.ScheduledTweet, expectedVersion int) (bool, error) {
+	_, span := r.tracer.Start(ctx, "CassandraTweetRepository.UpdateScheduledTweetState")
+	defer span.End()
+
+	applied, err := r.session.Query("UPDATE scheduled_tweets_by_user SET version = ?, publishing = ?, attempts = ?, last_error = ?, tweet_id = ? WHERE username = ? AND scheduled_id = ? IF version = ?").
+		Bind(scheduled.Version, scheduled.Publishing, scheduled.Attempts, scheduled.LastError, scheduled.TweetId, scheduled.Username, scheduled.ID, expectedVersion).
+		MapScanCAS(make(map[string]interface{}))
+
+	return applied, err
+}
+
+func (r *CassandraTweetRepository) FindScheduledTweet(ctx context.Context, username string, scheduledId *gocql.UUID) (model.ScheduledTweet, error) {
+	_, span := r.tracer.Start(ctx, "CassandraTweetRepository.FindScheduledTweet")
+	defer span.End()
+
+	var scheduled model.ScheduledTweet
+	err := r.session.Query("SELECT username, scheduled_id, text, media, publish_at, last_error, version, publishing, attempts, tweet_id FROM scheduled_tweets_by_user WHERE username = ? AND scheduled_id = ?").
+		Bind(username, scheduledId).
+		Scan(&scheduled.Username, &scheduled.ID, &scheduled.Text, &scheduled.Media, &scheduled.PublishAt, &scheduled.LastError, &scheduled.Version, &scheduled.Publishing, &scheduled.Attempts, &scheduled.TweetId)
+
+	return scheduled, err
+}
+
+func (r *CassandraTweetRepository) FindScheduledTweetsByUser(ctx context.Context, username string) ([]model.ScheduledTweet, error) {
+	_, span := r.tracer.Start(ctx, "CassandraTweetRepository.FindScheduledTweetsByUser")
+	defer span.End()
+
+	var scheduledTweets []model.ScheduledTweet
+	var scheduled model.ScheduledTweet
+
+	iter := r.session.Query("SELECT username, scheduled_id, text, media, publish_at, last_error, version, publishing, attempts, tweet_id FROM scheduled_tweets_by_user WHERE username = ?").
+		Bind(username).Iter()
+
+	for iter.Scan(&scheduled.Username, &scheduled.ID, &scheduled.Text, &scheduled.Media, &scheduled.PublishAt, &scheduled.LastError, &scheduled.Version, &scheduled.Publishing, &scheduled.Attempts, &scheduled.TweetId) {
+		scheduledTweets = append(scheduledTweets, scheduled)
+		scheduled.TweetId = nil
+	}
+
+	return scheduledTweets, iter.Close()
+}
+
+// Queued tweets due at or before given time, at most limit from every shard, earliest first.
+// Only id, owner and publish time are read, the rest is in owner's row.
+func (r *CassandraTweetRepository) FindDueScheduledTweets(ctx context.Context, before time.Time, limit int) ([]model.ScheduledTweet, error) {
+	_, span := r.tracer.Start(ctx, "CassandraTweetRepository.FindDueScheduledTweets")
+	defer span.End()
+
+	var scheduledTweets []model.ScheduledTweet
+	var scheduled model.ScheduledTweet
+
+	for shard := 0; shard < scheduledShards; shard++ {
+		iter := r.session.Query("SELECT scheduled_id, username, publish_at FROM scheduled_tweets_due WHERE shard = ? AND publish_at <= ? LIMIT ?").
+			Bind(shard, before, limit).Iter()
+
+		for iter.Scan(&scheduled.ID, &scheduled.Username, &scheduled.PublishAt) {
+			scheduledTweets = append(scheduledTweets, scheduled)
+		}
+		if err := iter.Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Slice(scheduledTweets, func(i, j int) bool {
+		return scheduledTweets[i].PublishAt.Before(scheduledTweets[j].PublishAt)
+	})
+
+	return scheduledTweets, nil
+}
+
+// Tweet is deleted only if it is still at its version, then it leaves the due queue
+func (r *CassandraTweetRepository) DeleteScheduledTweet(ctx context.Context, scheduled *model.ScheduledTweet) (bool, error) {
+	_, span := r.tracer.Start(ctx, "CassandraTweetRepository.DeleteScheduledTweet")
+	defer span.End()
+
+	applied, err := r.session.Query("DELETE FROM scheduled_tweets_by_user WHERE username = ? AND scheduled_id = ? IF version = ?").
+		Bind(scheduled.Username, scheduled.ID, scheduled.Version).
+		MapScanCAS(make(map[string]interface{}))
+	if err != nil || !applied {
+		return applied, err
+	}
+
+	return true, r.DeleteScheduledTweetDue(ctx, scheduled)
+}
+
+// Removes only the queue entry, for tweets that are gone, failed or were rescheduled
+func (r *CassandraTweetRepository) DeleteScheduledTweetDue(ctx context.Context, scheduled *model.ScheduledTweet) error {
+	_, span := r.tracer.Start(ctx, "CassandraTweetRepository.DeleteScheduledTweetDue")
+	defer span.End()
+
+	err := r.session.Query("DELETE FROM scheduled_tweets_due WHERE shard = ? AND publish_at = ? AND scheduled_id = ?").
+		Bind(scheduledShard(scheduled.ID), scheduled.PublishAt, scheduled.ID).
+		Exec()
+
+	return err
+}
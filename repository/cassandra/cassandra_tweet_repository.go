@@ -2,6 +2,7 @@ package cassandra
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/FTN-TwitterClone/grpc-stubs/proto/social_graph"
 	"github.com/gocql/gocql"
@@ -11,9 +12,21 @@ import (
 	"go.opentelemetry.io/otel/trace"
 	"log"
 	"os"
+	"time"
+	"tweet/entities"
 	"tweet/model"
 )
 
+const (
+	// compare-and-set rounds on contended image content before giving up
+	imageBlobAttempts   = 10
+	imageBlobRetryDelay = 100 * time.Millisecond
+	// has to be much longer than removing a file takes
+	imageBlobLockTtl = time.Minute
+)
+
+var errImageBlobBusy = errors.New("image content is busy, try again")
+
 type CassandraTweetRepository struct {
 	tracer  trace.Tracer
 	session *gocql.Session
@@ -93,43 +106,151 @@ func migrateDB() error {
 	return nil
 }
 
-func (r *CassandraTweetRepository) SaveTweet(ctx context.Context, tweet *model.TweetDTO, followers []*social_graph.SocialGraphUsername) error {
+func (r *CassandraTweetRepository) SaveTweet(ctx context.Context, tweet *model.TweetDTO, followers []*social_graph.SocialGraphUsername, events ...model.OutboxEvent) error {
 	_, span := r.tracer.Start(ctx, "CassandraTweetRepository.SaveTweet")
 	defer span.End()
 
-	err := r.session.Query("INSERT INTO timeline_by_user (tweet_id, posted_by, text, image_id, retweet, original_posted_by, ad) VALUES (?, ?, ?, ?, ?, ?, ?)").
-		Bind(tweet.ID, tweet.PostedBy, tweet.Text, tweet.ImageId, tweet.Retweet, tweet.OriginalPostedBy, tweet.Ad).
-		Exec()
+	err := r.execWithOutbox(ctx, "INSERT INTO timeline_by_user (tweet_id, posted_by, text, media, entities, retweet, original_posted_by, original_tweet_id, ad, edited_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		[]interface{}{tweet.ID, tweet.PostedBy, tweet.Text, tweet.Media, tweet.Entities, tweet.Retweet, tweet.OriginalPostedBy, tweet.OriginalTweetId, tweet.Ad, tweet.EditedAt},
+		events)
+	if err != nil {
+		return err
+	}
+
+	if tweet.Retweet && tweet.OriginalTweetId != nil {
+		if err = r.saveRetweetRef(tweet); err != nil {
+			return err
+		}
+	}
 
 	// I want to see my tweet in feed
 	followers = append(followers, &social_graph.SocialGraphUsername{Username: tweet.PostedBy})
 
+	return r.SaveFeedTweets(ctx, tweet, followers)
+}
+
+func (r *CassandraTweetRepository) SaveFeedTweets(ctx context.Context, tweet *model.TweetDTO, followers []*social_graph.SocialGraphUsername) error {
+	_, span := r.tracer.Start(ctx, "CassandraTweetRepository.SaveFeedTweets")
+	defer span.End()
+
+	var err error
 	for _, follower := range followers {
-		err = r.session.Query("INSERT INTO feed_by_user (tweet_id, username, posted_by, text, image_id, retweet, original_posted_by, ad) VALUES (?, ?, ?, ?, ?, ?, ?, ?)").
-			Bind(tweet.ID, follower.Username, tweet.PostedBy, tweet.Text, tweet.ImageId, tweet.Retweet, tweet.OriginalPostedBy, tweet.Ad).
+		err = r.session.Query("INSERT INTO feed_by_user (tweet_id, username, posted_by, text, media, entities, retweet, original_posted_by, original_tweet_id, ad, edited_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)").
+			Bind(tweet.ID, follower.Username, tweet.PostedBy, tweet.Text, tweet.Media, tweet.Entities, tweet.Retweet, tweet.OriginalPostedBy, tweet.OriginalTweetId, tweet.Ad, tweet.EditedAt).
 			Exec()
+		if err == nil {
+			err = r.saveFeedCopy(tweet.ID, follower.Username)
+		}
 	}
 
 	return err
 }
 
-func (r *CassandraTweetRepository) SaveLike(ctx context.Context, like *model.Like) error {
+func (r *CassandraTweetRepository) SaveLike(ctx context.Context, like *model.Like, events ...model.OutboxEvent) error {
 	_, span := r.tracer.Start(ctx, "CassandraTweetRepository.SaveLike")
 	defer span.End()
 
-	err := r.session.Query("INSERT INTO likes (username, tweet_id) VALUES (?, ?)").
-		Bind(like.Username, like.TweetId).
-		Exec()
+	err := r.execWithOutbox(ctx, "INSERT INTO likes (username, tweet_id) VALUES (?, ?)",
+		[]interface{}{like.Username, like.TweetId},
+		events)
 
 	return err
 }
 
-func (r *CassandraTweetRepository) DeleteLike(ctx context.Context, tweetId *gocql.UUID, username string) error {
+func (r *CassandraTweetRepository) DeleteLike(ctx context.Context, tweetId *gocql.UUID, username string, events ...model.OutboxEvent) error {
 	_, span := r.tracer.Start(ctx, "CassandraTweetRepository.DeleteLike")
 	defer span.End()
 
-	err := r.session.Query("DELETE FROM likes WHERE username = ? AND tweet_id = ?").
-		Bind(username, tweetId).
+	err := r.execWithOutbox(ctx, "DELETE FROM likes WHERE username = ? AND tweet_id = ?",
+		[]interface{}{username, tweetId},
+		events)
+
+	return err
+}
+
+// Change and its outbox events are written in one logged batch, so either all of them are saved or none
+func (r *CassandraTweetRepository) execWithOutbox(ctx context.Context, stmt string, values []interface{}, events []model.OutboxEvent) error {
+	if len(events) == 0 {
+		return r.session.Query(stmt, values...).WithContext(ctx).Exec()
+	}
+
+	batch := r.session.NewBatch(gocql.LoggedBatch).WithContext(ctx)
+	batch.Query(stmt, values...)
+	for _, event := range events {
+		batch.Query("INSERT INTO ads_outbox (shard, bucket, event_id, tweet_id, type, payload, attempts) VALUES (?, ?, ?, ?, ?, ?, ?)",
+			event.Shard, event.Bucket, event.EventId, event.TweetId, event.Type, event.Payload, event.Attempts)
+	}
+
+	return r.session.ExecuteBatch(batch)
+}
+
+// Oldest events of a bucket first, only the ones after given event when it is set.
+// Events of one tweet are always in the same shard.
+func (r *CassandraTweetRepository) FindOutboxEvents(ctx context.Context, shard int, bucket time.Time, after *gocql.UUID, limit int) ([]model.OutboxEvent, error) {
+	_, span := r.tracer.Start(ctx, "CassandraTweetRepository.FindOutboxEvents")
+	defer span.End()
+
+	var events []model.OutboxEvent
+	var event model.OutboxEvent
+
+	var query *gocql.Query
+	if after == nil {
+		query = r.session.Query("SELECT shard, bucket, event_id, tweet_id, type, payload, attempts FROM ads_outbox WHERE shard = ? AND bucket = ? LIMIT ?").
+			Bind(shard, bucket, limit)
+	} else {
+		query = r.session.Query("SELECT shard, bucket, event_id, tweet_id, type, payload, attempts FROM ads_outbox WHERE shard = ? AND bucket = ? AND event_id > ? LIMIT ?").
+			Bind(shard, bucket, after, limit)
+	}
+
+	iter := query.Iter()
+	for iter.Scan(&event.Shard, &event.Bucket, &event.EventId, &event.TweetId, &event.Type, &event.Payload, &event.Attempts) {
+		events = append(events, event)
+	}
+
+	return events, iter.Close()
+}
+
+func (r *CassandraTweetRepository) UpdateOutboxAttempts(ctx context.Context, event *model.OutboxEvent) error {
+	_, span := r.tracer.Start(ctx, "CassandraTweetRepository.UpdateOutboxAttempts")
+	defer span.End()
+
+	err := r.session.Query("UPDATE ads_outbox SET attempts = ? WHERE shard = ? AND bucket = ? AND event_id = ?").
+		Bind(event.Attempts, event.Shard, event.Bucket, event.EventId).
+		Exec()
+
+	return err
+}
+
+// Delivered buckets are deleted whole, so the relay never reads over deleted events
+func (r *CassandraTweetRepository) DeleteOutboxBucket(ctx context.Context, shard int, bucket time.Time) error {
+	_, span := r.tracer.Start(ctx, "CassandraTweetRepository.DeleteOutboxBucket")
+	defer span.End()
+
+	err := r.session.Query("DELETE FROM ads_outbox WHERE shard = ? AND bucket = ?").
+		Bind(shard, bucket).
+		Exec()
+
+	return err
+}
+
+func (r *CassandraTweetRepository) FindOutboxCursor(ctx context.Context, shard int) (model.OutboxCursor, error) {
+	_, span := r.tracer.Start(ctx, "CassandraTweetRepository.FindOutboxCursor")
+	defer span.End()
+
+	var cursor model.OutboxCursor
+	err := r.session.Query("SELECT shard, bucket, event_id FROM ads_outbox_cursors WHERE shard = ?").
+		Bind(shard).
+		Scan(&cursor.Shard, &cursor.Bucket, &cursor.EventId)
+
+	return cursor, err
+}
+
+func (r *CassandraTweetRepository) SaveOutboxCursor(ctx context.Context, cursor *model.OutboxCursor) error {
+	_, span := r.tracer.Start(ctx, "CassandraTweetRepository.SaveOutboxCursor")
+	defer span.End()
+
+	err := r.session.Query("INSERT INTO ads_outbox_cursors (shard, bucket, event_id) VALUES (?, ?, ?)").
+		Bind(cursor.Shard, cursor.Bucket, cursor.EventId).
 		Exec()
 
 	return err
@@ -159,25 +280,27 @@ func (r *CassandraTweetRepository) LikedByMe(ctx context.Context, tweetId *gocql
 	return count >= 1, err
 }
 
-func (r *CassandraTweetRepository) GetTimelineTweets(ctx context.Context, username string, lastTweetId string) ([]model.TweetDTO, error) {
+func (r *CassandraTweetRepository) GetTimelineTweets(ctx context.Context, username string, lastTweetId string, limit int) ([]model.TweetDTO, error) {
 	repoCtx, span := r.tracer.Start(ctx, "CassandraTweetRepository.GetTimelineTweets")
 	defer span.End()
 
 	var tweets []model.TweetDTO
 	var tweet model.TweetDTO
+	var imageId string
 
 	var err error
 	var iter *gocql.Iter
 
 	if len(lastTweetId) > 0 {
-		iter = r.session.Query("SELECT posted_by, tweet_id, text, image_id, retweet, original_posted_by, toTimestamp(tweet_id), ad FROM timeline_by_user WHERE posted_by = ? AND tweet_id < ? LIMIT 20").
-			Bind(username, lastTweetId).Iter()
+		iter = r.session.Query("SELECT posted_by, tweet_id, text, image_id, media, entities, retweet, original_posted_by, toTimestamp(tweet_id), ad, original_tweet_id, edited_at FROM timeline_by_user WHERE posted_by = ? AND tweet_id < ? LIMIT ?").
+			Bind(username, lastTweetId, limit).Iter()
 	} else {
-		iter = r.session.Query("SELECT posted_by, tweet_id, text, image_id, retweet, original_posted_by, toTimestamp(tweet_id), ad FROM timeline_by_user WHERE posted_by = ? LIMIT 20").
-			Bind(username).Iter()
+		iter = r.session.Query("SELECT posted_by, tweet_id, text, image_id, media, entities, retweet, original_posted_by, toTimestamp(tweet_id), ad, original_tweet_id, edited_at FROM timeline_by_user WHERE posted_by = ? LIMIT ?").
+			Bind(username, limit).Iter()
 	}
 
-	for iter.Scan(&tweet.PostedBy, &tweet.ID, &tweet.Text, &tweet.ImageId, &tweet.Retweet, &tweet.OriginalPostedBy, &tweet.Timestamp, &tweet.Ad) {
+	for iter.Scan(&tweet.PostedBy, &tweet.ID, &tweet.Text, &imageId, &tweet.Media, &tweet.Entities, &tweet.Retweet, &tweet.OriginalPostedBy, &tweet.Timestamp, &tweet.Ad, &tweet.OriginalTweetId, &tweet.EditedAt) {
+		tweet.Media = withLegacyImage(tweet.Media, imageId)
 
 		tweet.LikesCount, err = r.CountLikes(repoCtx, &tweet.ID)
 		if err != nil {
@@ -189,6 +312,11 @@ func (r *CassandraTweetRepository) GetTimelineTweets(ctx context.Context, userna
 			tweet.LikedByMe = false
 		}
 
+		tweet.BookmarkedByMe, err = r.BookmarkedByMe(repoCtx, &tweet.ID)
+		if err != nil {
+			tweet.BookmarkedByMe = false
+		}
+
 		tweets = append(tweets, tweet)
 	}
 
@@ -220,19 +348,21 @@ func (r *CassandraTweetRepository) GetFeedTweets(ctx context.Context, username s
 
 	var tweets []model.TweetDTO
 	var tweet model.TweetDTO
+	var imageId string
 
 	var err error
 	var iter *gocql.Iter
 
 	if len(lastTweetId) > 0 {
-		iter = r.session.Query("SELECT tweet_id, posted_by, text, image_id, retweet, original_posted_by, toTimestamp(tweet_id), ad FROM feed_by_user WHERE username = ? AND tweet_id < ? LIMIT 20").
+		iter = r.session.Query("SELECT tweet_id, posted_by, text, image_id, media, entities, retweet, original_posted_by, toTimestamp(tweet_id), ad, original_tweet_id, edited_at FROM feed_by_user WHERE username = ? AND tweet_id < ? LIMIT 20").
 			Bind(username, lastTweetId).Iter()
 	} else {
-		iter = r.session.Query("SELECT tweet_id, posted_by, text, image_id, retweet, original_posted_by, toTimestamp(tweet_id), ad FROM feed_by_user WHERE username = ? LIMIT 20").
+		iter = r.session.Query("SELECT tweet_id, posted_by, text, image_id, media, entities, retweet, original_posted_by, toTimestamp(tweet_id), ad, original_tweet_id, edited_at FROM feed_by_user WHERE username = ? LIMIT 20").
 			Bind(username).Iter()
 	}
 
-	for iter.Scan(&tweet.ID, &tweet.PostedBy, &tweet.Text, &tweet.ImageId, &tweet.Retweet, &tweet.OriginalPostedBy, &tweet.Timestamp, &tweet.Ad) {
+	for iter.Scan(&tweet.ID, &tweet.PostedBy, &tweet.Text, &imageId, &tweet.Media, &tweet.Entities, &tweet.Retweet, &tweet.OriginalPostedBy, &tweet.Timestamp, &tweet.Ad, &tweet.OriginalTweetId, &tweet.EditedAt) {
+		tweet.Media = withLegacyImage(tweet.Media, imageId)
 
 		tweet.LikesCount, err = r.CountLikes(repoCtx, &tweet.ID)
 		if err != nil {
@@ -244,6 +374,11 @@ func (r *CassandraTweetRepository) GetFeedTweets(ctx context.Context, username s
 			tweet.LikedByMe = false
 		}
 
+		tweet.BookmarkedByMe, err = r.BookmarkedByMe(repoCtx, &tweet.ID)
+		if err != nil {
+			tweet.BookmarkedByMe = false
+		}
+
 		tweets = append(tweets, tweet)
 	}
 
@@ -255,9 +390,11 @@ func (r *CassandraTweetRepository) FindTweet(ctx context.Context, tweetId string
 	defer span.End()
 
 	var tweet model.Tweet
-	err := r.session.Query("SELECT posted_by, tweet_id, text, image_id, retweet, original_posted_by, ad FROM timeline_by_user WHERE tweet_id = ?").
+	var imageId string
+	err := r.session.Query("SELECT posted_by, tweet_id, text, image_id, media, entities, retweet, original_posted_by, ad, original_tweet_id, edited_at FROM timeline_by_user WHERE tweet_id = ?").
 		Bind(tweetId).Consistency(gocql.One).
-		Scan(&tweet.PostedBy, &tweet.ID, &tweet.Text, &tweet.ImageId, &tweet.Retweet, &tweet.OriginalPostedBy, &tweet.Ad)
+		Scan(&tweet.PostedBy, &tweet.ID, &tweet.Text, &imageId, &tweet.Media, &tweet.Entities, &tweet.Retweet, &tweet.OriginalPostedBy, &tweet.Ad, &tweet.OriginalTweetId, &tweet.EditedAt)
+	tweet.Media = withLegacyImage(tweet.Media, imageId)
 
 	return tweet, err
 }
@@ -268,17 +405,43 @@ func (r *CassandraTweetRepository) FindUserTweets(ctx context.Context, username
 
 	var tweets []model.Tweet
 	var tweet model.Tweet
+	var imageId string
 
-	iter := r.session.Query("SELECT posted_by, tweet_id, text, image_id, retweet, original_posted_by, ad FROM timeline_by_user WHERE posted_by = ?").
+	iter := r.session.Query("SELECT posted_by, tweet_id, text, image_id, media, entities, retweet, original_posted_by, ad, original_tweet_id, edited_at FROM timeline_by_user WHERE posted_by = ?").
 		Bind(username).Iter()
 
-	for iter.Scan(&tweet.PostedBy, &tweet.ID, &tweet.Text, &tweet.ImageId, &tweet.Retweet, &tweet.OriginalPostedBy, &tweet.Ad) {
+	for iter.Scan(&tweet.PostedBy, &tweet.ID, &tweet.Text, &imageId, &tweet.Media, &tweet.Entities, &tweet.Retweet, &tweet.OriginalPostedBy, &tweet.Ad, &tweet.OriginalTweetId, &tweet.EditedAt) {
+		tweet.Media = withLegacyImage(tweet.Media, imageId)
 		tweets = append(tweets, tweet)
 	}
 
 	return tweets
 }
 
+// Calls fn for every tweet of every user, stops at first error
+func (r *CassandraTweetRepository) ScanTweets(ctx context.Context, fn func(tweet model.Tweet) error) error {
+	_, span := r.tracer.Start(ctx, "CassandraTweetRepository.ScanTweets")
+	defer span.End()
+
+	var tweet model.Tweet
+	var imageId string
+
+	iter := r.session.Query("SELECT posted_by, tweet_id, text, image_id, media, entities, retweet, original_posted_by, ad, original_tweet_id, edited_at FROM timeline_by_user").
+		PageSize(500).Iter()
+
+	for iter.Scan(&tweet.PostedBy, &tweet.ID, &tweet.Text, &imageId, &tweet.Media, &tweet.Entities, &tweet.Retweet, &tweet.OriginalPostedBy, &tweet.Ad, &tweet.OriginalTweetId, &tweet.EditedAt) {
+		tweet.Media = withLegacyImage(tweet.Media, imageId)
+		tweet.Timestamp = tweet.ID.Time()
+
+		if err := fn(tweet); err != nil {
+			iter.Close()
+			return err
+		}
+	}
+
+	return iter.Close()
+}
+
 func (r *CassandraTweetRepository) UpdateFeed(ctx context.Context, from string, to string) error {
 	repoCtx, span := r.tracer.Start(ctx, "CassandraTweetRepository.UpdateFeed")
 	defer span.End()
@@ -287,21 +450,368 @@ func (r *CassandraTweetRepository) UpdateFeed(ctx context.Context, from string,
 
 	var err error
 	for _, tweet := range tweets {
-		err = r.session.Query("INSERT INTO feed_by_user (tweet_id, username, posted_by, text, image_id, retweet, original_posted_by, ad) VALUES (?, ?, ?, ?, ?, ?, ?, ?)").
-			Bind(tweet.ID, from, tweet.PostedBy, tweet.Text, tweet.ImageId, tweet.Retweet, tweet.OriginalPostedBy, tweet.Ad).
+		err = r.session.Query("INSERT INTO feed_by_user (tweet_id, username, posted_by, text, media, entities, retweet, original_posted_by, original_tweet_id, ad, edited_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)").
+			Bind(tweet.ID, from, tweet.PostedBy, tweet.Text, tweet.Media, tweet.Entities, tweet.Retweet, tweet.OriginalPostedBy, tweet.OriginalTweetId, tweet.Ad, tweet.EditedAt).
 			Exec()
+		if err == nil {
+			err = r.saveFeedCopy(tweet.ID, from)
+		}
 	}
 
 	return err
 }
 
-func (r *CassandraTweetRepository) IsAd(ctx context.Context, tweetId *gocql.UUID) (bool, error) {
-	_, span := r.tracer.Start(ctx, "CassandraTweetRepository.IsAd")
+// Feed copies are tracked per tweet so that deleting a tweet can find them
+func (r *CassandraTweetRepository) saveFeedCopy(tweetId gocql.UUID, username string) error {
+	return r.session.Query("INSERT INTO feed_copies_by_tweet (tweet_id, username) VALUES (?, ?)").
+		Bind(tweetId, username).
+		Exec()
+}
+
+// Deletes the tweet and every row derived from it, retweets of an original are deleted by the caller
+func (r *CassandraTweetRepository) DeleteTweet(ctx context.Context, tweet *model.Tweet) error {
+	_, span := r.tracer.Start(ctx, "CassandraTweetRepository.DeleteTweet")
 	defer span.End()
 
-	var isAd bool
-	err := r.session.Query("SELECT ad FROM timeline_by_user WHERE tweet_id = ?").
-		Bind(tweetId).Consistency(gocql.One).Scan(&isAd)
+	var err error
+	var username string
+	iter := r.session.Query("SELECT username FROM feed_copies_by_tweet WHERE tweet_id = ?").
+		Bind(tweet.ID).Iter()
+	for iter.Scan(&username) {
+		err = r.session.Query("DELETE FROM feed_by_user WHERE username = ? AND tweet_id = ?").
+			Bind(username, tweet.ID).
+			Exec()
+		if err != nil {
+			iter.Close()
+			return err
+		}
+	}
+	if err = iter.Close(); err != nil {
+		return err
+	}
+
+	// copies in author's feed written before copies were tracked
+	err = r.session.Query("DELETE FROM feed_by_user WHERE username = ? AND tweet_id = ?").
+		Bind(tweet.PostedBy, tweet.ID).
+		Exec()
+	if err != nil {
+		return err
+	}
+
+	if !tweet.Retweet {
+		err = r.unpin(tweet.PostedBy, tweet.ID)
+		if err != nil {
+			return err
+		}
+
+		err = r.deleteEdits(tweet)
+		if err != nil {
+			return err
+		}
+
+		if tweet.Ad {
+			err = r.session.Query("DELETE FROM ad_target_groups WHERE tweet_id = ?").
+				Bind(tweet.ID).
+				Exec()
+			if err != nil {
+				return err
+			}
+		}
+
+		err = r.deleteMentions(tweet, entities.Mentions(tweet.Entities))
+		if err != nil {
+			return err
+		}
+
+		err = r.deleteHashtags(tweet, entities.Hashtags(tweet.Entities))
+		if err != nil {
+			return err
+		}
+	}
+
+	err = r.session.Query("DELETE FROM feed_copies_by_tweet WHERE tweet_id = ?").
+		Bind(tweet.ID).
+		Exec()
+	if err != nil {
+		return err
+	}
+
+	err = r.session.Query("DELETE FROM likes WHERE tweet_id = ?").
+		Bind(tweet.ID).
+		Exec()
+	if err != nil {
+		return err
+	}
+
+	if tweet.Retweet && tweet.OriginalTweetId != nil {
+		err = r.deleteRetweetRef(tweet)
+		if err != nil {
+			return err
+		}
+	}
+
+	// timeline row goes last, tweet can be found and deleted again until everything else is gone
+	return r.session.Query("DELETE FROM timeline_by_user WHERE posted_by = ? AND tweet_id = ?").
+		Bind(tweet.PostedBy, tweet.ID).
+		Exec()
+}
+
+// Image is queued for orphan cleanup in the hour it was uploaded
+func (r *CassandraTweetRepository) SaveImageInfo(ctx context.Context, image *model.Image) error {
+	_, span := r.tracer.Start(ctx, "CassandraTweetRepository.SaveImageInfo")
+	defer span.End()
+
+	batch := r.session.NewBatch(gocql.LoggedBatch).WithContext(ctx)
+	batch.Query("INSERT INTO images (image_id, uploaded_by, width, height, size, hash, uploaded_at, used_by) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		image.ID, image.UploadedBy, image.Width, image.Height, image.Size, image.Hash, image.UploadedAt, image.UsedBy)
+	batch.Query("INSERT INTO unattached_images (hour, image_id) VALUES (?, ?)",
+		image.UploadedAt.Truncate(time.Hour), image.ID)
+
+	return r.session.ExecuteBatch(batch)
+}
+
+func (r *CassandraTweetRepository) FindImage(ctx context.Context, imageId string) (model.Image, error) {
+	_, span := r.tracer.Start(ctx, "CassandraTweetRepository.FindImage")
+	defer span.End()
+
+	var image model.Image
+	err := r.session.Query("SELECT image_id, uploaded_by, width, height, size, hash, uploaded_at, used_by FROM images WHERE image_id = ?").
+		Bind(imageId).Consistency(gocql.One).
+		Scan(&image.ID, &image.UploadedBy, &image.Width, &image.Height, &image.Size, &image.Hash, &image.UploadedAt, &image.UsedBy)
+
+	return image, err
+}
+
+// Images are kept while anything is attached to them, usedBy names what they are attached to
+func (r *CassandraTweetRepository) AttachImages(ctx context.Context, usedBy string, media []model.Media) error {
+	_, span := r.tracer.Start(ctx, "CassandraTweetRepository.AttachImages")
+	defer span.End()
+
+	for _, m := range media {
+		err := r.session.Query("UPDATE images SET used_by = used_by + ? WHERE image_id = ?").
+			Bind([]string{usedBy}, m.ID).
+			Exec()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Detached image is queued for orphan cleanup again, it is deleted unless something attaches it within max age
+func (r *CassandraTweetRepository) DetachImages(ctx context.Context, usedBy string, media []model.Media) error {
+	_, span := r.tracer.Start(ctx, "CassandraTweetRepository.DetachImages")
+	defer span.End()
+
+	hour := time.Now().Truncate(time.Hour)
+
+	var err error
+	for _, m := range media {
+		batch := r.session.NewBatch(gocql.LoggedBatch).WithContext(ctx)
+		batch.Query("UPDATE images SET used_by = used_by - ? WHERE image_id = ?",
+			[]string{usedBy}, m.ID)
+		batch.Query("INSERT INTO unattached_images (hour, image_id) VALUES (?, ?)",
+			hour, m.ID)
+
+		// remaining images are still released, first error is returned
+		if batchErr := r.session.ExecuteBatch(batch); batchErr != nil && err == nil {
+			err = batchErr
+		}
+	}
+
+	return err
+}
+
+// Images queued for orphan cleanup in given hour, some of them may be attached by now
+func (r *CassandraTweetRepository) FindUnattachedImages(ctx context.Context, hour time.Time) ([]string, error) {
+	_, span := r.tracer.Start(ctx, "CassandraTweetRepository.FindUnattachedImages")
+	defer span.End()
+
+	var imageIds []string
+	var imageId string
+
+	iter := r.session.Query("SELECT image_id FROM unattached_images WHERE hour = ?").
+		Bind(hour).Iter()
+
+	for iter.Scan(&imageId) {
+		imageIds = append(imageIds, imageId)
+	}
+
+	return imageIds, iter.Close()
+}
+
+// Hour is removed from the queue at once when all of its images are handled
+func (r *CassandraTweetRepository) DeleteUnattachedImages(ctx context.Context, hour time.Time) error {
+	_, span := r.tracer.Start(ctx, "CassandraTweetRepository.DeleteUnattachedImages")
+	defer span.End()
+
+	err := r.session.Query("DELETE FROM unattached_images WHERE hour = ?").
+		Bind(hour).
+		Exec()
+
+	return err
+}
+
+// Image info is deleted only if nothing is attached to the image, reports whether it was deleted
+func (r *CassandraTweetRepository) DeleteOrphanImage(ctx context.Context, imageId string) (bool, error) {
+	_, span := r.tracer.Start(ctx, "CassandraTweetRepository.DeleteOrphanImage")
+	defer span.End()
+
+	applied, err := r.session.Query("DELETE FROM images WHERE image_id = ? IF used_by = null").
+		Bind(imageId).
+		MapScanCAS(make(map[string]interface{}))
+
+	return applied, err
+}
+
+// Adds a reference to stored content. Reference can't be added while the content is being deleted,
+// so content that has a reference is never deleted.
+func (r *CassandraTweetRepository) IncrementImageRefs(ctx context.Context, hash string) error {
+	_, span := r.tracer.Start(ctx, "CassandraTweetRepository.IncrementImageRefs")
+	defer span.End()
+
+	for attempt := 0; attempt < imageBlobAttempts; attempt++ {
+		// serial read sees the outcome of every compare-and-set before it
+		var refs int
+		var deleting bool
+		err := r.session.Query("SELECT refs, deleting FROM image_blobs WHERE hash = ?").
+			Bind(hash).Consistency(gocql.Consistency(gocql.Serial)).
+			Scan(&refs, &deleting)
+
+		if err == gocql.ErrNotFound {
+			applied, err := r.session.Query("INSERT INTO image_blobs (hash, refs, deleting) VALUES (?, 1, false) IF NOT EXISTS").
+				Bind(hash).
+				MapScanCAS(make(map[string]interface{}))
+			if err != nil || applied {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if deleting {
+			time.Sleep(imageBlobRetryDelay)
+			continue
+		}
+
+		applied, err := r.session.Query("UPDATE image_blobs SET refs = ? WHERE hash = ? IF refs = ? AND deleting != true").
+			Bind(refs+1, hash, refs).
+			MapScanCAS(make(map[string]interface{}))
+		if err != nil || applied {
+			return err
+		}
+	}
+
+	return errImageBlobBusy
+}
+
+// Returns number of references left after decrement
+func (r *CassandraTweetRepository) DecrementImageRefs(ctx context.Context, hash string) (int, error) {
+	_, span := r.tracer.Start(ctx, "CassandraTweetRepository.DecrementImageRefs")
+	defer span.End()
+
+	for attempt := 0; attempt < imageBlobAttempts; attempt++ {
+		var refs int
+		err := r.session.Query("SELECT refs FROM image_blobs WHERE hash = ?").
+			Bind(hash).Consistency(gocql.Consistency(gocql.Serial)).
+			Scan(&refs)
+		if err != nil {
+			return 0, err
+		}
+
+		if refs <= 0 {
+			return 0, nil
+		}
+
+		applied, err := r.session.Query("UPDATE image_blobs SET refs = ? WHERE hash = ? IF refs = ?").
+			Bind(refs-1, hash, refs).
+			MapScanCAS(make(map[string]interface{}))
+		if err != nil {
+			return 0, err
+		}
+		if applied {
+			return refs - 1, nil
+		}
+	}
+
+	return 0, errImageBlobBusy
+}
+
+// Content is locked for deletion only while it has no references, reports whether it was locked.
+// Lock expires on its own, so content isn't blocked forever by a cleaner that stopped halfway.
+func (r *CassandraTweetRepository) LockImageBlob(ctx context.Context, hash string) (bool, error) {
+	_, span := r.tracer.Start(ctx, "CassandraTweetRepository.LockImageBlob")
+	defer span.End()
+
+	applied, err := r.session.Query("UPDATE image_blobs USING TTL ? SET deleting = true WHERE hash = ? IF refs = 0").
+		Bind(int(imageBlobLockTtl.Seconds()), hash).
+		MapScanCAS(make(map[string]interface{}))
+
+	return applied, err
+}
+
+// Forgets deleted content, the same content uploaded again starts with a new row
+func (r *CassandraTweetRepository) DeleteImageBlob(ctx context.Context, hash string) error {
+	_, span := r.tracer.Start(ctx, "CassandraTweetRepository.DeleteImageBlob")
+	defer span.End()
+
+	_, err := r.session.Query("DELETE FROM image_blobs WHERE hash = ? IF deleting = true").
+		Bind(hash).
+		MapScanCAS(make(map[string]interface{}))
+
+	return err
+}
+
+func (r *CassandraTweetRepository) SavePendingFanout(ctx context.Context, fanout *model.PendingFanout) error {
+	_, span := r.tracer.Start(ctx, "CassandraTweetRepository.SavePendingFanout")
+	defer span.End()
+
+	err := r.session.Query("INSERT INTO pending_fanouts (tweet_id, posted_by, target_group, attempts, last_error) VALUES (?, ?, ?, ?, ?)").
+		Bind(fanout.TweetId, fanout.PostedBy, fanout.TargetGroup, fanout.Attempts, fanout.LastError).
+		Exec()
+
+	return err
+}
+
+// One page of pending fan-outs, scan continues from returned page state until it is empty
+func (r *CassandraTweetRepository) FindPendingFanouts(ctx context.Context, pageState []byte, limit int) ([]model.PendingFanout, []byte, error) {
+	_, span := r.tracer.Start(ctx, "CassandraTweetRepository.FindPendingFanouts")
+	defer span.End()
+
+	var fanouts []model.PendingFanout
+	var fanout model.PendingFanout
+
+	iter := r.session.Query("SELECT tweet_id, posted_by, target_group, attempts, last_error FROM pending_fanouts").
+		WithContext(ctx).PageSize(limit).PageState(pageState).Iter()
+
+	nextPageState := iter.PageState()
+	for i := 0; i < limit && iter.Scan(&fanout.TweetId, &fanout.PostedBy, &fanout.TargetGroup, &fanout.Attempts, &fanout.LastError); i++ {
+		fanouts = append(fanouts, fanout)
+		fanout.TargetGroup = nil
+	}
+
+	return fanouts, nextPageState, iter.Close()
+}
+
+func (r *CassandraTweetRepository) DeletePendingFanout(ctx context.Context, tweetId *gocql.UUID) error {
+	_, span := r.tracer.Start(ctx, "CassandraTweetRepository.DeletePendingFanout")
+	defer span.End()
+
+	err := r.session.Query("DELETE FROM pending_fanouts WHERE tweet_id = ?").
+		Bind(tweetId).
+		Exec()
+
+	return err
+}
+
+// Tweets saved before media attachments only have image_id set
+func withLegacyImage(media []model.Media, imageId string) []model.Media {
+	if len(media) == 0 && len(imageId) > 0 {
+		return []model.Media{{ID: imageId}}
+	}
 
-	return isAd, err
+	return media
 }
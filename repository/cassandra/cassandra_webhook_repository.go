@@ -0,0 +1,212 @@
+package cassandra
+
+import (
+	"context"
+	"github.com/gocql/gocql"
+	"time"
+	"tweet/model"
+)
+
+func (r *CassandraTweetRepository) SaveWebhook(ctx context.Context, webhook *model.Webhook) error {
+	_, span := r.tracer.Start(ctx, "CassandraTweetRepository.SaveWebhook")
+	defer span.End()
+
+	err := r.session.Query("INSERT INTO webhooks (webhook_id, owner, account, url, secret, events, enabled, failures, disabled_reason) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)").
+		Bind(webhook.ID, webhook.Owner, webhook.Account, webhook.URL, webhook.Secret, webhook.Events, webhook.Enabled, webhook.Failures, webhook.DisabledReason).
+		Exec()
+
+	return err
+}
+
+func (r *CassandraTweetRepository) FindWebhook(ctx context.Context, webhookId *gocql.UUID) (model.Webhook, error) {
+	_, span := r.tracer.Start(ctx, "CassandraTweetRepository.FindWebhook")
+	defer span.End()
+
+	var webhook model.Webhook
+	err := r.session.Query("SELECT webhook_id, owner, account, url, secret, events, enabled, failures, disabled_reason FROM webhooks WHERE webhook_id = ?").
+		Bind(webhookId).Consistency(gocql.One).
+		Scan(&webhook.ID, &webhook.Owner, &webhook.Account, &webhook.URL, &webhook.Secret, &webhook.Events, &webhook.Enabled, &webhook.Failures, &webhook.DisabledReason)
+	webhook.CreatedAt = webhook.ID.Time()
+
+	return webhook, err
+}
+
+func (r *CassandraTweetRepository) FindWebhooksByOwner(ctx context.Context, owner string) ([]model.Webhook, error) {
+	_, span := r.tracer.Start(ctx, "CassandraTweetRepository.FindWebhooksByOwner")
+	defer span.End()
+
+	iter := r.session.Query("SELECT webhook_id, owner, account, url, secret, events, enabled, failures, disabled_reason FROM webhooks WHERE owner = ?").
+		Bind(owner).Iter()
+
+	return scanWebhooks(iter)
+}
+
+func (r *CassandraTweetRepository) FindWebhooksByAccount(ctx context.Context, account string) ([]model.Webhook, error) {
+	_, span := r.tracer.Start(ctx, "CassandraTweetRepository.FindWebhooksByAccount")
+	defer span.End()
+
+	iter := r.session.Query("SELECT webhook_id, owner, account, url, secret, events, enabled, failures, disabled_reason FROM webhooks WHERE account = ?").
+		Bind(account).Iter()
+
+	return scanWebhooks(iter)
+}
+
+func scanWebhooks(iter *gocql.Iter) ([]model.Webhook, error) {
+	var webhooks []model.Webhook
+	var webhook model.Webhook
+
+	for iter.Scan(&webhook.ID, &webhook.Owner, &webhook.Account, &webhook.URL, &webhook.Secret, &webhook.Events, &webhook.Enabled, &webhook.Failures, &webhook.DisabledReason) {
+		webhook.CreatedAt = webhook.ID.Time()
+		webhooks = append(webhooks, webhook)
+	}
+
+	return webhooks, iter.Close()
+}
+
+func (r *CassandraTweetRepository) UpdateWebhookStatus(ctx context.Context, webhook *model.Webhook) error {
+	_, span := r.tracer.Start(ctx, "CassandraTweetRepository.UpdateWebhookStatus")
+	defer span.End()
+
+	err := r.session.Query("UPDATE webhooks SET enabled = ?, failures = ?, disabled_reason = ? WHERE webhook_id = ?").
+		Bind(webhook.Enabled, webhook.Failures, webhook.DisabledReason, webhook.ID).
+		Exec()
+
+	return err
+}
+
+func (r *CassandraTweetRepository) DeleteWebhook(ctx context.Context, webhookId *gocql.UUID) error {
+	_, span := r.tracer.Start(ctx, "CassandraTweetRepository.DeleteWebhook")
+	defer span.End()
+
+	err := r.session.Query("DELETE FROM webhooks WHERE webhook_id = ?").
+		Bind(webhookId).
+		Exec()
+	if err != nil {
+		return err
+	}
+
+	err = r.session.Query("DELETE FROM webhook_delivery_log WHERE webhook_id = ?").
+		Bind(webhookId).
+		Exec()
+
+	return err
+}
+
+func (r *CassandraTweetRepository) SaveWebhookDelivery(ctx context.Context, delivery *model.WebhookDelivery) error {
+	_, span := r.tracer.Start(ctx, "CassandraTweetRepository.SaveWebhookDelivery")
+	defer span.End()
+
+	err := r.session.Query("INSERT INTO webhook_deliveries (shard, bucket, next_attempt_at, delivery_id, webhook_id, event_type, payload, attempts) VALUES (?, ?, ?, ?, ?, ?, ?, ?)").
+		Bind(delivery.Shard, delivery.Bucket, delivery.NextAttemptAt, delivery.DeliveryId, delivery.WebhookId, delivery.EventType, delivery.Payload, delivery.Attempts).
+		Exec()
+
+	return err
+}
+
+// Deliveries of a bucket that are due at given time, earliest first
+func (r *CassandraTweetRepository) FindDueWebhookDeliveries(ctx context.Context, shard int, bucket time.Time, now time.Time, limit int) ([]model.WebhookDelivery, error) {
+	_, span := r.tracer.Start(ctx, "CassandraTweetRepository.FindDueWebhookDeliveries")
+	defer span.End()
+
+	var deliveries []model.WebhookDelivery
+	var delivery model.WebhookDelivery
+
+	iter := r.session.Query("SELECT shard, bucket, next_attempt_at, delivery_id, webhook_id, event_type, payload, attempts FROM webhook_deliveries WHERE shard = ? AND bucket = ? AND next_attempt_at <= ? LIMIT ?").
+		Bind(shard, bucket, now, limit).Iter()
+
+	for iter.Scan(&delivery.Shard, &delivery.Bucket, &delivery.NextAttemptAt, &delivery.DeliveryId, &delivery.WebhookId, &delivery.EventType, &delivery.Payload, &delivery.Attempts) {
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, iter.Close()
+}
+
+// Moves the delivery to the bucket of its next attempt, both rows change in one logged batch
+func (r *CassandraTweetRepository) RescheduleWebhookDelivery(ctx context.Context, previous *model.WebhookDelivery, delivery *model.WebhookDelivery) error {
+	_, span := r.tracer.Start(ctx, "CassandraTweetRepository.RescheduleWebhookDelivery")
+	defer span.End()
+
+	batch := r.session.NewBatch(gocql.LoggedBatch).WithContext(ctx)
+	batch.Query("DELETE FROM webhook_deliveries WHERE shard = ? AND bucket = ? AND next_attempt_at = ? AND delivery_id = ?",
+		previous.Shard, previous.Bucket, previous.NextAttemptAt, previous.DeliveryId)
+	batch.Query("INSERT INTO webhook_deliveries (shard, bucket, next_attempt_at, delivery_id, webhook_id, event_type, payload, attempts) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		delivery.Shard, delivery.Bucket, delivery.NextAttemptAt, delivery.DeliveryId, delivery.WebhookId, delivery.EventType, delivery.Payload, delivery.Attempts)
+
+	return r.session.ExecuteBatch(batch)
+}
+
+func (r *CassandraTweetRepository) DeleteWebhookDelivery(ctx context.Context, delivery *model.WebhookDelivery) error {
+	_, span := r.tracer.Start(ctx, "CassandraTweetRepository.DeleteWebhookDelivery")
+	defer span.End()
+
+	err := r.session.Query("DELETE FROM webhook_deliveries WHERE shard = ? AND bucket = ? AND next_attempt_at = ? AND delivery_id = ?").
+		Bind(delivery.Shard, delivery.Bucket, delivery.NextAttemptAt, delivery.DeliveryId).
+		Exec()
+
+	return err
+}
+
+// Drained buckets are deleted whole, so the worker never reads over deleted deliveries of old buckets
+func (r *CassandraTweetRepository) DeleteWebhookDeliveryBucket(ctx context.Context, shard int, bucket time.Time) error {
+	_, span := r.tracer.Start(ctx, "CassandraTweetRepository.DeleteWebhookDeliveryBucket")
+	defer span.End()
+
+	err := r.session.Query("DELETE FROM webhook_deliveries WHERE shard = ? AND bucket = ?").
+		Bind(shard, bucket).
+		Exec()
+
+	return err
+}
+
+func (r *CassandraTweetRepository) FindWebhookCursor(ctx context.Context, shard int) (model.WebhookCursor, error) {
+	_, span := r.tracer.Start(ctx, "CassandraTweetRepository.FindWebhookCursor")
+	defer span.End()
+
+	var cursor model.WebhookCursor
+	err := r.session.Query("SELECT shard, bucket FROM webhook_delivery_cursors WHERE shard = ?").
+		Bind(shard).
+		Scan(&cursor.Shard, &cursor.Bucket)
+
+	return cursor, err
+}
+
+func (r *CassandraTweetRepository) SaveWebhookCursor(ctx context.Context, cursor *model.WebhookCursor) error {
+	_, span := r.tracer.Start(ctx, "CassandraTweetRepository.SaveWebhookCursor")
+	defer span.End()
+
+	err := r.session.Query("INSERT INTO webhook_delivery_cursors (shard, bucket) VALUES (?, ?)").
+		Bind(cursor.Shard, cursor.Bucket).
+		Exec()
+
+	return err
+}
+
+func (r *CassandraTweetRepository) SaveWebhookAttempt(ctx context.Context, attempt *model.WebhookAttempt) error {
+	_, span := r.tracer.Start(ctx, "CassandraTweetRepository.SaveWebhookAttempt")
+	defer span.End()
+
+	err := r.session.Query("INSERT INTO webhook_delivery_log (webhook_id, attempt_id, delivery_id, event_type, attempt, outcome, status_code, error, duration_ms) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)").
+		Bind(attempt.WebhookId, attempt.AttemptId, attempt.DeliveryId, attempt.EventType, attempt.Attempt, attempt.Outcome, attempt.StatusCode, attempt.Error, attempt.DurationMs).
+		Exec()
+
+	return err
+}
+
+// Newest attempts first, log entries expire after a week
+func (r *CassandraTweetRepository) FindWebhookAttempts(ctx context.Context, webhookId *gocql.UUID, limit int) ([]model.WebhookAttempt, error) {
+	_, span := r.tracer.Start(ctx, "CassandraTweetRepository.FindWebhookAttempts")
+	defer span.End()
+
+	var attempts []model.WebhookAttempt
+	var attempt model.WebhookAttempt
+
+	iter := r.session.Query("SELECT webhook_id, attempt_id, delivery_id, event_type, attempt, outcome, status_code, error, duration_ms FROM webhook_delivery_log WHERE webhook_id = ? LIMIT ?").
+		Bind(webhookId, limit).Iter()
+
+	for iter.Scan(&attempt.WebhookId, &attempt.AttemptId, &attempt.DeliveryId, &attempt.EventType, &attempt.Attempt, &attempt.Outcome, &attempt.StatusCode, &attempt.Error, &attempt.DurationMs) {
+		attempt.AttemptedAt = attempt.AttemptId.Time()
+		attempts = append(attempts, attempt)
+	}
+
+	return attempts, iter.Close()
+}
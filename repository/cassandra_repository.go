@@ -4,20 +4,88 @@ import (
 	"context"
 	"github.com/FTN-TwitterClone/grpc-stubs/proto/social_graph"
 	"github.com/gocql/gocql"
+	"time"
 	"tweet/model"
 )
 
 type CassandraRepository interface {
-	SaveTweet(ctx context.Context, tweet *model.TweetDTO, usernames []*social_graph.SocialGraphUsername) error
-	SaveLike(ctx context.Context, like *model.Like) error
-	DeleteLike(ctx context.Context, tweetId *gocql.UUID, username string) error
-	GetTimelineTweets(ctx context.Context, username string, lastTweetId string) ([]model.TweetDTO, error)
+	SaveTweet(ctx context.Context, tweet *model.TweetDTO, usernames []*social_graph.SocialGraphUsername, events ...model.OutboxEvent) error
+	SaveFeedTweets(ctx context.Context, tweet *model.TweetDTO, usernames []*social_graph.SocialGraphUsername) error
+	SaveLike(ctx context.Context, like *model.Like, events ...model.OutboxEvent) error
+	DeleteLike(ctx context.Context, tweetId *gocql.UUID, username string, events ...model.OutboxEvent) error
+	GetTimelineTweets(ctx context.Context, username string, lastTweetId string, limit int) ([]model.TweetDTO, error)
 	GetFeedTweets(ctx context.Context, username string, lastTweetId string) ([]model.TweetDTO, error)
 	GetLikesByTweet(ctx context.Context, tweetId string) *[]model.Like
 	CountLikes(ctx context.Context, tweetId *gocql.UUID) (int16, error)
 	FindTweet(ctx context.Context, tweetId string) (model.Tweet, error)
 	FindUserTweets(ctx context.Context, username string) []model.Tweet
+	ScanTweets(ctx context.Context, fn func(tweet model.Tweet) error) error
 	LikedByMe(ctx context.Context, tweetId *gocql.UUID) (bool, error)
+	SaveBookmark(ctx context.Context, bookmark *model.Bookmark) error
+	FindBookmark(ctx context.Context, username string, tweetId *gocql.UUID) (model.Bookmark, error)
+	DeleteBookmark(ctx context.Context, bookmark *model.Bookmark) error
+	GetBookmarks(ctx context.Context, username string, lastBookmarkId string, limit int) ([]model.Bookmark, error)
+	BookmarkedByMe(ctx context.Context, tweetId *gocql.UUID) (bool, error)
 	UpdateFeed(ctx context.Context, from string, to string) error
-	IsAd(ctx context.Context, tweetId *gocql.UUID) (bool, error)
+	DeleteTweet(ctx context.Context, tweet *model.Tweet) error
+	FindRetweetIds(ctx context.Context, tweetId *gocql.UUID) ([]gocql.UUID, error)
+	EditTweet(ctx context.Context, tweet *model.Tweet, previous []model.Entity, events ...model.OutboxEvent) error
+	SaveTweetEdit(ctx context.Context, edit *model.TweetEdit) (bool, error)
+	SaveAdTargetGroup(ctx context.Context, tweetId *gocql.UUID, targetGroup *model.TargetGroup) error
+	FindAdTargetGroup(ctx context.Context, tweetId *gocql.UUID) (model.TargetGroup, error)
+	FindTweetEdits(ctx context.Context, tweetId *gocql.UUID) ([]model.TweetEdit, error)
+	PinTweet(ctx context.Context, username string, tweetId *gocql.UUID) error
+	UnpinTweet(ctx context.Context, username string, tweetId *gocql.UUID) error
+	FindPinnedTweet(ctx context.Context, username string) (gocql.UUID, error)
+	SaveMentions(ctx context.Context, tweet *model.TweetDTO, usernames []string) error
+	GetMentionTweets(ctx context.Context, username string, lastTweetId string) ([]model.TweetDTO, error)
+	SaveHashtags(ctx context.Context, tweet *model.TweetDTO, tags []string) error
+	GetHashtagTweets(ctx context.Context, tag string, lastTweetId string) ([]model.TweetDTO, error)
+	SaveImageInfo(ctx context.Context, image *model.Image) error
+	FindImage(ctx context.Context, imageId string) (model.Image, error)
+	AttachImages(ctx context.Context, usedBy string, media []model.Media) error
+	DetachImages(ctx context.Context, usedBy string, media []model.Media) error
+	FindUnattachedImages(ctx context.Context, hour time.Time) ([]string, error)
+	DeleteUnattachedImages(ctx context.Context, hour time.Time) error
+	DeleteOrphanImage(ctx context.Context, imageId string) (bool, error)
+	IncrementImageRefs(ctx context.Context, hash string) error
+	DecrementImageRefs(ctx context.Context, hash string) (int, error)
+	LockImageBlob(ctx context.Context, hash string) (bool, error)
+	DeleteImageBlob(ctx context.Context, hash string) error
+	SavePendingFanout(ctx context.Context, fanout *model.PendingFanout) error
+	FindPendingFanouts(ctx context.Context, pageState []byte, limit int) ([]model.PendingFanout, []byte, error)
+	DeletePendingFanout(ctx context.Context, tweetId *gocql.UUID) error
+	FindOutboxEvents(ctx context.Context, shard int, bucket time.Time, after *gocql.UUID, limit int) ([]model.OutboxEvent, error)
+	UpdateOutboxAttempts(ctx context.Context, event *model.OutboxEvent) error
+	DeleteOutboxBucket(ctx context.Context, shard int, bucket time.Time) error
+	FindOutboxCursor(ctx context.Context, shard int) (model.OutboxCursor, error)
+	SaveOutboxCursor(ctx context.Context, cursor *model.OutboxCursor) error
+	SaveWebhook(ctx context.Context, webhook *model.Webhook) error
+	FindWebhook(ctx context.Context, webhookId *gocql.UUID) (model.Webhook, error)
+	FindWebhooksByOwner(ctx context.Context, owner string) ([]model.Webhook, error)
+	FindWebhooksByAccount(ctx context.Context, account string) ([]model.Webhook, error)
+	UpdateWebhookStatus(ctx context.Context, webhook *model.Webhook) error
+	DeleteWebhook(ctx context.Context, webhookId *gocql.UUID) error
+	SaveWebhookDelivery(ctx context.Context, delivery *model.WebhookDelivery) error
+	FindDueWebhookDeliveries(ctx context.Context, shard int, bucket time.Time, now time.Time, limit int) ([]model.WebhookDelivery, error)
+	RescheduleWebhookDelivery(ctx context.Context, previous *model.WebhookDelivery, delivery *model.WebhookDelivery) error
+	DeleteWebhookDelivery(ctx context.Context, delivery *model.WebhookDelivery) error
+	DeleteWebhookDeliveryBucket(ctx context.Context, shard int, bucket time.Time) error
+	FindWebhookCursor(ctx context.Context, shard int) (model.WebhookCursor, error)
+	SaveWebhookCursor(ctx context.Context, cursor *model.WebhookCursor) error
+	SaveWebhookAttempt(ctx context.Context, attempt *model.WebhookAttempt) error
+	FindWebhookAttempts(ctx context.Context, webhookId *gocql.UUID, limit int) ([]model.WebhookAttempt, error)
+	SaveScheduledTweet(ctx context.Context, scheduled *model.ScheduledTweet) error
+	UpdateScheduledTweet(ctx context.Context, previous *model.ScheduledTweet, scheduled *model.ScheduledTweet) (bool, error)
+	UpdateScheduledTweetState(ctx context.Context, scheduled *model.ScheduledTweet, expectedVersion int) (bool, error)
+	FindScheduledTweet(ctx context.Context, username string, scheduledId *gocql.UUID) (model.ScheduledTweet, error)
+	FindScheduledTweetsByUser(ctx context.Context, username string) ([]model.ScheduledTweet, error)
+	FindDueScheduledTweets(ctx context.Context, before time.Time, limit int) ([]model.ScheduledTweet, error)
+	DeleteScheduledTweet(ctx context.Context, scheduled *model.ScheduledTweet) (bool, error)
+	DeleteScheduledTweetDue(ctx context.Context, scheduled *model.ScheduledTweet) error
+	SaveDraft(ctx context.Context, draft *model.Draft) error
+	UpdateDraft(ctx context.Context, draft *model.Draft, expectedVersion int) (bool, error)
+	FindDraft(ctx context.Context, username string, draftId *gocql.UUID) (model.Draft, error)
+	FindDraftsByUser(ctx context.Context, username string) ([]model.Draft, error)
+	DeleteDraft(ctx context.Context, draft *model.Draft) (bool, error)
 }
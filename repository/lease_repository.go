@@ -0,0 +1,13 @@
+package repository
+
+import (
+	"context"
+	"time"
+)
+
+// Named leases, each held by at most one replica until it expires or is released
+type LeaseRepository interface {
+	// Takes the lease or extends it when holder already has it
+	AcquireLease(ctx context.Context, name string, holder string, ttl time.Duration) (bool, error)
+	ReleaseLease(ctx context.Context, name string, holder string) error
+}
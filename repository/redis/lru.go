@@ -0,0 +1,85 @@
+package redis
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// In-process cache in front of redis, holds at most capacity bytes of values
+type lruCache struct {
+	mu       sync.Mutex
+	capacity int
+	size     int
+	ttl      time.Duration
+	entries  map[string]*list.Element
+	order    *list.List
+}
+
+type lruEntry struct {
+	key       string
+	value     []byte
+	expiresAt time.Time
+}
+
+func newLRUCache(capacity int, ttl time.Duration) *lruCache {
+	return &lruCache{
+		capacity: capacity,
+		ttl:      ttl,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+func (c *lruCache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := element.Value.(*lruEntry)
+	if time.Now().After(entry.expiresAt) {
+		c.remove(element)
+		return nil, false
+	}
+
+	entry.expiresAt = time.Now().Add(c.ttl)
+	c.order.MoveToFront(element)
+
+	return entry.value, true
+}
+
+// Value bigger than the whole cache is not stored
+func (c *lruCache) Set(key string, value []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+
+	if len(value) > c.capacity {
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&lruEntry{
+		key:       key,
+		value:     value,
+		expiresAt: time.Now().Add(c.ttl),
+	})
+	c.size += len(value)
+
+	for c.size > c.capacity {
+		c.remove(c.order.Back())
+	}
+}
+
+func (c *lruCache) remove(element *list.Element) {
+	entry := element.Value.(*lruEntry)
+	c.order.Remove(element)
+	delete(c.entries, entry.key)
+	c.size -= len(entry.value)
+}
@@ -0,0 +1,66 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-redis/redis"
+	"go.opentelemetry.io/otel/trace"
+	"time"
+	"tweet/config"
+)
+
+// Lease is set only if it is free, or extended if holder already has it
+var acquireLease = redis.NewScript(`
+if redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+	return 1
+end
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	redis.call("PEXPIRE", KEYS[1], ARGV[2])
+	return 1
+end
+return 0
+`)
+
+// Lease taken over by someone else after it expired is left alone
+var releaseLease = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+type RedisLeaseRepository struct {
+	tracer trace.Tracer
+	cli    *redis.Client
+}
+
+// Holder whose extension times out steps down, so lease calls get more time than cache calls
+func NewRedisLeaseRepository(tracer trace.Tracer) *RedisLeaseRepository {
+	return &RedisLeaseRepository{
+		tracer: tracer,
+		cli:    newRedisClient(config.GetDuration("LEASE_REDIS_TIMEOUT", 2*time.Second)),
+	}
+}
+
+func (r *RedisLeaseRepository) AcquireLease(ctx context.Context, name string, holder string, ttl time.Duration) (bool, error) {
+	_, span := r.tracer.Start(ctx, "RedisLeaseRepository.AcquireLease")
+	defer span.End()
+
+	acquired, err := acquireLease.Run(r.cli, []string{leaseKey(name)}, holder, ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, err
+	}
+
+	return acquired == 1, nil
+}
+
+func (r *RedisLeaseRepository) ReleaseLease(ctx context.Context, name string, holder string) error {
+	_, span := r.tracer.Start(ctx, "RedisLeaseRepository.ReleaseLease")
+	defer span.End()
+
+	return releaseLease.Run(r.cli, []string{leaseKey(name)}, holder).Err()
+}
+
+func leaseKey(name string) string {
+	return fmt.Sprintf("leases:%s", name)
+}
@@ -0,0 +1,149 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-redis/redis"
+	"go.opentelemetry.io/otel/trace"
+	"time"
+	"tweet/model"
+)
+
+// Buckets are kept a bit longer than the longest period that reads them
+var trendsRetention = map[time.Duration]time.Duration{
+	5 * time.Minute: 2 * time.Hour,
+	time.Hour:       50 * time.Hour,
+	24 * time.Hour:  9 * 24 * time.Hour,
+}
+
+// Sums of bucket ranges are cached for a short time, so concurrent reads share them
+const trendsUnionTtl = 30 * time.Second
+
+// Counts hashtags in sorted sets, one set per bucket of every granularity
+type RedisTrendsRepository struct {
+	tracer trace.Tracer
+	cli    *redis.Client
+}
+
+func NewRedisTrendsRepository(tracer trace.Tracer) *RedisTrendsRepository {
+	return &RedisTrendsRepository{
+		tracer: tracer,
+		cli:    newRedisClient(redisTimeout()),
+	}
+}
+
+func (r *RedisTrendsRepository) IncrementHashtags(ctx context.Context, tags []string, at time.Time) error {
+	_, span := r.tracer.Start(ctx, "RedisTrendsRepository.IncrementHashtags")
+	defer span.End()
+
+	pipe := r.cli.Pipeline()
+	for granularity, retention := range trendsRetention {
+		key := trendsKey(granularity, at.Truncate(granularity))
+		for _, tag := range tags {
+			pipe.ZIncrBy(key, 1, tag)
+		}
+		pipe.Expire(key, retention)
+	}
+
+	_, err := pipe.Exec()
+	return err
+}
+
+// Most used hashtags in buckets from..to, both included
+func (r *RedisTrendsRepository) TopHashtags(ctx context.Context, granularity time.Duration, from time.Time, to time.Time, limit int) ([]model.HashtagCount, error) {
+	_, span := r.tracer.Start(ctx, "RedisTrendsRepository.TopHashtags")
+	defer span.End()
+
+	key, err := r.union(granularity, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	scores, err := r.cli.ZRevRangeWithScores(key, 0, int64(limit-1)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make([]model.HashtagCount, 0, len(scores))
+	for _, score := range scores {
+		counts = append(counts, model.HashtagCount{
+			Tag:   score.Member.(string),
+			Count: int64(score.Score),
+		})
+	}
+
+	return counts, nil
+}
+
+// Uses of given hashtags in buckets from..to, unused hashtags are counted as 0
+func (r *RedisTrendsRepository) CountHashtags(ctx context.Context, granularity time.Duration, from time.Time, to time.Time, tags []string) (map[string]int64, error) {
+	_, span := r.tracer.Start(ctx, "RedisTrendsRepository.CountHashtags")
+	defer span.End()
+
+	counts := make(map[string]int64)
+	if len(tags) == 0 {
+		return counts, nil
+	}
+
+	key, err := r.union(granularity, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	pipe := r.cli.Pipeline()
+	results := make([]*redis.FloatCmd, len(tags))
+	for i, tag := range tags {
+		results[i] = pipe.ZScore(key, tag)
+	}
+	_, err = pipe.Exec()
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	for i, tag := range tags {
+		score, err := results[i].Result()
+		if err == nil {
+			counts[tag] = int64(score)
+		}
+	}
+
+	return counts, nil
+}
+
+// Sums buckets into a short lived set, missing buckets count as empty
+func (r *RedisTrendsRepository) union(granularity time.Duration, from time.Time, to time.Time) (string, error) {
+	if _, ok := trendsRetention[granularity]; !ok {
+		return "", fmt.Errorf("unsupported trends granularity %s", granularity)
+	}
+
+	from = from.Truncate(granularity)
+	to = to.Truncate(granularity)
+	key := fmt.Sprintf("trends-union:%d:%d:%d", int64(granularity/time.Second), from.Unix(), to.Unix())
+
+	exists, err := r.cli.Exists(key).Result()
+	if err != nil {
+		return "", err
+	}
+	if exists == 1 {
+		return key, nil
+	}
+
+	var keys []string
+	for bucket := from; !bucket.After(to); bucket = bucket.Add(granularity) {
+		keys = append(keys, trendsKey(granularity, bucket))
+	}
+	if len(keys) == 0 {
+		return key, nil
+	}
+
+	pipe := r.cli.TxPipeline()
+	pipe.ZUnionStore(key, redis.ZStore{}, keys...)
+	pipe.Expire(key, trendsUnionTtl)
+	_, err = pipe.Exec()
+
+	return key, err
+}
+
+func trendsKey(granularity time.Duration, bucket time.Time) string {
+	return fmt.Sprintf("trends:%d:%d", int64(granularity/time.Second), bucket.Unix())
+}
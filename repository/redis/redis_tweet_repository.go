@@ -2,70 +2,167 @@ package redis
 
 import (
 	"context"
+	"errors"
+	"expvar"
 	"fmt"
 	"github.com/go-redis/redis"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
 	"os"
+	"sync/atomic"
 	"time"
+	"tweet/config"
+)
+
+var (
+	ErrCacheBypassed = errors.New("image cache bypassed")
+
+	imageCacheMetrics = expvar.NewMap("image_cache")
 )
 
 type RedisTweetRepository struct {
 	tracer trace.Tracer
 	cli    *redis.Client
+	local  *lruCache
+	// ttl is refreshed on every hit
+	ttl time.Duration
+	// images bigger than maxSize bytes are not cached
+	maxSize int
+	// redis is not called while down, for retryAfter after last failure
+	retryAfter  time.Duration
+	unavailable int64
 }
 
 func NewRedisTweetRepository(tracer trace.Tracer) *RedisTweetRepository {
+	ttl := config.GetDuration("IMAGE_CACHE_TTL", 30*time.Second)
+
+	var local *lruCache
+	if size := config.GetInt("IMAGE_CACHE_LOCAL_SIZE", 0); size > 0 {
+		local = newLRUCache(size, ttl)
+	}
+
+	return &RedisTweetRepository{
+		cli:        newRedisClient(redisTimeout()),
+		tracer:     tracer,
+		local:      local,
+		ttl:        ttl,
+		maxSize:    config.GetInt("IMAGE_CACHE_MAX_SIZE", 1<<20),
+		retryAfter: config.GetDuration("IMAGE_CACHE_RETRY_AFTER", 10*time.Second),
+	}
+}
+
+// Timeout of cache calls, kept short so a slow redis doesn't slow down requests
+func redisTimeout() time.Duration {
+	return config.GetDuration("REDIS_TIMEOUT", 200*time.Millisecond)
+}
+
+func newRedisClient(timeout time.Duration) *redis.Client {
 	redisHost := os.Getenv("REDIS_HOST")
 	redisPort := os.Getenv("REDIS_PORT")
 	redisAddress := fmt.Sprintf("%s:%s", redisHost, redisPort)
 
-	client := redis.NewClient(&redis.Options{
-		Addr: redisAddress,
+	return redis.NewClient(&redis.Options{
+		Addr:         redisAddress,
+		DialTimeout:  timeout,
+		ReadTimeout:  timeout,
+		WriteTimeout: timeout,
 	})
-
-	return &RedisTweetRepository{
-		cli:    client,
-		tracer: tracer,
-	}
 }
 
-func (r *RedisTweetRepository) Post(ctx context.Context, imageId string, image []byte) error {
+func (r *RedisTweetRepository) Post(ctx context.Context, hash string, image []byte) error {
 	_, span := r.tracer.Start(ctx, "RedisTweetRepository.Post")
 	defer span.End()
 
-	err := r.cli.Set(constructKey(imageId), image, 30*time.Second).Err()
+	if len(image) > r.maxSize {
+		imageCacheMetrics.Add("too_large", 1)
+		return nil
+	}
+
+	if r.local != nil {
+		r.local.Set(hash, image)
+	}
+
+	if !r.available() {
+		return ErrCacheBypassed
+	}
+
+	err := r.cli.Set(constructKey(hash), image, r.ttl).Err()
+	r.checkFailure(err)
 
 	return err
 }
 
-func (r *RedisTweetRepository) Get(ctx context.Context, imageId string) ([]byte, error) {
+func (r *RedisTweetRepository) Get(ctx context.Context, hash string) ([]byte, error) {
 	_, span := r.tracer.Start(ctx, "RedisTweetRepository.Get")
 	defer span.End()
 
-	value, err := r.cli.Get(constructKey(imageId)).Bytes()
+	if r.local != nil {
+		if value, ok := r.local.Get(hash); ok {
+			imageCacheMetrics.Add("local_hits", 1)
+			span.SetAttributes(attribute.String("cache", "local"))
+			return value, nil
+		}
+	}
+
+	if !r.available() {
+		imageCacheMetrics.Add("bypassed", 1)
+		return nil, ErrCacheBypassed
+	}
+
+	value, err := r.cli.Get(constructKey(hash)).Bytes()
 	if err != nil {
+		r.checkFailure(err)
+		imageCacheMetrics.Add("misses", 1)
 		return nil, err
 	}
 
+	imageCacheMetrics.Add("hits", 1)
+	span.SetAttributes(attribute.String("cache", "redis"))
+
+	// sliding expiration, popular images stay cached
+	r.cli.Expire(constructKey(hash), r.ttl)
+	if r.local != nil {
+		r.local.Set(hash, value)
+	}
+
 	return value, nil
 }
 
-func (r *RedisTweetRepository) Exists(ctx context.Context, imageId string) bool {
+func (r *RedisTweetRepository) Exists(ctx context.Context, hash string) bool {
 	_, span := r.tracer.Start(ctx, "RedisTweetRepository.Exists")
 	defer span.End()
 
-	cnt, err := r.cli.Exists(constructKey(imageId)).Result()
+	if !r.available() {
+		return false
+	}
+
+	cnt, err := r.cli.Exists(constructKey(hash)).Result()
 	if err != nil {
+		r.checkFailure(err)
 		return false
 	}
 	return cnt == 1
 }
 
+func (r *RedisTweetRepository) available() bool {
+	return time.Now().UnixNano() >= atomic.LoadInt64(&r.unavailable)
+}
+
+// Missing key is not a failure, anything else means redis can't be reached
+func (r *RedisTweetRepository) checkFailure(err error) {
+	if err == nil || err == redis.Nil {
+		return
+	}
+
+	imageCacheMetrics.Add("errors", 1)
+	atomic.StoreInt64(&r.unavailable, time.Now().Add(r.retryAfter).UnixNano())
+}
+
 const (
 	cacheImage = "images:%s"
-	cacheAll   = "images"
 )
 
-func constructKey(id string) string {
-	return fmt.Sprintf(cacheImage, id)
+// Images are cached by content hash so copies of the same image share a cache entry
+func constructKey(hash string) string {
+	return fmt.Sprintf(cacheImage, hash)
 }
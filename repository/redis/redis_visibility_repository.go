@@ -0,0 +1,161 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-redis/redis"
+	"go.opentelemetry.io/otel/trace"
+	"time"
+	"tweet/config"
+)
+
+// Caches social graph visibility per viewer and target user
+type RedisVisibilityRepository struct {
+	tracer trace.Tracer
+	cli    *redis.Client
+	ttl    time.Duration
+	// stale copies outlive ttl, they are served only while social graph is down
+	staleTtl time.Duration
+}
+
+func NewRedisVisibilityRepository(tracer trace.Tracer) *RedisVisibilityRepository {
+	return &RedisVisibilityRepository{
+		tracer:   tracer,
+		cli:      newRedisClient(redisTimeout()),
+		ttl:      config.GetDuration("VISIBILITY_CACHE_TTL", 30*time.Second),
+		staleTtl: config.GetDuration("VISIBILITY_STALE_TTL", 24*time.Hour),
+	}
+}
+
+// Returns cached visibility, targets that are not cached are missing from the result
+func (r *RedisVisibilityRepository) GetVisibility(ctx context.Context, viewer string, targets []string) (map[string]bool, error) {
+	_, span := r.tracer.Start(ctx, "RedisVisibilityRepository.GetVisibility")
+	defer span.End()
+
+	return r.get(viewer, targets, visibilityKey)
+}
+
+// Returns last known visibility, even if it is older than cache ttl
+func (r *RedisVisibilityRepository) GetStaleVisibility(ctx context.Context, viewer string, targets []string) (map[string]bool, error) {
+	_, span := r.tracer.Start(ctx, "RedisVisibilityRepository.GetStaleVisibility")
+	defer span.End()
+
+	return r.get(viewer, targets, staleVisibilityKey)
+}
+
+func (r *RedisVisibilityRepository) get(viewer string, targets []string, key func(string, string) string) (map[string]bool, error) {
+	visibility := make(map[string]bool)
+	if len(targets) == 0 {
+		return visibility, nil
+	}
+
+	keys := make([]string, len(targets))
+	for i, target := range targets {
+		keys[i] = key(viewer, target)
+	}
+
+	values, err := r.cli.MGet(keys...).Result()
+	if err != nil {
+		return visibility, err
+	}
+
+	for i, value := range values {
+		if value == nil {
+			continue
+		}
+		visibility[targets[i]] = value.(string) == "1"
+	}
+
+	return visibility, nil
+}
+
+func (r *RedisVisibilityRepository) SaveVisibility(ctx context.Context, viewer string, visibility map[string]bool) error {
+	_, span := r.tracer.Start(ctx, "RedisVisibilityRepository.SaveVisibility")
+	defer span.End()
+
+	pipe := r.cli.Pipeline()
+	for target, visible := range visibility {
+		value := "0"
+		if visible {
+			value = "1"
+		}
+
+		pipe.Set(visibilityKey(viewer, target), value, r.ttl)
+		pipe.Set(staleVisibilityKey(viewer, target), value, r.staleTtl)
+		// indexes used for invalidation
+		pipe.SAdd(viewerIndexKey(viewer), target)
+		pipe.Expire(viewerIndexKey(viewer), r.staleTtl)
+		pipe.SAdd(targetIndexKey(target), viewer)
+		pipe.Expire(targetIndexKey(target), r.staleTtl)
+	}
+
+	_, err := pipe.Exec()
+
+	return err
+}
+
+func (r *RedisVisibilityRepository) Invalidate(ctx context.Context, viewer string, target string) error {
+	_, span := r.tracer.Start(ctx, "RedisVisibilityRepository.Invalidate")
+	defer span.End()
+
+	return r.cli.Del(visibilityKey(viewer, target), staleVisibilityKey(viewer, target)).Err()
+}
+
+// Used when viewer follows or unfollows someone
+func (r *RedisVisibilityRepository) InvalidateViewer(ctx context.Context, viewer string) error {
+	_, span := r.tracer.Start(ctx, "RedisVisibilityRepository.InvalidateViewer")
+	defer span.End()
+
+	targets, err := r.cli.SMembers(viewerIndexKey(viewer)).Result()
+	if err != nil {
+		return err
+	}
+
+	keys := []string{viewerIndexKey(viewer)}
+	for _, target := range targets {
+		keys = append(keys, visibilityKey(viewer, target), staleVisibilityKey(viewer, target))
+	}
+
+	return r.cli.Del(keys...).Err()
+}
+
+// Used when target changes privacy
+func (r *RedisVisibilityRepository) InvalidateTarget(ctx context.Context, target string) error {
+	_, span := r.tracer.Start(ctx, "RedisVisibilityRepository.InvalidateTarget")
+	defer span.End()
+
+	viewers, err := r.cli.SMembers(targetIndexKey(target)).Result()
+	if err != nil {
+		return err
+	}
+
+	keys := []string{targetIndexKey(target)}
+	for _, viewer := range viewers {
+		keys = append(keys, visibilityKey(viewer, target), staleVisibilityKey(viewer, target))
+	}
+
+	return r.cli.Del(keys...).Err()
+}
+
+const (
+	cacheVisibility      = "visibility:%s:%s"
+	cacheStaleVisibility = "visibility-stale:%s:%s"
+	cacheViewer          = "visibility-viewer:%s"
+	cacheTarget          = "visibility-target:%s"
+)
+
+func visibilityKey(viewer string, target string) string {
+	return fmt.Sprintf(cacheVisibility, viewer, target)
+}
+
+func staleVisibilityKey(viewer string, target string) string {
+	return fmt.Sprintf(cacheStaleVisibility, viewer, target)
+}
+
+func viewerIndexKey(viewer string) string {
+	return fmt.Sprintf(cacheViewer, viewer)
+}
+
+func targetIndexKey(target string) string {
+	return fmt.Sprintf(cacheTarget, target)
+}
@@ -5,7 +5,7 @@ import (
 )
 
 type RedisRepository interface {
-	Post(ctx context.Context, imageId string, image []byte) error
-	Get(ctx context.Context, imageId string) ([]byte, error)
-	Exists(ctx context.Context, imageId string) bool
+	Post(ctx context.Context, hash string, image []byte) error
+	Get(ctx context.Context, hash string) ([]byte, error)
+	Exists(ctx context.Context, hash string) bool
 }
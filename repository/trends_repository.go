@@ -0,0 +1,14 @@
+package repository
+
+import (
+	"context"
+	"time"
+	"tweet/model"
+)
+
+// Rolling hashtag counts, kept in buckets of a few fixed granularities
+type TrendsRepository interface {
+	IncrementHashtags(ctx context.Context, tags []string, at time.Time) error
+	TopHashtags(ctx context.Context, granularity time.Duration, from time.Time, to time.Time, limit int) ([]model.HashtagCount, error)
+	CountHashtags(ctx context.Context, granularity time.Duration, from time.Time, to time.Time, tags []string) (map[string]int64, error)
+}
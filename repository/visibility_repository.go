@@ -0,0 +1,12 @@
+package repository
+
+import "context"
+
+type VisibilityRepository interface {
+	GetVisibility(ctx context.Context, viewer string, targets []string) (map[string]bool, error)
+	GetStaleVisibility(ctx context.Context, viewer string, targets []string) (map[string]bool, error)
+	SaveVisibility(ctx context.Context, viewer string, visibility map[string]bool) error
+	Invalidate(ctx context.Context, viewer string, target string) error
+	InvalidateViewer(ctx context.Context, viewer string) error
+	InvalidateTarget(ctx context.Context, target string) error
+}
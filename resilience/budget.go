@@ -0,0 +1,42 @@
+package resilience
+
+import "sync"
+
+// Limits retries to a share of regular traffic, so retries can't multiply load on a failing service.
+// Every call deposits ratio tokens and every retry or hedge withdraws one.
+type RetryBudget struct {
+	mu     sync.Mutex
+	tokens float64
+	ratio  float64
+	max    float64
+}
+
+func NewRetryBudget(ratio float64, max float64) *RetryBudget {
+	return &RetryBudget{
+		tokens: max,
+		ratio:  ratio,
+		max:    max,
+	}
+}
+
+func (b *RetryBudget) Deposit() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.tokens += b.ratio
+	if b.tokens > b.max {
+		b.tokens = b.max
+	}
+}
+
+func (b *RetryBudget) TryWithdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.tokens < 1 {
+		return false
+	}
+
+	b.tokens--
+	return true
+}
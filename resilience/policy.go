@@ -0,0 +1,190 @@
+package resilience
+
+import (
+	"context"
+	"expvar"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"math/rand"
+	"time"
+	"tweet/config"
+)
+
+var resilienceMetrics = expvar.NewMap("grpc_resilience")
+
+// How a single gRPC method is called
+type Policy struct {
+	// Timeout of a single attempt
+	Timeout time.Duration
+	// Attempts including the first one, only idempotent methods should have more than one
+	MaxAttempts    int
+	BaseBackoff    time.Duration
+	MaxBackoff     time.Duration
+	RetryableCodes []codes.Code
+	// Second request is sent if first didn't answer in HedgeDelay, zero disables hedging
+	HedgeDelay time.Duration
+}
+
+// Policies by full gRPC method name, methods without a policy use the default one
+type Policies struct {
+	policies      map[string]Policy
+	defaultPolicy Policy
+	budget        *RetryBudget
+}
+
+func NewPolicies() *Policies {
+	timeout := config.GetDuration("GRPC_CALL_TIMEOUT", 2*time.Second)
+
+	read := Policy{
+		Timeout:        timeout,
+		MaxAttempts:    config.GetInt("GRPC_MAX_ATTEMPTS", 3),
+		BaseBackoff:    config.GetDuration("GRPC_BASE_BACKOFF", 50*time.Millisecond),
+		MaxBackoff:     config.GetDuration("GRPC_MAX_RETRY_BACKOFF", time.Second),
+		RetryableCodes: []codes.Code{codes.Unavailable, codes.DeadlineExceeded, codes.Aborted, codes.ResourceExhausted},
+	}
+
+	checkVisibility := read
+	checkVisibility.HedgeDelay = config.GetDuration("VISIBILITY_HEDGE_DELAY", 0)
+
+	return &Policies{
+		policies: map[string]Policy{
+			"/social_graph.SocialGraphService/CheckVisibility":    checkVisibility,
+			"/social_graph.SocialGraphService/GetMyFollowers":     read,
+			"/social_graph.SocialGraphService/GetTargetGroupUser": read,
+		},
+		defaultPolicy: Policy{
+			Timeout:     timeout,
+			MaxAttempts: 1,
+		},
+		budget: NewRetryBudget(
+			float64(config.GetInt("GRPC_RETRY_BUDGET_PERCENT", 20))/100,
+			float64(config.GetInt("GRPC_RETRY_BUDGET_MAX", 10)),
+		),
+	}
+}
+
+func (p *Policies) policy(method string) Policy {
+	if policy, ok := p.policies[method]; ok {
+		return policy
+	}
+	return p.defaultPolicy
+}
+
+// Applies timeouts, retries and hedging to every unary call of a client connection
+func (p *Policies) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		policy := p.policy(method)
+		p.budget.Deposit()
+
+		attempts := policy.MaxAttempts
+		if attempts < 1 {
+			attempts = 1
+		}
+
+		var err error
+		for attempt := 0; attempt < attempts; attempt++ {
+			if attempt > 0 {
+				if !p.budget.TryWithdraw() {
+					resilienceMetrics.Add("budget_exhausted", 1)
+					return err
+				}
+
+				resilienceMetrics.Add("retries", 1)
+				select {
+				case <-time.After(backoff(policy, attempt)):
+				case <-ctx.Done():
+					return err
+				}
+			}
+
+			if policy.HedgeDelay > 0 {
+				err = p.hedgedCall(ctx, policy, method, req, reply, cc, invoker, opts...)
+			} else {
+				err = call(ctx, policy, method, req, reply, cc, invoker, opts...)
+			}
+
+			if err == nil || !retryable(policy, err) || ctx.Err() != nil {
+				return err
+			}
+		}
+
+		return err
+	}
+}
+
+func call(ctx context.Context, policy Policy, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	attemptCtx, cancel := context.WithTimeout(ctx, policy.Timeout)
+	defer cancel()
+
+	return invoker(attemptCtx, method, req, reply, cc, opts...)
+}
+
+// Sends a second request when the first one is slow and returns whichever answers first.
+// Each request gets its own reply, the winning one is copied into reply.
+func (p *Policies) hedgedCall(ctx context.Context, policy Policy, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	hedgeCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		reply interface{}
+		err   error
+	}
+
+	results := make(chan result, 2)
+	send := func() {
+		r := newReply(reply)
+		err := call(hedgeCtx, policy, method, req, r, cc, invoker, opts...)
+		results <- result{r, err}
+	}
+
+	go send()
+	inFlight := 1
+
+	timer := time.NewTimer(policy.HedgeDelay)
+	defer timer.Stop()
+
+	var err error
+	for inFlight > 0 {
+		select {
+		case <-timer.C:
+			if inFlight == 1 && p.budget.TryWithdraw() {
+				resilienceMetrics.Add("hedges", 1)
+				go send()
+				inFlight++
+			}
+		case r := <-results:
+			inFlight--
+			if r.err == nil {
+				copyReply(reply, r.reply)
+				return nil
+			}
+			err = r.err
+		}
+	}
+
+	return err
+}
+
+func retryable(policy Policy, err error) bool {
+	code := status.Code(err)
+	for _, retryableCode := range policy.RetryableCodes {
+		if code == retryableCode {
+			return true
+		}
+	}
+	return false
+}
+
+// Exponential backoff with full jitter
+func backoff(policy Policy, attempt int) time.Duration {
+	max := policy.BaseBackoff << (attempt - 1)
+	if max > policy.MaxBackoff || max <= 0 {
+		max = policy.MaxBackoff
+	}
+	if max <= 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(int64(max)))
+}
@@ -0,0 +1,25 @@
+package resilience
+
+import "google.golang.org/protobuf/proto"
+
+// Hedged requests can't share a reply, generated replies are proto messages so they can be cloned
+func newReply(reply interface{}) interface{} {
+	if message, ok := reply.(proto.Message); ok {
+		return message.ProtoReflect().New().Interface()
+	}
+	return reply
+}
+
+func copyReply(dst interface{}, src interface{}) {
+	if dst == src {
+		return
+	}
+
+	dstMessage, ok := dst.(proto.Message)
+	if !ok {
+		return
+	}
+
+	proto.Reset(dstMessage)
+	proto.Merge(dstMessage, src.(proto.Message))
+}
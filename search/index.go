@@ -0,0 +1,194 @@
+package search
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/analysis/analyzer/custom"
+	"github.com/blevesearch/bleve/v2/analysis/analyzer/keyword"
+	"github.com/blevesearch/bleve/v2/analysis/token/lowercase"
+	"github.com/blevesearch/bleve/v2/analysis/tokenizer/unicode"
+	"github.com/blevesearch/bleve/v2/mapping"
+	"os"
+	"time"
+)
+
+const textAnalyzer = "tweet_text"
+
+// Newest tweets first, id breaks ties so cursor never skips or repeats a tweet
+var sortOrder = []string{"-timestamp", "-_id"}
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Indexed part of a tweet, tweet itself is read from the database
+type Document struct {
+	ID        string    `json:"id"`
+	PostedBy  string    `json:"postedBy"`
+	Text      string    `json:"text"`
+	Hashtags  []string  `json:"hashtags"`
+	HasImage  bool      `json:"hasImage"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Embedded full-text index of tweets
+type Index struct {
+	index bleve.Index
+}
+
+// Location of index, SEARCH_INDEX or search.bleve in working directory
+func IndexPath() string {
+	if path := os.Getenv("SEARCH_INDEX"); len(path) > 0 {
+		return path
+	}
+	return "search.bleve"
+}
+
+// Opens index at path, new index is created if there is none
+func Open(path string) (*Index, error) {
+	index, err := bleve.Open(path)
+	if err == bleve.ErrorIndexPathDoesNotExist {
+		index, err = bleve.New(path, newMapping())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Index{
+		index: index,
+	}, nil
+}
+
+// Creates empty index at path, previous index at path is removed
+func Create(path string) (*Index, error) {
+	if err := os.RemoveAll(path); err != nil {
+		return nil, err
+	}
+
+	index, err := bleve.New(path, newMapping())
+	if err != nil {
+		return nil, err
+	}
+
+	return &Index{
+		index: index,
+	}, nil
+}
+
+func newMapping() mapping.IndexMapping {
+	indexMapping := bleve.NewIndexMapping()
+
+	// text is split on unicode word boundaries and lower cased, stop words are kept for phrases
+	err := indexMapping.AddCustomAnalyzer(textAnalyzer, map[string]interface{}{
+		"type":          custom.Name,
+		"tokenizer":     unicode.Name,
+		"token_filters": []string{lowercase.Name},
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	keywordField := bleve.NewTextFieldMapping()
+	keywordField.Analyzer = keyword.Name
+
+	textField := bleve.NewTextFieldMapping()
+	textField.Analyzer = textAnalyzer
+	textField.IncludeTermVectors = true
+
+	document := bleve.NewDocumentStaticMapping()
+	document.AddFieldMappingsAt("postedBy", keywordField)
+	document.AddFieldMappingsAt("text", textField)
+	document.AddFieldMappingsAt("hashtags", keywordField)
+	document.AddFieldMappingsAt("hasImage", bleve.NewBooleanFieldMapping())
+	document.AddFieldMappingsAt("timestamp", bleve.NewDateTimeFieldMapping())
+
+	indexMapping.DefaultMapping = document
+	indexMapping.DefaultAnalyzer = textAnalyzer
+
+	return indexMapping
+}
+
+func (i *Index) Add(document Document) error {
+	return i.index.Index(document.ID, document)
+}
+
+// Adds documents in batches of batchSize
+func (i *Index) AddAll(documents <-chan Document, batchSize int) (int, error) {
+	count := 0
+	batch := i.index.NewBatch()
+	for document := range documents {
+		if err := batch.Index(document.ID, document); err != nil {
+			return count, err
+		}
+
+		if batch.Size() >= batchSize {
+			if err := i.index.Batch(batch); err != nil {
+				return count, err
+			}
+			count += batch.Size()
+			batch.Reset()
+		}
+	}
+
+	count += batch.Size()
+	return count, i.index.Batch(batch)
+}
+
+func (i *Index) Delete(id string) error {
+	return i.index.Delete(id)
+}
+
+// Returns ids of matching tweets, newest first, and cursor of the next page.
+// Cursor is empty when there are no more results.
+func (i *Index) Search(query Query, cursor string, size int) ([]string, string, error) {
+	request := bleve.NewSearchRequestOptions(query.bleveQuery(), size, 0, false)
+	request.SortBy(sortOrder)
+
+	if len(cursor) > 0 {
+		after, err := decodeCursor(cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		request.SetSearchAfter(after)
+	}
+
+	result, err := i.index.Search(request)
+	if err != nil {
+		return nil, "", err
+	}
+
+	ids := make([]string, 0, len(result.Hits))
+	for _, hit := range result.Hits {
+		ids = append(ids, hit.ID)
+	}
+
+	next := ""
+	if len(result.Hits) == size {
+		next = encodeCursor(result.Hits[len(result.Hits)-1].Sort)
+	}
+
+	return ids, next, nil
+}
+
+func (i *Index) Close() error {
+	return i.index.Close()
+}
+
+func encodeCursor(sort []string) string {
+	encoded, _ := json.Marshal(sort)
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+func decodeCursor(cursor string) ([]string, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var sort []string
+	if err = json.Unmarshal(decoded, &sort); err != nil || len(sort) != len(sortOrder) {
+		return nil, ErrInvalidCursor
+	}
+
+	return sort, nil
+}
@@ -0,0 +1,124 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gocql/gocql"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"log"
+	"tweet/entities"
+	"tweet/events"
+	"tweet/model"
+)
+
+// Keeps index in sync with created, edited and deleted tweets it receives from the event bus,
+// so index of every replica gets tweets posted on any of them. Events missed while the replica
+// was down are only recovered by reindex. Ads and retweets are not indexed, search finds original tweets only.
+type Indexer struct {
+	index  *Index
+	tracer trace.Tracer
+}
+
+func NewIndexer(index *Index, tracer trace.Tracer) *Indexer {
+	return &Indexer{
+		index:  index,
+		tracer: tracer,
+	}
+}
+
+// Subscribed to the event bus, failures are logged since the bus doesn't redeliver
+func (i *Indexer) Handle(ctx context.Context, event events.Event) {
+	if err := i.handle(ctx, event); err != nil {
+		log.Printf("Indexing %s event %s failed: %v", event.Type, event.ID, err)
+	}
+}
+
+func (i *Indexer) handle(ctx context.Context, event events.Event) error {
+	var err error
+
+	switch event.Type {
+	case events.TweetCreated:
+		var data events.TweetCreatedData
+		if err = json.Unmarshal(event.Data, &data); err != nil || data.Ad || data.Retweet {
+			return err
+		}
+
+		_, span := i.tracer.Start(ctx, "Indexer.Add")
+		defer span.End()
+
+		var id gocql.UUID
+		if id, err = gocql.ParseUUID(data.TweetId); err != nil {
+			return err
+		}
+
+		err = i.index.Add(Document{
+			ID:        data.TweetId,
+			PostedBy:  data.PostedBy,
+			Text:      data.Text,
+			Hashtags:  entities.Hashtags(entities.Parse(data.Text)),
+			HasImage:  len(data.MediaIds) > 0,
+			Timestamp: id.Time(),
+		})
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+		}
+	case events.TweetEdited:
+		var data events.TweetEditedData
+		if err = json.Unmarshal(event.Data, &data); err != nil || data.Ad {
+			return err
+		}
+
+		_, span := i.tracer.Start(ctx, "Indexer.Update")
+		defer span.End()
+
+		var id gocql.UUID
+		if id, err = gocql.ParseUUID(data.TweetId); err != nil {
+			return err
+		}
+
+		// document with the same id is replaced
+		err = i.index.Add(Document{
+			ID:        data.TweetId,
+			PostedBy:  data.PostedBy,
+			Text:      data.Text,
+			Hashtags:  entities.Hashtags(entities.Parse(data.Text)),
+			HasImage:  len(data.MediaIds) > 0,
+			Timestamp: id.Time(),
+		})
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+		}
+	case events.TweetDeleted:
+		var data events.TweetDeletedData
+		if err = json.Unmarshal(event.Data, &data); err != nil {
+			return err
+		}
+
+		_, span := i.tracer.Start(ctx, "Indexer.Delete")
+		defer span.End()
+
+		err = i.index.Delete(data.TweetId)
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+		}
+	}
+
+	return err
+}
+
+// Indexed tweet, nil for tweets that are not indexed
+func DocumentOf(tweet *model.Tweet) *Document {
+	if tweet.Ad || tweet.Retweet {
+		return nil
+	}
+
+	return &Document{
+		ID:        tweet.ID.String(),
+		PostedBy:  tweet.PostedBy,
+		Text:      tweet.Text,
+		Hashtags:  entities.Hashtags(entities.Parse(tweet.Text)),
+		HasImage:  len(tweet.Media) > 0,
+		Timestamp: tweet.ID.Time(),
+	}
+}
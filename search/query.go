@@ -0,0 +1,165 @@
+package search
+
+import (
+	"fmt"
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/search/query"
+	"strings"
+	"time"
+	"tweet/entities"
+)
+
+const dateLayout = "2006-01-02"
+
+// Parsed search query, all conditions have to match
+type Query struct {
+	Terms    []string
+	Phrases  []string
+	From     string
+	Hashtags []string
+	Since    *time.Time
+	Until    *time.Time //exclusive
+	HasImage bool
+}
+
+// Parses words, "quoted phrases", #hashtags and from:, since:, until: and has:image operators.
+// Dates are in YYYY-MM-DD format and in UTC.
+func ParseQuery(text string) (Query, error) {
+	var q Query
+
+	for _, token := range tokenize(text) {
+		if token.phrase {
+			if len(strings.TrimSpace(token.text)) > 0 {
+				q.Phrases = append(q.Phrases, token.text)
+			}
+			continue
+		}
+
+		word := token.text
+		lower := strings.ToLower(word)
+		switch {
+		case strings.HasPrefix(lower, "from:"):
+			q.From = strings.TrimPrefix(strings.TrimSpace(word[len("from:"):]), "@")
+			if len(q.From) == 0 {
+				return q, fmt.Errorf("from: needs a username")
+			}
+		case strings.HasPrefix(lower, "since:"):
+			since, err := time.Parse(dateLayout, word[len("since:"):])
+			if err != nil {
+				return q, fmt.Errorf("since: needs a date in YYYY-MM-DD format")
+			}
+			q.Since = &since
+		case strings.HasPrefix(lower, "until:"):
+			until, err := time.Parse(dateLayout, word[len("until:"):])
+			if err != nil {
+				return q, fmt.Errorf("until: needs a date in YYYY-MM-DD format")
+			}
+			q.Until = &until
+		case strings.HasPrefix(lower, "has:"):
+			if lower != "has:image" {
+				return q, fmt.Errorf("only has:image is supported")
+			}
+			q.HasImage = true
+		case strings.HasPrefix(word, "#") && entities.ValidHashtag(word):
+			q.Hashtags = append(q.Hashtags, entities.NormalizeHashtag(word))
+		default:
+			q.Terms = append(q.Terms, word)
+		}
+	}
+
+	if q.empty() {
+		return q, fmt.Errorf("query is empty")
+	}
+
+	return q, nil
+}
+
+func (q Query) empty() bool {
+	return len(q.Terms) == 0 && len(q.Phrases) == 0 && len(q.From) == 0 && len(q.Hashtags) == 0 &&
+		q.Since == nil && q.Until == nil && !q.HasImage
+}
+
+func (q Query) bleveQuery() query.Query {
+	var conjuncts []query.Query
+
+	if len(q.Terms) > 0 {
+		match := bleve.NewMatchQuery(strings.Join(q.Terms, " "))
+		match.SetField("text")
+		match.SetOperator(query.MatchQueryOperatorAnd)
+		conjuncts = append(conjuncts, match)
+	}
+
+	for _, phrase := range q.Phrases {
+		match := bleve.NewMatchPhraseQuery(phrase)
+		match.SetField("text")
+		conjuncts = append(conjuncts, match)
+	}
+
+	if len(q.From) > 0 {
+		term := bleve.NewTermQuery(q.From)
+		term.SetField("postedBy")
+		conjuncts = append(conjuncts, term)
+	}
+
+	for _, hashtag := range q.Hashtags {
+		term := bleve.NewTermQuery(hashtag)
+		term.SetField("hashtags")
+		conjuncts = append(conjuncts, term)
+	}
+
+	if q.Since != nil || q.Until != nil {
+		var since, until time.Time
+		if q.Since != nil {
+			since = *q.Since
+		}
+		if q.Until != nil {
+			until = *q.Until
+		}
+		inclusive, exclusive := true, false
+		dates := bleve.NewDateRangeInclusiveQuery(since, until, &inclusive, &exclusive)
+		dates.SetField("timestamp")
+		conjuncts = append(conjuncts, dates)
+	}
+
+	if q.HasImage {
+		hasImage := bleve.NewBoolFieldQuery(true)
+		hasImage.SetField("hasImage")
+		conjuncts = append(conjuncts, hasImage)
+	}
+
+	return bleve.NewConjunctionQuery(conjuncts...)
+}
+
+type token struct {
+	text   string
+	phrase bool
+}
+
+// Splits on white space, text in double quotes is one token, unterminated quote runs to the end
+func tokenize(text string) []token {
+	var tokens []token
+	runes := []rune(text)
+
+	for i := 0; i < len(runes); {
+		switch {
+		case runes[i] == ' ' || runes[i] == '\t' || runes[i] == '\n':
+			i++
+		case runes[i] == '"':
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+			tokens = append(tokens, token{text: string(runes[i+1 : end]), phrase: true})
+			i = end + 1
+		default:
+			end := i
+			for end < len(runes) && runes[end] != ' ' && runes[end] != '\t' && runes[end] != '\n' && runes[end] != '"' {
+				end++
+			}
+			tokens = append(tokens, token{text: string(runes[i:end])})
+			i = end
+		}
+	}
+
+	return tokens
+}
@@ -0,0 +1,310 @@
+package service
+
+import (
+	"context"
+	"expvar"
+	"github.com/FTN-TwitterClone/grpc-stubs/proto/ads"
+	"github.com/gocql/gocql"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"hash/fnv"
+	"log"
+	"math/rand"
+	"strconv"
+	"time"
+	"tweet/app_errors"
+	"tweet/config"
+	"tweet/model"
+	"tweet/repository"
+	"tweet/service/circuit_breaker"
+)
+
+// Number of outbox partitions, changing it reorders events of tweets that are still in the outbox
+const adsOutboxShards = 8
+
+const (
+	// events of a shard are split into partitions by time, a delivered partition is deleted whole
+	adsOutboxBucket = time.Minute
+	// event id is taken before its write commits and replica clocks skew, so an event can be written
+	// up to this long after the time in its id. Relay doesn't pass events younger than this,
+	// an older event committed later would be left behind the cursor.
+	adsOutboxGrace = time.Minute
+	// where relay starts in a shard it never relayed before
+	adsOutboxLookback = 24 * time.Hour
+)
+
+const (
+	adInfoEventType  = "SaveAdInfo"
+	likeEventType    = "SaveLikeEvent"
+	unlikeEventType  = "SaveUnlikeEvent"
+	outboxBatchLimit = 100
+)
+
+var adsOutboxMetrics = expvar.NewMap("ads_outbox")
+
+func newAdsEvent(tweetId string, eventType string, message proto.Message) (model.OutboxEvent, error) {
+	payload, err := protojson.Marshal(message)
+	if err != nil {
+		return model.OutboxEvent{}, err
+	}
+
+	eventId := gocql.TimeUUID()
+
+	return model.OutboxEvent{
+		Shard:    outboxShard(tweetId),
+		Bucket:   outboxBucket(eventId.Time()),
+		EventId:  eventId,
+		TweetId:  tweetId,
+		Type:     eventType,
+		Payload:  string(payload),
+		Attempts: 0,
+	}, nil
+}
+
+func outboxShard(tweetId string) int {
+	h := fnv.New32a()
+	h.Write([]byte(tweetId))
+	return int(h.Sum32() % adsOutboxShards)
+}
+
+func outboxBucket(t time.Time) time.Time {
+	return t.Truncate(adsOutboxBucket)
+}
+
+func outboxLease(shard int) string {
+	return "ads-outbox-" + strconv.Itoa(shard)
+}
+
+// Delivers outbox events to ads service at least once, in order per tweet.
+// Each shard is relayed on its own, a failing event holds back the rest of its shard.
+// Replicas take a lease per shard, so a shard is relayed by one replica at a time.
+// Delivered position is kept in a cursor, the replica that takes over a shard continues from it.
+// Events are delivered only after the grace period, so ads service sees them up to that much later.
+type AdsOutboxRelay struct {
+	cassandraRepository repository.CassandraRepository
+	leaseRepository     repository.LeaseRepository
+	adsCB               *circuit_breaker.AdsCircuitBreaker
+	tracer              trace.Tracer
+	holder              string
+	pollInterval        time.Duration
+	maxBackoff          time.Duration
+	leaseTtl            time.Duration
+}
+
+func NewAdsOutboxRelay(cassandraRepository repository.CassandraRepository, leaseRepository repository.LeaseRepository, adsCB *circuit_breaker.AdsCircuitBreaker, tracer trace.Tracer) *AdsOutboxRelay {
+	return &AdsOutboxRelay{
+		cassandraRepository: cassandraRepository,
+		leaseRepository:     leaseRepository,
+		adsCB:               adsCB,
+		tracer:              tracer,
+		holder:              gocql.TimeUUID().String(),
+		pollInterval:        config.GetDuration("ADS_OUTBOX_POLL_INTERVAL", time.Second),
+		maxBackoff:          config.GetDuration("ADS_OUTBOX_MAX_BACKOFF", time.Minute),
+		leaseTtl:            config.GetDuration("ADS_OUTBOX_LEASE_TTL", 15*time.Second),
+	}
+}
+
+func (r *AdsOutboxRelay) Start(ctx context.Context) {
+	for shard := 0; shard < adsOutboxShards; shard++ {
+		go r.relayShard(ctx, shard)
+	}
+}
+
+func (r *AdsOutboxRelay) relayShard(ctx context.Context, shard int) {
+	failures := 0
+	for {
+		wait := r.pollInterval
+		if failures > 0 {
+			wait = r.backoff(failures)
+		}
+
+		select {
+		case <-ctx.Done():
+			// another replica can take over without waiting for the lease to expire
+			if err := r.leaseRepository.ReleaseLease(context.Background(), outboxLease(shard), r.holder); err != nil {
+				log.Printf("Failed to release ads outbox lease of shard %d: %v", shard, err)
+			}
+			return
+		case <-time.After(wait):
+		}
+
+		if r.relayBatch(ctx, shard) {
+			failures = 0
+		} else {
+			failures++
+		}
+	}
+}
+
+// Reports whether every event found was delivered, a shard held by another replica is skipped
+func (r *AdsOutboxRelay) relayBatch(ctx context.Context, shard int) bool {
+	relayCtx, span := r.tracer.Start(ctx, "AdsOutboxRelay.relayBatch")
+	defer span.End()
+
+	if !r.holdLease(relayCtx, shard) {
+		return true
+	}
+
+	// cursor is read on every batch, it may have been moved by the previous holder of the lease
+	cursor, err := r.cassandraRepository.FindOutboxCursor(relayCtx, shard)
+	if err == gocql.ErrNotFound {
+		cursor = model.OutboxCursor{Shard: shard, Bucket: outboxBucket(time.Now().Add(-adsOutboxLookback))}
+	} else if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return false
+	}
+
+	lag := 0.0
+	defer func() {
+		adsOutboxMetrics.Set("lag_seconds_shard_"+strconv.Itoa(shard), expvarFloat(lag))
+	}()
+
+	for ctx.Err() == nil {
+		events, err := r.cassandraRepository.FindOutboxEvents(relayCtx, shard, cursor.Bucket, cursor.EventId, outboxBatchLimit)
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			return false
+		}
+
+		if len(events) > 0 {
+			lag = time.Since(events[0].EventId.Time()).Seconds()
+		}
+
+		for i, event := range events {
+			if time.Since(event.EventId.Time()) < adsOutboxGrace {
+				return true
+			}
+
+			// lease is extended before every event, so a slow batch is not taken over halfway
+			if i > 0 && !r.holdLease(relayCtx, shard) {
+				return true
+			}
+
+			err = r.deliver(relayCtx, event)
+			if err != nil {
+				span.SetStatus(codes.Error, err.Error())
+				adsOutboxMetrics.Add("failed", 1)
+
+				event.Attempts++
+				if updateErr := r.cassandraRepository.UpdateOutboxAttempts(relayCtx, &event); updateErr != nil {
+					log.Printf("Failed to update outbox event %s: %v", event.EventId, updateErr)
+				}
+				return false
+			}
+
+			adsOutboxMetrics.Add("delivered", 1)
+
+			// ads service can see the event again if cursor is not saved, events are delivered at least once
+			eventId := event.EventId
+			cursor.EventId = &eventId
+			err = r.cassandraRepository.SaveOutboxCursor(relayCtx, &cursor)
+			if err != nil {
+				span.SetStatus(codes.Error, err.Error())
+				return false
+			}
+		}
+
+		if len(events) == outboxBatchLimit {
+			return true
+		}
+
+		// bucket is drained, it is left only when no more events can be written into it
+		next := cursor.Bucket.Add(adsOutboxBucket)
+		if time.Now().Before(next.Add(adsOutboxGrace)) {
+			lag = 0
+			return true
+		}
+
+		if err = r.cassandraRepository.DeleteOutboxBucket(relayCtx, shard, cursor.Bucket); err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			return false
+		}
+
+		cursor = model.OutboxCursor{Shard: shard, Bucket: next}
+		if err = r.cassandraRepository.SaveOutboxCursor(relayCtx, &cursor); err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			return false
+		}
+
+		if !r.holdLease(relayCtx, shard) {
+			return true
+		}
+	}
+
+	return true
+}
+
+func (r *AdsOutboxRelay) holdLease(ctx context.Context, shard int) bool {
+	held, err := r.leaseRepository.AcquireLease(ctx, outboxLease(shard), r.holder, r.leaseTtl)
+	if err != nil {
+		trace.SpanFromContext(ctx).SetStatus(codes.Error, err.Error())
+		log.Printf("Failed to acquire ads outbox lease of shard %d: %v", shard, err)
+		return false
+	}
+
+	return held
+}
+
+// Events that can never be delivered are dropped, so they don't hold back the shard.
+// Every dropped event is counted and logged with its payload, so it can be replayed by hand.
+func (r *AdsOutboxRelay) deliver(ctx context.Context, event model.OutboxEvent) error {
+	var appErr error
+	var err error
+
+	switch event.Type {
+	case adInfoEventType:
+		var adInfo ads.AdInfo
+		if err = protojson.Unmarshal([]byte(event.Payload), &adInfo); err == nil {
+			appErr = toError(r.adsCB.SaveAdInfo(ctx, &adInfo))
+		}
+	case likeEventType:
+		var likeEvent ads.LikeEvent
+		if err = protojson.Unmarshal([]byte(event.Payload), &likeEvent); err == nil {
+			appErr = toError(r.adsCB.SaveLikeEvent(ctx, &likeEvent))
+		}
+	case unlikeEventType:
+		var unlikeEvent ads.UnlikeEvent
+		if err = protojson.Unmarshal([]byte(event.Payload), &unlikeEvent); err == nil {
+			appErr = toError(r.adsCB.SaveUnlikeEvent(ctx, &unlikeEvent))
+		}
+	default:
+		adsOutboxMetrics.Add("dropped_unknown_type", 1)
+		log.Printf("Dropping outbox event %s of tweet %s with unknown type %s: %s", event.EventId, event.TweetId, event.Type, event.Payload)
+		return nil
+	}
+
+	if err != nil {
+		trace.SpanFromContext(ctx).RecordError(err)
+		adsOutboxMetrics.Add("dropped_undecodable", 1)
+		log.Printf("Dropping outbox event %s of tweet %s, %s payload can't be decoded: %v: %s", event.EventId, event.TweetId, event.Type, err, event.Payload)
+		return nil
+	}
+
+	return appErr
+}
+
+// Nil *AppError must not become non-nil error
+func toError(appErr *app_errors.AppError) error {
+	if appErr == nil {
+		return nil
+	}
+	return appErr
+}
+
+// Exponential backoff with jitter, capped at maxBackoff
+func (r *AdsOutboxRelay) backoff(failures int) time.Duration {
+	backoff := r.pollInterval << failures
+	if backoff > r.maxBackoff || backoff <= 0 {
+		backoff = r.maxBackoff
+	}
+
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+}
+
+func expvarFloat(value float64) *expvar.Float {
+	v := new(expvar.Float)
+	v.Set(value)
+	return v
+}
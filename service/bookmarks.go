@@ -0,0 +1,160 @@
+package service
+
+import (
+	"context"
+	"github.com/FTN-TwitterClone/grpc-stubs/proto/social_graph"
+	"github.com/gocql/gocql"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"log"
+	"tweet/app_errors"
+	"tweet/model"
+)
+
+const bookmarksPageSize = 20
+
+// Bookmarks are private, only their owner sees them. Bookmarking a tweet twice does nothing.
+func (s *TweetService) CreateBookmark(ctx context.Context, id string) *app_errors.AppError {
+	serviceCtx, span := s.tracer.Start(ctx, "TweetService.CreateBookmark")
+	defer span.End()
+
+	authUser := serviceCtx.Value("authUser").(model.AuthUser)
+
+	tweetId, err := gocql.ParseUUID(id)
+	if err != nil {
+		return &app_errors.AppError{Code: 400, Message: "Invalid tweet id"}
+	}
+
+	tweet, err := s.cassandraRepository.FindTweet(serviceCtx, id)
+	if err == gocql.ErrNotFound {
+		return &app_errors.AppError{Code: 404, Message: "Tweet not found"}
+	}
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return &app_errors.AppError{Code: 500, Message: err.Error()}
+	}
+
+	targetUser := social_graph.SocialGraphUsername{
+		Username: tweet.PostedBy,
+	}
+
+	visibility, sbErr := s.socialGraphCB.CheckVisibility(serviceCtx, &targetUser)
+	if sbErr != nil && sbErr.Code == 503 {
+		span.SetStatus(codes.Error, sbErr.Error())
+		return &app_errors.AppError{Code: 503, Message: "Service unavailable"}
+	}
+
+	if !visibility {
+		return &app_errors.AppError{Code: 403}
+	}
+
+	_, err = s.cassandraRepository.FindBookmark(serviceCtx, authUser.Username, &tweetId)
+	if err == nil {
+		return nil
+	}
+	if err != gocql.ErrNotFound {
+		span.SetStatus(codes.Error, err.Error())
+		return &app_errors.AppError{Code: 500, Message: err.Error()}
+	}
+
+	bookmark := model.Bookmark{
+		Username:   authUser.Username,
+		BookmarkId: gocql.TimeUUID(),
+		TweetId:    tweetId,
+	}
+
+	err = s.cassandraRepository.SaveBookmark(serviceCtx, &bookmark)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return &app_errors.AppError{Code: 500, Message: err.Error()}
+	}
+
+	return nil
+}
+
+// Removing a bookmark that doesn't exist does nothing
+func (s *TweetService) DeleteBookmark(ctx context.Context, id string) *app_errors.AppError {
+	serviceCtx, span := s.tracer.Start(ctx, "TweetService.DeleteBookmark")
+	defer span.End()
+
+	authUser := serviceCtx.Value("authUser").(model.AuthUser)
+
+	tweetId, err := gocql.ParseUUID(id)
+	if err != nil {
+		return &app_errors.AppError{Code: 400, Message: "Invalid tweet id"}
+	}
+
+	bookmark, err := s.cassandraRepository.FindBookmark(serviceCtx, authUser.Username, &tweetId)
+	if err == gocql.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return &app_errors.AppError{Code: 500, Message: err.Error()}
+	}
+
+	err = s.cassandraRepository.DeleteBookmark(serviceCtx, &bookmark)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return &app_errors.AppError{Code: 500, Message: err.Error()}
+	}
+
+	return nil
+}
+
+// Bookmarked tweets, most recently bookmarked first. Deleted tweets and tweets of authors
+// user can no longer see are left out, so a page can have fewer tweets than page size.
+func (s *TweetService) GetBookmarks(ctx context.Context, cursor string) (*model.BookmarkPage, *app_errors.AppError) {
+	serviceCtx, span := s.tracer.Start(ctx, "TweetService.GetBookmarks")
+	defer span.End()
+
+	authUser := serviceCtx.Value("authUser").(model.AuthUser)
+
+	if _, err := gocql.ParseUUID(cursor); len(cursor) > 0 && err != nil {
+		return nil, &app_errors.AppError{Code: 400, Message: "Invalid cursor"}
+	}
+
+	bookmarks, err := s.cassandraRepository.GetBookmarks(serviceCtx, authUser.Username, cursor, bookmarksPageSize)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, &app_errors.AppError{Code: 500, Message: err.Error()}
+	}
+
+	var tweets []model.TweetDTO
+	for _, bookmark := range bookmarks {
+		tweet, err := s.cassandraRepository.FindTweet(serviceCtx, bookmark.TweetId.String())
+		if err == gocql.ErrNotFound {
+			s.removeBookmark(serviceCtx, &bookmark)
+			continue
+		}
+		if err != nil {
+			span.RecordError(err)
+			continue
+		}
+
+		tweets = append(tweets, s.toDTO(serviceCtx, &tweet))
+	}
+
+	tweets = s.hydrateTweets(serviceCtx, s.filterVisibleAuthors(serviceCtx, tweets))
+	if tweets == nil {
+		tweets = []model.TweetDTO{}
+	}
+
+	page := model.BookmarkPage{
+		Tweets: tweets,
+	}
+	if len(bookmarks) == bookmarksPageSize {
+		page.NextCursor = bookmarks[len(bookmarks)-1].BookmarkId.String()
+	}
+
+	return &page, nil
+}
+
+// Bookmark of a deleted tweet is removed when it is first read
+func (s *TweetService) removeBookmark(ctx context.Context, bookmark *model.Bookmark) {
+	err := s.cassandraRepository.DeleteBookmark(ctx, bookmark)
+	if err != nil {
+		trace.SpanFromContext(ctx).RecordError(err)
+		log.Printf("Bookmark of deleted tweet %s by %s was not removed: %v", bookmark.TweetId, bookmark.Username, err)
+	}
+}
@@ -0,0 +1,80 @@
+package circuit_breaker
+
+import (
+	"context"
+	"github.com/FTN-TwitterClone/grpc-stubs/proto/ads"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"tweet/app_errors"
+	"tweet/grpc_client"
+)
+
+type AdsCircuitBreaker struct {
+	breakers *Breakers
+	tracer   trace.Tracer
+	clients  *grpc_client.Registry
+}
+
+func NewAdsCircuitBreaker(tracer trace.Tracer, clients *grpc_client.Registry, breakers *Breakers) *AdsCircuitBreaker {
+	return &AdsCircuitBreaker{
+		breakers: breakers,
+		tracer:   tracer,
+		clients:  clients,
+	}
+}
+
+func (cb *AdsCircuitBreaker) SaveAdInfo(ctx context.Context, adInfo *ads.AdInfo) *app_errors.AppError {
+	cbCtx, span := cb.tracer.Start(ctx, "AdsCircuitBreaker.SaveAdInfo")
+	defer span.End()
+
+	return cb.execute(cbCtx, span, AdsSaveAdInfo, func(adsService ads.AdsServiceClient) error {
+		_, err := adsService.SaveAdInfo(cbCtx, adInfo)
+		return err
+	})
+}
+
+func (cb *AdsCircuitBreaker) SaveLikeEvent(ctx context.Context, likeEvent *ads.LikeEvent) *app_errors.AppError {
+	cbCtx, span := cb.tracer.Start(ctx, "AdsCircuitBreaker.SaveLikeEvent")
+	defer span.End()
+
+	return cb.execute(cbCtx, span, AdsSaveLikeEvent, func(adsService ads.AdsServiceClient) error {
+		_, err := adsService.SaveLikeEvent(cbCtx, likeEvent)
+		return err
+	})
+}
+
+func (cb *AdsCircuitBreaker) SaveUnlikeEvent(ctx context.Context, unlikeEvent *ads.UnlikeEvent) *app_errors.AppError {
+	cbCtx, span := cb.tracer.Start(ctx, "AdsCircuitBreaker.SaveUnlikeEvent")
+	defer span.End()
+
+	return cb.execute(cbCtx, span, AdsSaveUnlikeEvent, func(adsService ads.AdsServiceClient) error {
+		_, err := adsService.SaveUnlikeEvent(cbCtx, unlikeEvent)
+		return err
+	})
+}
+
+func (cb *AdsCircuitBreaker) execute(ctx context.Context, span trace.Span, breaker string, call func(adsService ads.AdsServiceClient) error) *app_errors.AppError {
+	conn, err := cb.clients.Conn(grpc_client.AdsAddress)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return &app_errors.AppError{Code: 500, Message: err.Error()}
+	}
+
+	adsService := ads.NewAdsServiceClient(conn)
+
+	_, err = cb.breakers.Get(breaker).Execute(func() (interface{}, error) {
+		err := call(adsService)
+
+		if err != nil {
+			return nil, &app_errors.AppError{Code: 500, Message: err.Error()}
+		}
+
+		return nil, nil
+	})
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return &app_errors.AppError{Code: 503, Message: err.Error()}
+	}
+
+	return nil
+}
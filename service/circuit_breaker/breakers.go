@@ -0,0 +1,148 @@
+package circuit_breaker
+
+import (
+	"expvar"
+	"github.com/sony/gobreaker"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"tweet/config"
+)
+
+// Names of breakers, one per downstream method
+const (
+	SocialGraphCheckVisibility    = "social-graph.CheckVisibility"
+	SocialGraphGetMyFollowers     = "social-graph.GetMyFollowers"
+	SocialGraphGetTargetGroupUser = "social-graph.GetTargetGroupUser"
+	AdsSaveAdInfo                 = "ads.SaveAdInfo"
+	AdsSaveLikeEvent              = "ads.SaveLikeEvent"
+	AdsSaveUnlikeEvent            = "ads.SaveUnlikeEvent"
+)
+
+var breakerTransitions = expvar.NewMap("circuit_breaker_transitions")
+
+type BreakerState struct {
+	Name                 string `json:"name"`
+	State                string `json:"state"`
+	Requests             uint32 `json:"requests"`
+	TotalFailures        uint32 `json:"totalFailures"`
+	ConsecutiveFailures  uint32 `json:"consecutiveFailures"`
+	ConsecutiveSuccesses uint32 `json:"consecutiveSuccesses"`
+}
+
+// Named circuit breakers, created on first use with settings from environment
+type Breakers struct {
+	mu       sync.RWMutex
+	breakers map[string]*gobreaker.CircuitBreaker
+}
+
+func NewBreakers() *Breakers {
+	b := &Breakers{
+		breakers: make(map[string]*gobreaker.CircuitBreaker),
+	}
+
+	expvar.Publish("circuit_breakers", expvar.Func(func() interface{} {
+		return b.States()
+	}))
+
+	return b
+}
+
+func (b *Breakers) Get(name string) *gobreaker.CircuitBreaker {
+	b.mu.RLock()
+	breaker, ok := b.breakers[name]
+	b.mu.RUnlock()
+	if ok {
+		return breaker
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if breaker, ok = b.breakers[name]; !ok {
+		breaker = newBreaker(name)
+		b.breakers[name] = breaker
+	}
+
+	return breaker
+}
+
+func (b *Breakers) States() []BreakerState {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	states := make([]BreakerState, 0, len(b.breakers))
+	for name, breaker := range b.breakers {
+		counts := breaker.Counts()
+		states = append(states, BreakerState{
+			Name:                 name,
+			State:                breaker.State().String(),
+			Requests:             counts.Requests,
+			TotalFailures:        counts.TotalFailures,
+			ConsecutiveFailures:  counts.ConsecutiveFailures,
+			ConsecutiveSuccesses: counts.ConsecutiveSuccesses,
+		})
+	}
+
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].Name < states[j].Name
+	})
+
+	return states
+}
+
+// Breaker can't be closed from outside, so it is replaced with a fresh one
+func (b *Breakers) Reset(name string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.breakers[name]; !ok {
+		return false
+	}
+
+	b.breakers[name] = newBreaker(name)
+	log.Printf("Circuit Breaker '%s' was reset\n", name)
+
+	return true
+}
+
+// Settings are read from CB_<NAME>_<SETTING> and fall back to CB_<SETTING>,
+// e.g. CB_SOCIAL_GRAPH_CHECKVISIBILITY_TIMEOUT for social-graph.CheckVisibility
+func newBreaker(name string) *gobreaker.CircuitBreaker {
+	prefix := "CB_" + envName(name) + "_"
+
+	maxRequests := config.GetInt(prefix+"MAX_REQUESTS", config.GetInt("CB_MAX_REQUESTS", 1))
+	timeout := config.GetDuration(prefix+"TIMEOUT", config.GetDuration("CB_TIMEOUT", 5*time.Second))
+	interval := config.GetDuration(prefix+"INTERVAL", config.GetDuration("CB_INTERVAL", 0))
+	failures := config.GetInt(prefix+"CONSECUTIVE_FAILURES", config.GetInt("CB_CONSECUTIVE_FAILURES", 5))
+
+	return gobreaker.NewCircuitBreaker(
+		gobreaker.Settings{
+			Name:        name,
+			MaxRequests: uint32(maxRequests),
+			Timeout:     timeout,
+			Interval:    interval,
+			ReadyToTrip: func(counts gobreaker.Counts) bool {
+				return counts.ConsecutiveFailures >= uint32(failures)
+			},
+			OnStateChange: func(name string, from gobreaker.State, to gobreaker.State) {
+				breakerTransitions.Add(name+":"+to.String(), 1)
+				log.Printf("Circuit Breaker '%s' changed from '%s' to '%s'\n", name, from, to)
+			},
+		},
+	)
+}
+
+func envName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' {
+			return r - 'a' + 'A'
+		}
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, name)
+}
@@ -4,85 +4,184 @@ import (
 	"context"
 	"github.com/FTN-TwitterClone/grpc-stubs/proto/social_graph"
 	"github.com/golang/protobuf/ptypes/empty"
-	"github.com/sony/gobreaker"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/grpc/metadata"
-	"log"
-	"time"
+	"os"
+	"sync"
 	"tweet/app_errors"
+	"tweet/config"
+	"tweet/grpc_client"
 	"tweet/model"
-	"tweet/tls"
+	"tweet/repository"
+)
+
+// What visibility checks do while social graph is unavailable
+const (
+	FailClosed            = "fail_closed"
+	ServeCachedVisibility = "cached"
 )
 
 type SocialGraphCircuitBreaker struct {
-	circuitBreaker *gobreaker.CircuitBreaker
-	tracer         trace.Tracer
+	breakers             *Breakers
+	tracer               trace.Tracer
+	visibilityRepository repository.VisibilityRepository
+	clients              *grpc_client.Registry
+	degradedPolicy       string
+	// social graph has no batch call, cache misses are checked on this many concurrent calls
+	visibilityWorkers int
 }
 
-func NewSocialGraphCircuitBreaker(tracer trace.Tracer) *SocialGraphCircuitBreaker {
+func NewSocialGraphCircuitBreaker(tracer trace.Tracer, visibilityRepository repository.VisibilityRepository, clients *grpc_client.Registry, breakers *Breakers) *SocialGraphCircuitBreaker {
+	// cache misses wait on a worker slot, with no slots the check would never finish
+	visibilityWorkers := config.GetInt("VISIBILITY_CHECK_WORKERS", 4)
+	if visibilityWorkers < 1 {
+		visibilityWorkers = 1
+	}
+
 	return &SocialGraphCircuitBreaker{
-		circuitBreaker: CircuitBreaker(),
-		tracer:         tracer,
+		breakers:             breakers,
+		tracer:               tracer,
+		visibilityRepository: visibilityRepository,
+		clients:              clients,
+		degradedPolicy:       degradedPolicy(),
+		visibilityWorkers:    visibilityWorkers,
 	}
 }
 
-func CircuitBreaker() *gobreaker.CircuitBreaker {
-	return gobreaker.NewCircuitBreaker(
-		gobreaker.Settings{
-			Name:        "SocialGraph",
-			MaxRequests: 1,
-			Timeout:     5 * time.Second,
-			Interval:    0,
-			ReadyToTrip: func(counts gobreaker.Counts) bool {
-				return counts.ConsecutiveFailures > 0
-			},
-			OnStateChange: func(name string, from gobreaker.State, to gobreaker.State) {
-				log.Printf("Circuit Breaker '%s' changed from '%s' to '%s'\n", name, from, to)
-			},
-		},
-	)
+func degradedPolicy() string {
+	policy := os.Getenv("VISIBILITY_DEGRADED_POLICY")
+	if policy == ServeCachedVisibility {
+		return ServeCachedVisibility
+	}
+	return FailClosed
 }
 
 func (cb *SocialGraphCircuitBreaker) CheckVisibility(ctx context.Context, targetUser *social_graph.SocialGraphUsername) (bool, *app_errors.AppError) {
 	cbCtx, span := cb.tracer.Start(ctx, "SocialGraphCircuitBreaker.CheckVisibility")
 	defer span.End()
 
-	conn, err := tls.GetgRPCConnection("social-graph:9001")
-	defer conn.Close()
+	visibility, err := cb.CheckVisibilityBatch(cbCtx, []string{targetUser.Username})
 	if err != nil {
 		span.SetStatus(codes.Error, err.Error())
-		return false, &app_errors.AppError{Code: 500, Message: err.Error()}
+		return false, err
 	}
 
+	return visibility[targetUser.Username], nil
+}
+
+// Resolves visibility of every unique user at once, from cache when possible.
+// On failure visibility that could be resolved is still returned along with the error.
+func (cb *SocialGraphCircuitBreaker) CheckVisibilityBatch(ctx context.Context, usernames []string) (map[string]bool, *app_errors.AppError) {
+	cbCtx, span := cb.tracer.Start(ctx, "SocialGraphCircuitBreaker.CheckVisibilityBatch")
+	defer span.End()
+
 	authUser := cbCtx.Value("authUser").(model.AuthUser)
 
+	var targets []string
+	seen := make(map[string]bool)
+	for _, username := range usernames {
+		if !seen[username] {
+			seen[username] = true
+			targets = append(targets, username)
+		}
+	}
+
+	visibility, err := cb.visibilityRepository.GetVisibility(cbCtx, authUser.Username, targets)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		visibility = make(map[string]bool)
+	}
+
+	var missing []string
+	for _, target := range targets {
+		if _, ok := visibility[target]; !ok {
+			missing = append(missing, target)
+		}
+	}
+
+	span.SetAttributes(attribute.Int("targets", len(targets)), attribute.Int("cacheMisses", len(missing)))
+
+	if len(missing) == 0 {
+		return visibility, nil
+	}
+
+	conn, err := cb.clients.Conn(grpc_client.SocialGraphAddress)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return visibility, &app_errors.AppError{Code: 500, Message: err.Error()}
+	}
+
 	socialGraphService := social_graph.NewSocialGraphServiceClient(conn)
 	cbCtx = metadata.AppendToOutgoingContext(cbCtx, "authUsername", authUser.Username)
 
-	execute, err := cb.circuitBreaker.Execute(func() (interface{}, error) {
-		response, err := socialGraphService.CheckVisibility(cbCtx, targetUser)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var failure error
+	fetched := make(map[string]bool)
+	workers := make(chan struct{}, cb.visibilityWorkers)
+
+	for _, target := range missing {
+		wg.Add(1)
+		workers <- struct{}{}
 
+		go func(target string) {
+			defer wg.Done()
+			defer func() { <-workers }()
+
+			execute, err := cb.breakers.Get(SocialGraphCheckVisibility).Execute(func() (interface{}, error) {
+				response, err := socialGraphService.CheckVisibility(cbCtx, &social_graph.SocialGraphUsername{Username: target})
+
+				if err != nil {
+					return false, &app_errors.AppError{Code: 500, Message: err.Error()}
+				}
+
+				return response.Visibility, nil
+			})
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if err != nil {
+				failure = err
+				return
+			}
+			fetched[target] = execute.(bool)
+		}(target)
+	}
+	wg.Wait()
+
+	if len(fetched) > 0 {
+		err = cb.visibilityRepository.SaveVisibility(cbCtx, authUser.Username, fetched)
 		if err != nil {
-			return false, &app_errors.AppError{Code: 500, Message: err.Error()}
+			span.SetStatus(codes.Error, err.Error())
 		}
+	}
 
-		return response.Visibility, nil
-	})
-	if err != nil {
-		span.SetStatus(codes.Error, err.Error())
-		return false, &app_errors.AppError{Code: 503, Message: err.Error()}
+	for target, visible := range fetched {
+		visibility[target] = visible
 	}
 
-	return execute.(bool), nil
+	if failure != nil {
+		span.SetStatus(codes.Error, failure.Error())
+
+		if cb.degradedPolicy == ServeCachedVisibility && cb.fillFromStale(cbCtx, authUser.Username, missing, visibility) {
+			span.SetAttributes(attribute.Bool("degraded", true))
+			return visibility, nil
+		}
+
+		return visibility, &app_errors.AppError{Code: 503, Message: failure.Error()}
+	}
+
+	return visibility, nil
 }
 
 func (cb *SocialGraphCircuitBreaker) GetMyFollowers(ctx context.Context) ([]*social_graph.SocialGraphUsername, *app_errors.AppError) {
 	cbCtx, span := cb.tracer.Start(ctx, "SocialGraphCircuitBreaker.GetMyFollowers")
 	defer span.End()
 
-	conn, err := tls.GetgRPCConnection("social-graph:9001")
-	defer conn.Close()
+	conn, err := cb.clients.Conn(grpc_client.SocialGraphAddress)
 	if err != nil {
 		span.SetStatus(codes.Error, err.Error())
 		return nil, &app_errors.AppError{Code: 500, Message: err.Error()}
@@ -93,7 +192,7 @@ func (cb *SocialGraphCircuitBreaker) GetMyFollowers(ctx context.Context) ([]*soc
 	socialGraphService := social_graph.NewSocialGraphServiceClient(conn)
 	cbCtx = metadata.AppendToOutgoingContext(cbCtx, "authUsername", authUser.Username)
 
-	execute, err := cb.circuitBreaker.Execute(func() (interface{}, error) {
+	execute, err := cb.breakers.Get(SocialGraphGetMyFollowers).Execute(func() (interface{}, error) {
 		response, err := socialGraphService.GetMyFollowers(cbCtx, new(empty.Empty))
 
 		if err != nil {
@@ -114,8 +213,7 @@ func (cb *SocialGraphCircuitBreaker) GetTargetGroupUsers(ctx context.Context, ta
 	cbCtx, span := cb.tracer.Start(ctx, "SocialGraphCircuitBreaker.GetTargetGroupUsers")
 	defer span.End()
 
-	conn, err := tls.GetgRPCConnection("social-graph:9001")
-	defer conn.Close()
+	conn, err := cb.clients.Conn(grpc_client.SocialGraphAddress)
 	if err != nil {
 		span.SetStatus(codes.Error, err.Error())
 		return nil, &app_errors.AppError{Code: 500, Message: err.Error()}
@@ -130,7 +228,7 @@ func (cb *SocialGraphCircuitBreaker) GetTargetGroupUsers(ctx context.Context, ta
 		MaxAge: targetGroup.MaxAge,
 	}
 
-	execute, err := cb.circuitBreaker.Execute(func() (interface{}, error) {
+	execute, err := cb.breakers.Get(SocialGraphGetTargetGroupUser).Execute(func() (interface{}, error) {
 		response, err := socialGraphService.GetTargetGroupUser(cbCtx, &tg)
 
 		if err != nil {
@@ -146,3 +244,24 @@ func (cb *SocialGraphCircuitBreaker) GetTargetGroupUsers(ctx context.Context, ta
 
 	return execute.([]*social_graph.SocialGraphUsername), nil
 }
+
+// Fills unresolved visibility with last known values, reports whether every target was resolved
+func (cb *SocialGraphCircuitBreaker) fillFromStale(ctx context.Context, viewer string, targets []string, visibility map[string]bool) bool {
+	var unresolved []string
+	for _, target := range targets {
+		if _, ok := visibility[target]; !ok {
+			unresolved = append(unresolved, target)
+		}
+	}
+
+	stale, err := cb.visibilityRepository.GetStaleVisibility(ctx, viewer, unresolved)
+	if err != nil {
+		return false
+	}
+
+	for target, visible := range stale {
+		visibility[target] = visible
+	}
+
+	return len(stale) == len(unresolved)
+}
@@ -0,0 +1,291 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/gocql/gocql"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"log"
+	"sort"
+	"time"
+	"tweet/app_errors"
+	"tweet/config"
+	"tweet/model"
+	"tweet/repository"
+	"tweet/validation"
+)
+
+// Drafts may be longer than a tweet while they are written, length is checked on publish
+const maxDraftTextLength = 10000
+
+// Drafts are kept on the server, so the same drafts are seen from every device of their owner
+type DraftService struct {
+	cassandraRepository repository.CassandraRepository
+	tweetService        *TweetService
+	tracer              trace.Tracer
+	maxDrafts           int
+}
+
+func NewDraftService(cassandraRepository repository.CassandraRepository, tweetService *TweetService, tracer trace.Tracer) *DraftService {
+	return &DraftService{
+		cassandraRepository: cassandraRepository,
+		tweetService:        tweetService,
+		tracer:              tracer,
+		maxDrafts:           config.GetInt("DRAFTS_MAX", 100),
+	}
+}
+
+func (s *DraftService) CreateDraft(ctx context.Context, draft model.Draft) (*model.Draft, *app_errors.AppError) {
+	serviceCtx, span := s.tracer.Start(ctx, "DraftService.CreateDraft")
+	defer span.End()
+
+	authUser := serviceCtx.Value("authUser").(model.AuthUser)
+
+	drafts, err := s.cassandraRepository.FindDraftsByUser(serviceCtx, authUser.Username)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, &app_errors.AppError{Code: 500, Message: err.Error()}
+	}
+	if len(drafts) >= s.maxDrafts {
+		return nil, &app_errors.AppError{Code: 409, Message: fmt.Sprintf("You can have at most %d drafts", s.maxDrafts)}
+	}
+
+	draft.ID = gocql.TimeUUID()
+	draft.Username = authUser.Username
+	draft.Version = 1
+	draft.UpdatedAt = time.Now()
+
+	appErr := s.validate(serviceCtx, &draft)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		return nil, appErr
+	}
+
+	// images are held before the draft is saved, so orphan cleanup never removes images of a saved draft
+	err = s.holdImages(serviceCtx, draft.ID, draft.Media)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, &app_errors.AppError{Code: 500, Message: err.Error()}
+	}
+
+	err = s.cassandraRepository.SaveDraft(serviceCtx, &draft)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		s.releaseUnused(serviceCtx, draft.Username, draft.ID, draft.Media)
+		return nil, &app_errors.AppError{Code: 500, Message: err.Error()}
+	}
+
+	return &draft, nil
+}
+
+// Drafts of authenticated user, most recently updated first
+func (s *DraftService) GetDrafts(ctx context.Context) ([]model.Draft, *app_errors.AppError) {
+	serviceCtx, span := s.tracer.Start(ctx, "DraftService.GetDrafts")
+	defer span.End()
+
+	authUser := serviceCtx.Value("authUser").(model.AuthUser)
+
+	drafts, err := s.cassandraRepository.FindDraftsByUser(serviceCtx, authUser.Username)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, &app_errors.AppError{Code: 500, Message: err.Error()}
+	}
+
+	sort.SliceStable(drafts, func(i, j int) bool {
+		return drafts[i].UpdatedAt.After(drafts[j].UpdatedAt)
+	})
+
+	if drafts == nil {
+		drafts = []model.Draft{}
+	}
+
+	return drafts, nil
+}
+
+// Replaces text and media. Version has to be the one the update was made from,
+// draft changed on another device in the meantime is not overwritten.
+func (s *DraftService) UpdateDraft(ctx context.Context, id string, updated model.Draft) (*model.Draft, *app_errors.AppError) {
+	serviceCtx, span := s.tracer.Start(ctx, "DraftService.UpdateDraft")
+	defer span.End()
+
+	draft, appErr := s.findOwnDraft(serviceCtx, id)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	expectedVersion := updated.Version
+	if expectedVersion == 0 {
+		expectedVersion = draft.Version
+	}
+	if expectedVersion != draft.Version {
+		return nil, &app_errors.AppError{Code: 409, Message: "Draft was changed on another device"}
+	}
+
+	updated.ID = draft.ID
+	updated.Username = draft.Username
+	updated.Version = draft.Version + 1
+	updated.UpdatedAt = time.Now()
+
+	appErr = s.validate(serviceCtx, &updated)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		return nil, appErr
+	}
+
+	// added images are held before the update, the ones it removes are released after it
+	added := removedMedia(updated.Media, draft.Media)
+	err := s.holdImages(serviceCtx, updated.ID, added)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, &app_errors.AppError{Code: 500, Message: err.Error()}
+	}
+
+	applied, err := s.cassandraRepository.UpdateDraft(serviceCtx, &updated, expectedVersion)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		s.releaseUnused(serviceCtx, updated.Username, updated.ID, added)
+		return nil, &app_errors.AppError{Code: 500, Message: err.Error()}
+	}
+	if !applied {
+		s.releaseUnused(serviceCtx, updated.Username, updated.ID, added)
+		return nil, &app_errors.AppError{Code: 409, Message: "Draft was changed on another device"}
+	}
+
+	s.releaseImages(serviceCtx, updated.ID, removedMedia(draft.Media, updated.Media))
+
+	return &updated, nil
+}
+
+func (s *DraftService) DeleteDraft(ctx context.Context, id string) *app_errors.AppError {
+	serviceCtx, span := s.tracer.Start(ctx, "DraftService.DeleteDraft")
+	defer span.End()
+
+	draft, appErr := s.findOwnDraft(serviceCtx, id)
+	if appErr != nil {
+		return appErr
+	}
+
+	applied, err := s.cassandraRepository.DeleteDraft(serviceCtx, draft)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return &app_errors.AppError{Code: 500, Message: err.Error()}
+	}
+	if !applied {
+		return &app_errors.AppError{Code: 409, Message: "Draft was changed on another device"}
+	}
+
+	s.releaseImages(serviceCtx, draft.ID, draft.Media)
+
+	return nil
+}
+
+// Posts the draft as a tweet and deletes it, draft is restored when tweet can't be posted.
+// Draft is deleted at its version before posting, so publishing it twice posts only one tweet.
+func (s *DraftService) PublishDraft(ctx context.Context, id string) (*model.TweetDTO, *app_errors.AppError) {
+	serviceCtx, span := s.tracer.Start(ctx, "DraftService.PublishDraft")
+	defer span.End()
+
+	draft, appErr := s.findOwnDraft(serviceCtx, id)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	applied, err := s.cassandraRepository.DeleteDraft(serviceCtx, draft)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, &app_errors.AppError{Code: 500, Message: err.Error()}
+	}
+	if !applied {
+		return nil, &app_errors.AppError{Code: 409, Message: "Draft was changed or published on another device"}
+	}
+
+	// draft keeps holding its images until the tweet holds them
+	tweet, appErr := s.tweetService.CreateTweet(serviceCtx, model.Tweet{
+		Text:  draft.Text,
+		Media: draft.Media,
+	})
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+
+		// restored at a new version, so requests made from the claimed one don't apply to it
+		draft.Version++
+		draft.UpdatedAt = time.Now()
+		err = s.cassandraRepository.SaveDraft(serviceCtx, draft)
+		if err != nil {
+			log.Printf("Draft %s of %s was lost after failed publish: %v", draft.ID, draft.Username, err)
+			s.releaseImages(serviceCtx, draft.ID, draft.Media)
+		}
+
+		return nil, appErr
+	}
+
+	s.releaseImages(serviceCtx, draft.ID, draft.Media)
+
+	return tweet, nil
+}
+
+func (s *DraftService) validate(ctx context.Context, draft *model.Draft) *app_errors.AppError {
+	draft.Text = validation.Normalize(draft.Text)
+	if len([]rune(draft.Text)) > maxDraftTextLength {
+		return app_errors.NewValidationError([]app_errors.FieldError{{Field: "text", Message: fmt.Sprintf("Draft can have at most %d characters", maxDraftTextLength)}})
+	}
+
+	media, appErr := s.tweetService.validateMedia(ctx, "media", draft.Media, draft.Username)
+	if appErr != nil {
+		return appErr
+	}
+	draft.Media = media
+
+	return nil
+}
+
+// Key a draft holds its images by until it is posted or deleted
+func draftImageUse(draftId gocql.UUID) string {
+	return "draft:" + draftId.String()
+}
+
+// Images of drafts must outlive orphan cleanup while the draft exists
+func (s *DraftService) holdImages(ctx context.Context, id gocql.UUID, media []model.Media) error {
+	return s.cassandraRepository.AttachImages(ctx, draftImageUse(id), media)
+}
+
+// Images no longer in the draft go back to orphan cleanup unless something else uses them
+func (s *DraftService) releaseImages(ctx context.Context, id gocql.UUID, media []model.Media) {
+	err := s.cassandraRepository.DetachImages(ctx, draftImageUse(id), media)
+	if err != nil {
+		trace.SpanFromContext(ctx).SetStatus(codes.Error, err.Error())
+	}
+}
+
+// After a write that failed or wasn't applied, images are released only if the stored draft doesn't have them.
+// Images stay held when the draft can't be read, a leftover hold is safer than a deleted image.
+func (s *DraftService) releaseUnused(ctx context.Context, username string, id gocql.UUID, media []model.Media) {
+	current, err := s.cassandraRepository.FindDraft(ctx, username, &id)
+	if err != nil && err != gocql.ErrNotFound {
+		trace.SpanFromContext(ctx).SetStatus(codes.Error, err.Error())
+		return
+	}
+
+	s.releaseImages(ctx, id, removedMedia(media, current.Media))
+}
+
+// Drafts of other users are reported as missing
+func (s *DraftService) findOwnDraft(ctx context.Context, id string) (*model.Draft, *app_errors.AppError) {
+	authUser := ctx.Value("authUser").(model.AuthUser)
+
+	draftId, err := gocql.ParseUUID(id)
+	if err != nil {
+		return nil, &app_errors.AppError{Code: 400, Message: "Invalid draft id"}
+	}
+
+	draft, err := s.cassandraRepository.FindDraft(ctx, authUser.Username, &draftId)
+	if err == gocql.ErrNotFound {
+		return nil, &app_errors.AppError{Code: 404, Message: "Draft not found"}
+	}
+	if err != nil {
+		return nil, &app_errors.AppError{Code: 500, Message: err.Error()}
+	}
+
+	return &draft, nil
+}
@@ -0,0 +1,211 @@
+package service
+
+import (
+	"context"
+	"expvar"
+	"github.com/gocql/gocql"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"log"
+	"time"
+	"tweet/config"
+	"tweet/model"
+	"tweet/repository"
+	"tweet/service/circuit_breaker"
+)
+
+const (
+	fanoutLease     = "fanout-replayer"
+	fanoutPageLimit = 100
+)
+
+var fanoutMetrics = expvar.NewMap("fanout")
+
+// Delivers tweets to followers' feeds when social graph was unavailable at the time of posting.
+// Replicas share a lease, only the one holding it replays.
+type FanoutReplayer struct {
+	cassandraRepository repository.CassandraRepository
+	leaseRepository     repository.LeaseRepository
+	socialGraphCB       *circuit_breaker.SocialGraphCircuitBreaker
+	tracer              trace.Tracer
+	holder              string
+	interval            time.Duration
+	leaseTtl            time.Duration
+}
+
+func NewFanoutReplayer(cassandraRepository repository.CassandraRepository, leaseRepository repository.LeaseRepository, socialGraphCB *circuit_breaker.SocialGraphCircuitBreaker, tracer trace.Tracer) *FanoutReplayer {
+	interval := config.GetDuration("FANOUT_REPLAY_INTERVAL", 30*time.Second)
+
+	return &FanoutReplayer{
+		cassandraRepository: cassandraRepository,
+		leaseRepository:     leaseRepository,
+		socialGraphCB:       socialGraphCB,
+		tracer:              tracer,
+		holder:              gocql.TimeUUID().String(),
+		interval:            interval,
+		leaseTtl:            config.GetDuration("FANOUT_LEASE_TTL", 3*interval),
+	}
+}
+
+func (r *FanoutReplayer) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				// another replica can take over without waiting for the lease to expire
+				if err := r.leaseRepository.ReleaseLease(context.Background(), fanoutLease, r.holder); err != nil {
+					log.Printf("Failed to release fan-out lease: %v", err)
+				}
+				return
+			case <-ticker.C:
+				r.ReplayFanouts(ctx)
+			}
+		}
+	}()
+}
+
+func (r *FanoutReplayer) ReplayFanouts(ctx context.Context) {
+	replayerCtx, span := r.tracer.Start(ctx, "FanoutReplayer.ReplayFanouts")
+	defer span.End()
+
+	var pageState []byte
+	pending := 0
+	for {
+		// lease is extended before every page and every fan-out, so a slow round is not taken over halfway
+		if !r.holdLease(replayerCtx) {
+			return
+		}
+
+		fanouts, nextPageState, err := r.cassandraRepository.FindPendingFanouts(replayerCtx, pageState, fanoutPageLimit)
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			log.Printf("Failed to find pending fan-outs: %v", err)
+			return
+		}
+
+		// counts fan-outs seen this round, a round stopped early reports fewer
+		pending += len(fanouts)
+		fanoutMetrics.Set("pending", expvarInt(pending))
+
+		for i, fanout := range fanouts {
+			if ctx.Err() != nil {
+				return
+			}
+			if i > 0 && !r.holdLease(replayerCtx) {
+				return
+			}
+
+			// social graph is still down, the rest will wait for next round
+			if !r.replay(replayerCtx, fanout) {
+				return
+			}
+		}
+
+		if len(nextPageState) == 0 {
+			return
+		}
+		pageState = nextPageState
+	}
+}
+
+func (r *FanoutReplayer) holdLease(ctx context.Context) bool {
+	held, err := r.leaseRepository.AcquireLease(ctx, fanoutLease, r.holder, r.leaseTtl)
+	if err != nil {
+		trace.SpanFromContext(ctx).SetStatus(codes.Error, err.Error())
+		log.Printf("Failed to acquire fan-out lease: %v", err)
+		return false
+	}
+
+	return held
+}
+
+func (r *FanoutReplayer) replay(ctx context.Context, fanout model.PendingFanout) bool {
+	replayerCtx, span := r.tracer.Start(ctx, "FanoutReplayer.replay")
+	defer span.End()
+
+	tweet, err := r.cassandraRepository.FindTweet(replayerCtx, fanout.TweetId.String())
+	if err == gocql.ErrNotFound {
+		log.Printf("Dropping fan-out of tweet %s by %s, tweet was deleted", fanout.TweetId, fanout.PostedBy)
+		r.delete(replayerCtx, fanout)
+		return true
+	}
+	if err != nil {
+		// tweet can't be read now, the rest will wait for next round
+		span.SetStatus(codes.Error, err.Error())
+		r.retryLater(replayerCtx, fanout, err)
+		return false
+	}
+
+	// followers are requested on behalf of the author
+	authorCtx := context.WithValue(replayerCtx, "authUser", model.AuthUser{Username: fanout.PostedBy})
+
+	followers, appErr := r.socialGraphCB.GetMyFollowers(authorCtx)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		r.retryLater(replayerCtx, fanout, appErr)
+		return false
+	}
+
+	if fanout.TargetGroup != nil {
+		targetGroupUsers, appErr := r.socialGraphCB.GetTargetGroupUsers(replayerCtx, *fanout.TargetGroup)
+		if appErr != nil {
+			span.SetStatus(codes.Error, appErr.Error())
+			r.retryLater(replayerCtx, fanout, appErr)
+			return false
+		}
+
+		followers = append(followers, targetGroupUsers...)
+	}
+
+	t := model.TweetDTO{
+		ID:               tweet.ID,
+		PostedBy:         tweet.PostedBy,
+		Text:             tweet.Text,
+		Entities:         tweet.Entities,
+		Media:            tweet.Media,
+		Timestamp:        tweet.ID.Time(),
+		Retweet:          tweet.Retweet,
+		OriginalPostedBy: tweet.OriginalPostedBy,
+		OriginalTweetId:  tweet.OriginalTweetId,
+		EditedAt:         tweet.EditedAt,
+		Ad:               tweet.Ad,
+	}
+
+	err = r.cassandraRepository.SaveFeedTweets(replayerCtx, &t, followers)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		r.retryLater(replayerCtx, fanout, err)
+		return true
+	}
+
+	fanoutMetrics.Add("replayed", 1)
+	r.delete(replayerCtx, fanout)
+
+	return true
+}
+
+func (r *FanoutReplayer) retryLater(ctx context.Context, fanout model.PendingFanout, cause error) {
+	fanout.Attempts++
+	fanout.LastError = cause.Error()
+
+	err := r.cassandraRepository.SavePendingFanout(ctx, &fanout)
+	if err != nil {
+		log.Printf("Failed to update pending fan-out of tweet %s: %v", fanout.TweetId, err)
+	}
+}
+
+func (r *FanoutReplayer) delete(ctx context.Context, fanout model.PendingFanout) {
+	err := r.cassandraRepository.DeletePendingFanout(ctx, &fanout.TweetId)
+	if err != nil {
+		log.Printf("Failed to delete pending fan-out of tweet %s: %v", fanout.TweetId, err)
+	}
+}
+
+func expvarInt(value int) *expvar.Int {
+	v := new(expvar.Int)
+	v.Set(int64(value))
+	return v
+}
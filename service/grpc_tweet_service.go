@@ -11,14 +11,16 @@ import (
 
 type gRPCTweetService struct {
 	tweet.UnimplementedTweetServiceServer
-	tracer              trace.Tracer
-	cassandraRepository repository.CassandraRepository
+	tracer               trace.Tracer
+	cassandraRepository  repository.CassandraRepository
+	visibilityRepository repository.VisibilityRepository
 }
 
-func NewgRPCTweetService(tracer trace.Tracer, cassandraRepository repository.CassandraRepository) *gRPCTweetService {
+func NewgRPCTweetService(tracer trace.Tracer, cassandraRepository repository.CassandraRepository, visibilityRepository repository.VisibilityRepository) *gRPCTweetService {
 	return &gRPCTweetService{
-		tracer:              tracer,
-		cassandraRepository: cassandraRepository,
+		tracer:               tracer,
+		cassandraRepository:  cassandraRepository,
+		visibilityRepository: visibilityRepository,
 	}
 }
 
@@ -26,7 +28,13 @@ func (s gRPCTweetService) UpdateFeed(ctx context.Context, followReq *tweet.Reque
 	serviceCtx, span := s.tracer.Start(ctx, "gRPCTweetService.UpdateFeed")
 	defer span.End()
 
-	err := s.cassandraRepository.UpdateFeed(serviceCtx, followReq.From, followReq.To)
+	// new follow changes what follower can see
+	err := s.visibilityRepository.Invalidate(serviceCtx, followReq.From, followReq.To)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	err = s.cassandraRepository.UpdateFeed(serviceCtx, followReq.From, followReq.To)
 	if err != nil {
 		span.SetStatus(codes.Error, err.Error())
 		return new(empty.Empty), err
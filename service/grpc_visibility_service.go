@@ -0,0 +1,90 @@
+package service
+
+import (
+	"context"
+	"github.com/FTN-TwitterClone/grpc-stubs/proto/tweet"
+	"github.com/golang/protobuf/ptypes/empty"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"tweet/repository"
+)
+
+// Called by social graph when follow or privacy state changes, so cached visibility is not served after the change.
+// Request.From is the viewer and Request.To is the target user, either of them can be left empty:
+//   - From and To: viewer followed or unfollowed target
+//   - only From: everything viewer sees is invalidated
+//   - only To: target changed privacy, invalidated for every viewer
+type VisibilityCacheServiceServer interface {
+	InvalidateVisibility(ctx context.Context, req *tweet.Request) (*empty.Empty, error)
+}
+
+// There is no stub for this service in grpc-stubs, it reuses tweet.Request message.
+// Clients call it by full method name /tweet.VisibilityCacheService/InvalidateVisibility.
+var VisibilityCacheServiceDesc = grpc.ServiceDesc{
+	ServiceName: "tweet.VisibilityCacheService",
+	HandlerType: (*VisibilityCacheServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "InvalidateVisibility",
+			Handler:    invalidateVisibilityHandler,
+		},
+	},
+	Streams: []grpc.StreamDesc{},
+}
+
+func RegisterVisibilityCacheServiceServer(s grpc.ServiceRegistrar, srv VisibilityCacheServiceServer) {
+	s.RegisterService(&VisibilityCacheServiceDesc, srv)
+}
+
+func invalidateVisibilityHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(tweet.Request)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(VisibilityCacheServiceServer).InvalidateVisibility(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/tweet.VisibilityCacheService/InvalidateVisibility",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(VisibilityCacheServiceServer).InvalidateVisibility(ctx, req.(*tweet.Request))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+type gRPCVisibilityCacheService struct {
+	tracer               trace.Tracer
+	visibilityRepository repository.VisibilityRepository
+}
+
+func NewgRPCVisibilityCacheService(tracer trace.Tracer, visibilityRepository repository.VisibilityRepository) *gRPCVisibilityCacheService {
+	return &gRPCVisibilityCacheService{
+		tracer:               tracer,
+		visibilityRepository: visibilityRepository,
+	}
+}
+
+func (s gRPCVisibilityCacheService) InvalidateVisibility(ctx context.Context, req *tweet.Request) (*empty.Empty, error) {
+	serviceCtx, span := s.tracer.Start(ctx, "gRPCVisibilityCacheService.InvalidateVisibility")
+	defer span.End()
+
+	var err error
+	switch {
+	case len(req.From) > 0 && len(req.To) > 0:
+		err = s.visibilityRepository.Invalidate(serviceCtx, req.From, req.To)
+	case len(req.From) > 0:
+		err = s.visibilityRepository.InvalidateViewer(serviceCtx, req.From)
+	case len(req.To) > 0:
+		err = s.visibilityRepository.InvalidateTarget(serviceCtx, req.To)
+	}
+
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return new(empty.Empty), err
+	}
+
+	return new(empty.Empty), nil
+}
@@ -0,0 +1,182 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"sync"
+	"tweet/app_errors"
+	"tweet/model"
+)
+
+// Checks retweet visibility for the whole page and loads images on a bounded number of workers.
+// Order is preserved, retweets whose visibility can't be checked are left out.
+func (s *TweetService) hydrateTweets(ctx context.Context, tweets []model.TweetDTO) []model.TweetDTO {
+	serviceCtx, span := s.tracer.Start(ctx, "TweetService.hydrateTweets")
+	defer span.End()
+
+	// authors of retweeted tweets are resolved together, unresolved ones are left out of the page
+	var originalAuthors []string
+	for _, tweet := range tweets {
+		if tweet.Retweet {
+			originalAuthors = append(originalAuthors, tweet.OriginalPostedBy)
+		}
+	}
+
+	visibility := make(map[string]bool)
+	if len(originalAuthors) > 0 {
+		var err *app_errors.AppError
+		visibility, err = s.socialGraphCB.CheckVisibilityBatch(serviceCtx, originalAuthors)
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+		}
+	}
+
+	hydrated := make([]*model.TweetDTO, len(tweets))
+	workers := make(chan struct{}, s.hydrationWorkers)
+
+	var wg sync.WaitGroup
+	for i := range tweets {
+		wg.Add(1)
+		workers <- struct{}{}
+
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-workers }()
+
+			hydrated[i] = s.hydrateTweet(serviceCtx, tweets[i], visibility)
+		}(i)
+	}
+	wg.Wait()
+
+	var responseTweets []model.TweetDTO
+	for _, tweet := range hydrated {
+		if tweet != nil {
+			responseTweets = append(responseTweets, *tweet)
+		}
+	}
+
+	return responseTweets
+}
+
+// Leaves out tweets whose author user can't see or whose visibility can't be checked
+func (s *TweetService) filterVisibleAuthors(ctx context.Context, tweets []model.TweetDTO) []model.TweetDTO {
+	if len(tweets) == 0 {
+		return tweets
+	}
+
+	var authors []string
+	for _, tweet := range tweets {
+		authors = append(authors, tweet.PostedBy)
+	}
+
+	visibility, err := s.socialGraphCB.CheckVisibilityBatch(ctx, authors)
+	if err != nil {
+		trace.SpanFromContext(ctx).SetStatus(codes.Error, err.Error())
+	}
+
+	var visibleTweets []model.TweetDTO
+	for _, tweet := range tweets {
+		if visibility[tweet.PostedBy] {
+			visibleTweets = append(visibleTweets, tweet)
+		}
+	}
+
+	return visibleTweets
+}
+
+func (s *TweetService) hydrateTweet(ctx context.Context, tweet model.TweetDTO, visibility map[string]bool) *model.TweetDTO {
+	if tweet.Retweet {
+		visible, ok := visibility[tweet.OriginalPostedBy]
+		if !ok {
+			return nil
+		}
+
+		if !visible {
+			tweet.Text = ""
+			tweet.Media = nil
+			return &tweet
+		}
+	}
+
+	tweet.Media, tweet.ImageUnavailable = s.loadMedia(ctx, tweet.Media)
+
+	return &tweet
+}
+
+// Loads image content for every attachment, each image has its own timeout.
+// Reports whether any of the images couldn't be loaded.
+func (s *TweetService) loadMedia(ctx context.Context, media []model.Media) ([]model.Media, bool) {
+	unavailable := false
+	loaded := make([]model.Media, len(media))
+	for i, m := range media {
+		image, err := s.getImageWithTimeout(ctx, m.BlobKey())
+		if err != nil {
+			unavailable = true
+		}
+
+		m.Image = image
+		loaded[i] = m
+	}
+
+	return loaded, unavailable
+}
+
+type imageResult struct {
+	image []byte
+	err   error
+}
+
+// Reading the file doesn't respect context, so slow reads are abandoned instead of cancelled
+func (s *TweetService) getImageWithTimeout(ctx context.Context, blobKey string) ([]byte, error) {
+	timeoutCtx, cancel := context.WithTimeout(ctx, s.imageTimeout)
+	defer cancel()
+
+	result := make(chan imageResult, 1)
+	go func() {
+		image, err := s.GetImage(timeoutCtx, blobKey)
+		result <- imageResult{image, err}
+	}()
+
+	select {
+	case r := <-result:
+		return r.image, r.err
+	case <-timeoutCtx.Done():
+		return nil, errors.New("image load timed out: " + blobKey)
+	}
+}
+
+// Response of a tweet read on its own rather than from a timeline
+func (s *TweetService) toDTO(ctx context.Context, tweet *model.Tweet) model.TweetDTO {
+	t := model.TweetDTO{
+		ID:               tweet.ID,
+		PostedBy:         tweet.PostedBy,
+		Text:             tweet.Text,
+		Entities:         tweet.Entities,
+		Media:            tweet.Media,
+		Timestamp:        tweet.ID.Time(),
+		Retweet:          tweet.Retweet,
+		OriginalPostedBy: tweet.OriginalPostedBy,
+		OriginalTweetId:  tweet.OriginalTweetId,
+		EditedAt:         tweet.EditedAt,
+		Ad:               tweet.Ad,
+	}
+
+	likes, err := s.cassandraRepository.CountLikes(ctx, &tweet.ID)
+	if err == nil {
+		t.LikesCount = likes
+	}
+
+	likedByMe, err := s.cassandraRepository.LikedByMe(ctx, &tweet.ID)
+	if err == nil {
+		t.LikedByMe = likedByMe
+	}
+
+	bookmarkedByMe, err := s.cassandraRepository.BookmarkedByMe(ctx, &tweet.ID)
+	if err == nil {
+		t.BookmarkedByMe = bookmarkedByMe
+	}
+
+	return t
+}
@@ -0,0 +1,167 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/gocql/gocql"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"log"
+	"os"
+	"time"
+	"tweet/config"
+	"tweet/repository"
+)
+
+// Periodically deletes uploaded images that nothing is attached to.
+// Images are queued by the hour they were uploaded or detached, an hour is cleaned once it is older than maxAge.
+type ImageCleaner struct {
+	cassandraRepository repository.CassandraRepository
+	tracer              trace.Tracer
+	maxAge              time.Duration
+	interval            time.Duration
+	// hours older than this are not looked at again, images left in them are kept
+	lookback time.Duration
+}
+
+func NewImageCleaner(cassandraRepository repository.CassandraRepository, tracer trace.Tracer) *ImageCleaner {
+	return &ImageCleaner{
+		cassandraRepository: cassandraRepository,
+		tracer:              tracer,
+		maxAge:              config.GetDuration("IMAGE_ORPHAN_MAX_AGE", 24*time.Hour),
+		interval:            config.GetDuration("IMAGE_GC_INTERVAL", time.Hour),
+		lookback:            config.GetDuration("IMAGE_GC_LOOKBACK", 48*time.Hour),
+	}
+}
+
+func (c *ImageCleaner) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				c.DeleteOrphanImages(ctx)
+			}
+		}
+	}()
+}
+
+func (c *ImageCleaner) DeleteOrphanImages(ctx context.Context) {
+	cleanerCtx, span := c.tracer.Start(ctx, "ImageCleaner.DeleteOrphanImages")
+	defer span.End()
+
+	cutoff := time.Now().Add(-c.maxAge)
+
+	deleted := 0
+	for hour := cutoff.Add(-c.lookback).Truncate(time.Hour); !hour.Add(time.Hour).After(cutoff); hour = hour.Add(time.Hour) {
+		if ctx.Err() != nil {
+			return
+		}
+		deleted += c.cleanHour(cleanerCtx, hour)
+	}
+
+	if deleted > 0 {
+		log.Printf("Deleted %d orphan images", deleted)
+	}
+}
+
+// Hour stays queued when any of its images couldn't be handled, it is cleaned again on next run
+func (c *ImageCleaner) cleanHour(ctx context.Context, hour time.Time) int {
+	span := trace.SpanFromContext(ctx)
+
+	imageIds, err := c.cassandraRepository.FindUnattachedImages(ctx, hour)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		log.Printf("Failed to find unattached images uploaded at %s: %v", hour, err)
+		return 0
+	}
+
+	if len(imageIds) == 0 {
+		return 0
+	}
+
+	deleted := 0
+	handled := true
+	for _, imageId := range imageIds {
+		orphan, err := c.deleteIfOrphan(ctx, imageId)
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			handled = false
+			continue
+		}
+		if orphan {
+			deleted++
+		}
+	}
+
+	if handled {
+		if err = c.cassandraRepository.DeleteUnattachedImages(ctx, hour); err != nil {
+			span.SetStatus(codes.Error, err.Error())
+		}
+	}
+
+	return deleted
+}
+
+// Image is checked again right before it is deleted, the one attached since it was queued is kept
+func (c *ImageCleaner) deleteIfOrphan(ctx context.Context, imageId string) (bool, error) {
+	image, err := c.cassandraRepository.FindImage(ctx, imageId)
+	if err == gocql.ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if len(image.UsedBy) > 0 {
+		return false, nil
+	}
+
+	deleted, err := c.cassandraRepository.DeleteOrphanImage(ctx, imageId)
+	if err != nil || !deleted {
+		return false, err
+	}
+
+	// content is shared between uploads, it is deleted with the last reference.
+	// Reference that failed to be removed only keeps the content.
+	refs, err := c.cassandraRepository.DecrementImageRefs(ctx, image.Hash)
+	if err != nil {
+		log.Printf("Reference to image content %s was not removed, content is kept: %v", image.Hash, err)
+		return true, nil
+	}
+
+	if refs == 0 {
+		c.deleteContent(ctx, image.Hash)
+	}
+
+	return true, nil
+}
+
+// Content is locked so that no upload can take a new reference while the file is removed
+func (c *ImageCleaner) deleteContent(ctx context.Context, hash string) {
+	span := trace.SpanFromContext(ctx)
+
+	locked, err := c.cassandraRepository.LockImageBlob(ctx, hash)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return
+	}
+	if !locked {
+		// uploaded again in the meantime
+		return
+	}
+
+	err = os.Remove(imagePath(hash))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		span.SetStatus(codes.Error, err.Error())
+		return
+	}
+
+	if err = c.cassandraRepository.DeleteImageBlob(ctx, hash); err != nil {
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
@@ -0,0 +1,223 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/gocql/gocql"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"sort"
+	"time"
+	"tweet/app_errors"
+	"tweet/config"
+	"tweet/model"
+	"tweet/repository"
+	"tweet/validation"
+)
+
+// Tweets users submit to be posted later, they are posted by TweetScheduler
+type ScheduledTweetService struct {
+	cassandraRepository repository.CassandraRepository
+	tweetService        *TweetService
+	tracer              trace.Tracer
+	maxPending          int
+}
+
+func NewScheduledTweetService(cassandraRepository repository.CassandraRepository, tweetService *TweetService, tracer trace.Tracer) *ScheduledTweetService {
+	return &ScheduledTweetService{
+		cassandraRepository: cassandraRepository,
+		tweetService:        tweetService,
+		tracer:              tracer,
+		maxPending:          config.GetInt("SCHEDULED_TWEETS_MAX_PENDING", 100),
+	}
+}
+
+func (s *ScheduledTweetService) ScheduleTweet(ctx context.Context, scheduled model.ScheduledTweet) (*model.ScheduledTweet, *app_errors.AppError) {
+	serviceCtx, span := s.tracer.Start(ctx, "ScheduledTweetService.ScheduleTweet")
+	defer span.End()
+
+	authUser := serviceCtx.Value("authUser").(model.AuthUser)
+
+	pending, err := s.cassandraRepository.FindScheduledTweetsByUser(serviceCtx, authUser.Username)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, &app_errors.AppError{Code: 500, Message: err.Error()}
+	}
+	if len(pending) >= s.maxPending {
+		return nil, &app_errors.AppError{Code: 409, Message: fmt.Sprintf("You can have at most %d scheduled tweets", s.maxPending)}
+	}
+
+	scheduled.ID = gocql.TimeUUID()
+	scheduled.Username = authUser.Username
+	scheduled.Version = 1
+
+	appErr := s.validate(serviceCtx, &scheduled)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		return nil, appErr
+	}
+
+	err = s.cassandraRepository.SaveScheduledTweet(serviceCtx, &scheduled)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, &app_errors.AppError{Code: 500, Message: err.Error()}
+	}
+
+	s.holdImages(serviceCtx, scheduled.ID, scheduled.Media)
+
+	return &scheduled, nil
+}
+
+// Pending tweets of authenticated user and the ones that failed to post, earliest first
+func (s *ScheduledTweetService) GetScheduledTweets(ctx context.Context) ([]model.ScheduledTweet, *app_errors.AppError) {
+	serviceCtx, span := s.tracer.Start(ctx, "ScheduledTweetService.GetScheduledTweets")
+	defer span.End()
+
+	authUser := serviceCtx.Value("authUser").(model.AuthUser)
+
+	scheduledTweets, err := s.cassandraRepository.FindScheduledTweetsByUser(serviceCtx, authUser.Username)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, &app_errors.AppError{Code: 500, Message: err.Error()}
+	}
+
+	sort.SliceStable(scheduledTweets, func(i, j int) bool {
+		return scheduledTweets[i].PublishAt.Before(scheduledTweets[j].PublishAt)
+	})
+
+	if scheduledTweets == nil {
+		scheduledTweets = []model.ScheduledTweet{}
+	}
+
+	return scheduledTweets, nil
+}
+
+// Replaces text, media and publish time. Tweet that failed to post is queued again,
+// tweet that is being posted can't be changed.
+func (s *ScheduledTweetService) EditScheduledTweet(ctx context.Context, id string, edited model.ScheduledTweet) (*model.ScheduledTweet, *app_errors.AppError) {
+	serviceCtx, span := s.tracer.Start(ctx, "ScheduledTweetService.EditScheduledTweet")
+	defer span.End()
+
+	previous, appErr := s.findOwnScheduledTweet(serviceCtx, id)
+	if appErr != nil {
+		return nil, appErr
+	}
+	if previous.Publishing {
+		return nil, &app_errors.AppError{Code: 409, Message: "Scheduled tweet is being posted"}
+	}
+
+	edited.ID = previous.ID
+	edited.Username = previous.Username
+	edited.LastError = ""
+	edited.Version = previous.Version + 1
+	edited.Publishing = false
+	edited.Attempts = 0
+
+	appErr = s.validate(serviceCtx, &edited)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		return nil, appErr
+	}
+
+	applied, err := s.cassandraRepository.UpdateScheduledTweet(serviceCtx, previous, &edited)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, &app_errors.AppError{Code: 500, Message: err.Error()}
+	}
+	if !applied {
+		return nil, &app_errors.AppError{Code: 409, Message: "Scheduled tweet was changed or is being posted"}
+	}
+
+	s.holdImages(serviceCtx, edited.ID, edited.Media)
+	s.releaseImages(serviceCtx, edited.ID, removedMedia(previous.Media, edited.Media))
+
+	return &edited, nil
+}
+
+func (s *ScheduledTweetService) CancelScheduledTweet(ctx context.Context, id string) *app_errors.AppError {
+	serviceCtx, span := s.tracer.Start(ctx, "ScheduledTweetService.CancelScheduledTweet")
+	defer span.End()
+
+	scheduled, appErr := s.findOwnScheduledTweet(serviceCtx, id)
+	if appErr != nil {
+		return appErr
+	}
+	if scheduled.Publishing {
+		return &app_errors.AppError{Code: 409, Message: "Scheduled tweet is being posted"}
+	}
+
+	applied, err := s.cassandraRepository.DeleteScheduledTweet(serviceCtx, scheduled)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return &app_errors.AppError{Code: 500, Message: err.Error()}
+	}
+	if !applied {
+		return &app_errors.AppError{Code: 409, Message: "Scheduled tweet was changed or is being posted"}
+	}
+
+	s.releaseImages(serviceCtx, scheduled.ID, scheduled.Media)
+
+	return nil
+}
+
+// Checks the tweet the same way it is checked when posted, publish time has to be in the future
+func (s *ScheduledTweetService) validate(ctx context.Context, scheduled *model.ScheduledTweet) *app_errors.AppError {
+	text, fieldErrs := validation.Text("text", scheduled.Text, len(scheduled.Media))
+	if !scheduled.PublishAt.After(time.Now()) {
+		fieldErrs = append(fieldErrs, app_errors.FieldError{Field: "publishAt", Message: "Publish time must be in the future"})
+	}
+	if len(fieldErrs) > 0 {
+		return app_errors.NewValidationError(fieldErrs)
+	}
+
+	media, appErr := s.tweetService.validateMedia(ctx, "media", scheduled.Media, scheduled.Username)
+	if appErr != nil {
+		return appErr
+	}
+
+	scheduled.Text = text
+	scheduled.Media = media
+
+	return nil
+}
+
+// Key a scheduled tweet holds its images by until it is posted
+func scheduledImageUse(scheduledId gocql.UUID) string {
+	return "scheduled:" + scheduledId.String()
+}
+
+// Images of scheduled tweets must outlive orphan cleanup until the tweet is posted
+func (s *ScheduledTweetService) holdImages(ctx context.Context, id gocql.UUID, media []model.Media) {
+	err := s.cassandraRepository.AttachImages(ctx, scheduledImageUse(id), media)
+	if err != nil {
+		trace.SpanFromContext(ctx).SetStatus(codes.Error, err.Error())
+	}
+}
+
+// Images no longer in the scheduled tweet go back to orphan cleanup unless something else uses them
+func (s *ScheduledTweetService) releaseImages(ctx context.Context, id gocql.UUID, media []model.Media) {
+	err := s.cassandraRepository.DetachImages(ctx, scheduledImageUse(id), media)
+	if err != nil {
+		trace.SpanFromContext(ctx).SetStatus(codes.Error, err.Error())
+	}
+}
+
+// Scheduled tweets of other users are reported as missing
+func (s *ScheduledTweetService) findOwnScheduledTweet(ctx context.Context, id string) (*model.ScheduledTweet, *app_errors.AppError) {
+	authUser := ctx.Value("authUser").(model.AuthUser)
+
+	scheduledId, err := gocql.ParseUUID(id)
+	if err != nil {
+		return nil, &app_errors.AppError{Code: 400, Message: "Invalid scheduled tweet id"}
+	}
+
+	scheduled, err := s.cassandraRepository.FindScheduledTweet(ctx, authUser.Username, &scheduledId)
+	if err == gocql.ErrNotFound {
+		return nil, &app_errors.AppError{Code: 404, Message: "Scheduled tweet not found"}
+	}
+	if err != nil {
+		return nil, &app_errors.AppError{Code: 500, Message: err.Error()}
+	}
+
+	return &scheduled, nil
+}
@@ -0,0 +1,129 @@
+package service
+
+import (
+	"context"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"log"
+	"os"
+	"tweet/app_errors"
+	"tweet/model"
+	"tweet/repository"
+	"tweet/search"
+)
+
+const (
+	searchPageSize     = 20
+	reindexBatchSize   = 500
+	maxSearchQuerySize = 500
+)
+
+type SearchService struct {
+	index               *search.Index
+	cassandraRepository repository.CassandraRepository
+	tweetService        *TweetService
+	tracer              trace.Tracer
+}
+
+func NewSearchService(index *search.Index, cassandraRepository repository.CassandraRepository, tweetService *TweetService, tracer trace.Tracer) *SearchService {
+	return &SearchService{
+		index:               index,
+		cassandraRepository: cassandraRepository,
+		tweetService:        tweetService,
+		tracer:              tracer,
+	}
+}
+
+// Pages are filtered by visibility after search, so a page can have less tweets than page size
+// even when there are more results
+func (s *SearchService) Search(ctx context.Context, text string, cursor string) (*model.SearchResult, *app_errors.AppError) {
+	serviceCtx, span := s.tracer.Start(ctx, "SearchService.Search")
+	defer span.End()
+
+	if len(text) > maxSearchQuerySize {
+		return nil, &app_errors.AppError{Code: 400, Message: "Query is too long"}
+	}
+
+	query, err := search.ParseQuery(text)
+	if err != nil {
+		return nil, &app_errors.AppError{Code: 400, Message: err.Error()}
+	}
+
+	ids, nextCursor, err := s.index.Search(query, cursor, searchPageSize)
+	if err == search.ErrInvalidCursor {
+		return nil, &app_errors.AppError{Code: 400, Message: err.Error()}
+	}
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, &app_errors.AppError{Code: 500, Message: err.Error()}
+	}
+
+	var tweets []model.TweetDTO
+	for _, id := range ids {
+		tweet, err := s.cassandraRepository.FindTweet(serviceCtx, id)
+		if err != nil {
+			// index can be behind deletes
+			continue
+		}
+
+		tweets = append(tweets, s.tweetService.toDTO(serviceCtx, &tweet))
+	}
+
+	tweets = s.tweetService.hydrateTweets(serviceCtx, s.tweetService.filterVisibleAuthors(serviceCtx, tweets))
+	if tweets == nil {
+		tweets = []model.TweetDTO{}
+	}
+
+	return &model.SearchResult{
+		Tweets:     tweets,
+		NextCursor: nextCursor,
+	}, nil
+}
+
+// Builds a new index from timeline_by_user next to the one at path and replaces it.
+// Service using the index at path has to be stopped first.
+func ReindexSearch(ctx context.Context, cassandraRepository repository.CassandraRepository, path string) (int, error) {
+	index, err := search.Create(path + ".reindex")
+	if err != nil {
+		return 0, err
+	}
+
+	documents := make(chan search.Document, reindexBatchSize)
+	scanErr := make(chan error, 1)
+	go func() {
+		defer close(documents)
+		scanErr <- cassandraRepository.ScanTweets(ctx, func(tweet model.Tweet) error {
+			if document := search.DocumentOf(&tweet); document != nil {
+				documents <- *document
+			}
+			return nil
+		})
+	}()
+
+	count, err := index.AddAll(documents, reindexBatchSize)
+	if err != nil {
+		// scan is drained so it doesn't block on a full channel
+		for range documents {
+		}
+	}
+	if closeErr := index.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = <-scanErr
+	}
+	if err != nil {
+		return count, err
+	}
+
+	if err = os.RemoveAll(path); err != nil {
+		return count, err
+	}
+	if err = os.Rename(path+".reindex", path); err != nil {
+		return count, err
+	}
+
+	log.Printf("Search index %s is rebuilt with %d tweets", path, count)
+
+	return count, nil
+}
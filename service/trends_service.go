@@ -0,0 +1,216 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"tweet/app_errors"
+	"tweet/config"
+	"tweet/entities"
+	"tweet/events"
+	"tweet/model"
+	"tweet/repository"
+)
+
+const (
+	defaultTrendsWindow = "1h"
+	defaultTrendsLimit  = 10
+	maxTrendsLimit      = 50
+	// top hashtags by count that are ranked by velocity
+	trendCandidates = 200
+)
+
+// Hashtags used in window are compared to their average use over the baseline before it
+type trendsWindow struct {
+	length              time.Duration
+	granularity         time.Duration
+	baseline            time.Duration
+	baselineGranularity time.Duration
+}
+
+var trendsWindows = map[string]trendsWindow{
+	"1h": {
+		length:              time.Hour,
+		granularity:         5 * time.Minute,
+		baseline:            24 * time.Hour,
+		baselineGranularity: time.Hour,
+	},
+	"24h": {
+		length:              24 * time.Hour,
+		granularity:         time.Hour,
+		baseline:            7 * 24 * time.Hour,
+		baselineGranularity: 24 * time.Hour,
+	},
+}
+
+type TrendsService struct {
+	trendsRepository repository.TrendsRepository
+	tracer           trace.Tracer
+	clock            Clock
+	mutedTerms       []string
+	minCount         int64
+}
+
+func NewTrendsService(trendsRepository repository.TrendsRepository, tracer trace.Tracer, clock Clock) *TrendsService {
+	var mutedTerms []string
+	for _, term := range strings.Split(os.Getenv("TRENDS_MUTED_TERMS"), ",") {
+		term = entities.NormalizeHashtag(strings.TrimSpace(term))
+		if len(term) > 0 {
+			mutedTerms = append(mutedTerms, term)
+		}
+	}
+
+	return &TrendsService{
+		trendsRepository: trendsRepository,
+		tracer:           tracer,
+		clock:            clock,
+		mutedTerms:       mutedTerms,
+		minCount:         int64(config.GetInt("TRENDS_MIN_COUNT", 3)),
+	}
+}
+
+// Ranks hashtags by how much more they are used in the window than their baseline predicts
+func (s *TrendsService) GetTrends(ctx context.Context, windowName string, limit int) ([]model.Trend, *app_errors.AppError) {
+	serviceCtx, span := s.tracer.Start(ctx, "TrendsService.GetTrends")
+	defer span.End()
+
+	if len(windowName) == 0 {
+		windowName = defaultTrendsWindow
+	}
+	window, ok := trendsWindows[windowName]
+	if !ok {
+		return nil, &app_errors.AppError{Code: 400, Message: "Window must be 1h or 24h"}
+	}
+
+	if limit == 0 {
+		limit = defaultTrendsLimit
+	}
+	if limit < 0 || limit > maxTrendsLimit {
+		return nil, &app_errors.AppError{Code: 400, Message: "Limit must be between 1 and 50"}
+	}
+
+	// last bucket is the current, still filling one
+	to := s.clock.Now().Truncate(window.granularity)
+	from := to.Add(-window.length + window.granularity)
+	baselineTo := from.Truncate(window.baselineGranularity).Add(-window.baselineGranularity)
+	baselineFrom := baselineTo.Add(-window.baseline + window.baselineGranularity)
+
+	candidates, err := s.trendsRepository.TopHashtags(serviceCtx, window.granularity, from, to, trendCandidates)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, &app_errors.AppError{Code: 503, Message: "Trends are unavailable"}
+	}
+
+	var tags []string
+	for _, candidate := range candidates {
+		if candidate.Count >= s.minCount && !s.muted(candidate.Tag) {
+			tags = append(tags, candidate.Tag)
+		}
+	}
+
+	baseline, err := s.trendsRepository.CountHashtags(serviceCtx, window.baselineGranularity, baselineFrom, baselineTo, tags)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, &app_errors.AppError{Code: 503, Message: "Trends are unavailable"}
+	}
+
+	trends := []model.Trend{}
+	for _, candidate := range candidates {
+		if candidate.Count < s.minCount || s.muted(candidate.Tag) {
+			continue
+		}
+
+		expected := float64(baseline[candidate.Tag]) * float64(window.length) / float64(window.baseline)
+		score := velocity(candidate.Count, expected)
+		if score <= 0 {
+			continue
+		}
+
+		trends = append(trends, model.Trend{
+			Tag:      candidate.Tag,
+			Count:    candidate.Count,
+			Expected: expected,
+			Score:    score,
+		})
+	}
+
+	sort.SliceStable(trends, func(i, j int) bool {
+		return trends[i].Score > trends[j].Score
+	})
+
+	if len(trends) > limit {
+		trends = trends[:limit]
+	}
+
+	return trends, nil
+}
+
+// Excess over expected count, scaled so that tags with a large baseline need a larger excess
+func velocity(count int64, expected float64) float64 {
+	return (float64(count) - expected) / math.Sqrt(expected+1)
+}
+
+// Hashtag is muted when it contains a muted term
+func (s *TrendsService) muted(tag string) bool {
+	for _, term := range s.mutedTerms {
+		if strings.Contains(tag, term) {
+			return true
+		}
+	}
+	return false
+}
+
+// Counts hashtags of created tweets, ads and retweets are not counted
+type TrendsRecorder struct {
+	trendsRepository repository.TrendsRepository
+	tracer           trace.Tracer
+	clock            Clock
+}
+
+func NewTrendsRecorder(trendsRepository repository.TrendsRepository, tracer trace.Tracer, clock Clock) *TrendsRecorder {
+	return &TrendsRecorder{
+		trendsRepository: trendsRepository,
+		tracer:           tracer,
+		clock:            clock,
+	}
+}
+
+func (r *TrendsRecorder) Publish(ctx context.Context, event events.Event) error {
+	if event.Type != events.TweetCreated {
+		return nil
+	}
+
+	recordCtx, span := r.tracer.Start(ctx, "TrendsRecorder.Publish")
+	defer span.End()
+
+	var data events.TweetCreatedData
+	if err := json.Unmarshal(event.Data, &data); err != nil {
+		return err
+	}
+
+	if data.Ad || data.Retweet {
+		return nil
+	}
+
+	tags := entities.Hashtags(entities.Parse(data.Text))
+	if len(tags) == 0 {
+		return nil
+	}
+
+	err := r.trendsRepository.IncrementHashtags(recordCtx, tags, r.clock.Now())
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	return err
+}
+
+func (r *TrendsRecorder) Close() error {
+	return nil
+}
@@ -0,0 +1,228 @@
+package service
+
+import (
+	"context"
+	"go.opentelemetry.io/otel/trace"
+	"math"
+	"sort"
+	"testing"
+	"time"
+	"tweet/events"
+	"tweet/model"
+)
+
+// Keeps every use of a hashtag, buckets are computed when counts are read
+type memoryTrendsRepository struct {
+	uses map[string][]time.Time
+}
+
+func newMemoryTrendsRepository() *memoryTrendsRepository {
+	return &memoryTrendsRepository{uses: make(map[string][]time.Time)}
+}
+
+func (r *memoryTrendsRepository) add(tag string, at time.Time, n int) {
+	for i := 0; i < n; i++ {
+		r.uses[tag] = append(r.uses[tag], at)
+	}
+}
+
+func (r *memoryTrendsRepository) IncrementHashtags(ctx context.Context, tags []string, at time.Time) error {
+	for _, tag := range tags {
+		r.add(tag, at, 1)
+	}
+	return nil
+}
+
+func (r *memoryTrendsRepository) count(tag string, granularity time.Duration, from time.Time, to time.Time) int64 {
+	var count int64
+	for _, at := range r.uses[tag] {
+		bucket := at.Truncate(granularity)
+		if !bucket.Before(from) && !bucket.After(to) {
+			count++
+		}
+	}
+	return count
+}
+
+func (r *memoryTrendsRepository) TopHashtags(ctx context.Context, granularity time.Duration, from time.Time, to time.Time, limit int) ([]model.HashtagCount, error) {
+	var counts []model.HashtagCount
+	for tag := range r.uses {
+		if count := r.count(tag, granularity, from, to); count > 0 {
+			counts = append(counts, model.HashtagCount{Tag: tag, Count: count})
+		}
+	}
+
+	sort.Slice(counts, func(i, j int) bool {
+		return counts[i].Count > counts[j].Count
+	})
+	if len(counts) > limit {
+		counts = counts[:limit]
+	}
+
+	return counts, nil
+}
+
+func (r *memoryTrendsRepository) CountHashtags(ctx context.Context, granularity time.Duration, from time.Time, to time.Time, tags []string) (map[string]int64, error) {
+	counts := make(map[string]int64)
+	for _, tag := range tags {
+		counts[tag] = r.count(tag, granularity, from, to)
+	}
+	return counts, nil
+}
+
+var (
+	noopTracer = trace.NewNoopTracerProvider().Tracer("test")
+	trendsNow  = time.Date(2022, 12, 1, 12, 3, 0, 0, time.UTC)
+)
+
+func getTrends(t *testing.T, service *TrendsService, window string) []model.Trend {
+	t.Helper()
+
+	trends, appErr := service.GetTrends(context.Background(), window, 0)
+	if appErr != nil {
+		t.Fatalf("GetTrends(%q) failed: %v", window, appErr)
+	}
+	return trends
+}
+
+func trendTags(trends []model.Trend) []string {
+	tags := []string{}
+	for _, trend := range trends {
+		tags = append(tags, trend.Tag)
+	}
+	return tags
+}
+
+func assertTags(t *testing.T, trends []model.Trend, expected ...string) {
+	t.Helper()
+
+	tags := trendTags(trends)
+	if len(tags) != len(expected) {
+		t.Fatalf("trends = %v, expected %v", tags, expected)
+	}
+	for i := range expected {
+		if tags[i] != expected[i] {
+			t.Fatalf("trends = %v, expected %v", tags, expected)
+		}
+	}
+}
+
+func publishTweet(t *testing.T, recorder *TrendsRecorder, data events.TweetCreatedData) {
+	t.Helper()
+
+	event, err := events.NewEvent(context.Background(), events.TweetCreated, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = recorder.Publish(context.Background(), event); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTrendsWindowRollsOver(t *testing.T) {
+	repository := newMemoryTrendsRepository()
+	clock := NewFakeClock(trendsNow)
+	service := NewTrendsService(repository, noopTracer, clock)
+	recorder := NewTrendsRecorder(repository, noopTracer, clock)
+
+	// first bucket of the 1h window
+	repository.add("early", trendsNow.Add(-56*time.Minute), 4)
+	// current bucket, still filling
+	for i := 0; i < 3; i++ {
+		publishTweet(t, recorder, events.TweetCreatedData{Text: "now #Current"})
+	}
+
+	assertTags(t, getTrends(t, service, "1h"), "early", "current")
+
+	// early bucket leaves the window, current one stays in it
+	clock.Advance(7 * time.Minute)
+	assertTags(t, getTrends(t, service, "1h"), "current")
+
+	// early bucket is still in the 24h window
+	assertTags(t, getTrends(t, service, "24h"), "early", "current")
+
+	clock.Advance(time.Hour)
+	assertTags(t, getTrends(t, service, "1h"))
+}
+
+func TestTrendsRankByVelocityOverBaseline(t *testing.T) {
+	repository := newMemoryTrendsRepository()
+	service := NewTrendsService(repository, noopTracer, NewFakeClock(trendsNow))
+
+	window := trendsNow.Add(-30 * time.Minute)
+	// baseline of the 1h window are the 24 full hours before it
+	baselineHour := func(i int) time.Time {
+		return trendsNow.Truncate(time.Hour).Add(-time.Duration(i+2) * time.Hour)
+	}
+
+	repository.add("steady", window, 10)
+	repository.add("rising", window, 10)
+	repository.add("new", window, 5)
+	repository.add("big", window, 30)
+	repository.add("rare", window, 2)
+	for i := 0; i < 24; i++ {
+		repository.add("steady", baselineHour(i), 10)
+		repository.add("rising", baselineHour(i), 1)
+		repository.add("big", baselineHour(i), 20)
+	}
+
+	trends := getTrends(t, service, "1h")
+
+	// steady is used as much as its baseline predicts, rare is below minimum count
+	assertTags(t, trends, "rising", "new", "big")
+
+	expected := map[string]struct {
+		count    int64
+		expected float64
+		score    float64
+	}{
+		"rising": {count: 10, expected: 1, score: 9 / math.Sqrt(2)},
+		"new":    {count: 5, expected: 0, score: 5},
+		"big":    {count: 30, expected: 20, score: 10 / math.Sqrt(21)},
+	}
+	for _, trend := range trends {
+		e := expected[trend.Tag]
+		if trend.Count != e.count || math.Abs(trend.Expected-e.expected) > 1e-9 || math.Abs(trend.Score-e.score) > 1e-9 {
+			t.Errorf("%s = %+v, expected count %d, expected %f, score %f", trend.Tag, trend, e.count, e.expected, e.score)
+		}
+	}
+}
+
+func TestTrendsExcludeAdsRetweetsAndMutedTerms(t *testing.T) {
+	t.Setenv("TRENDS_MUTED_TERMS", " Spam ,,")
+
+	repository := newMemoryTrendsRepository()
+	clock := NewFakeClock(trendsNow)
+	service := NewTrendsService(repository, noopTracer, clock)
+	recorder := NewTrendsRecorder(repository, noopTracer, clock)
+
+	for i := 0; i < 5; i++ {
+		publishTweet(t, recorder, events.TweetCreatedData{Text: "buy now #promo", Ad: true})
+		publishTweet(t, recorder, events.TweetCreatedData{Text: "#echo", Retweet: true})
+		publishTweet(t, recorder, events.TweetCreatedData{Text: "#organic #NoSpamHere"})
+	}
+
+	if len(repository.uses["promo"]) != 0 || len(repository.uses["echo"]) != 0 {
+		t.Fatalf("ads and retweets were counted: %v", repository.uses)
+	}
+
+	assertTags(t, getTrends(t, service, "1h"), "organic")
+}
+
+func TestTrendsRejectUnknownWindowAndLimit(t *testing.T) {
+	service := NewTrendsService(newMemoryTrendsRepository(), noopTracer, NewFakeClock(trendsNow))
+
+	tests := []struct {
+		window string
+		limit  int
+	}{
+		{window: "7d", limit: 0},
+		{window: "1h", limit: -1},
+		{window: "1h", limit: maxTrendsLimit + 1},
+	}
+	for _, test := range tests {
+		if _, appErr := service.GetTrends(context.Background(), test.window, test.limit); appErr == nil || appErr.Code != 400 {
+			t.Errorf("GetTrends(%q, %d) = %v, expected 400", test.window, test.limit, appErr)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package service
+
+import (
+	"context"
+	"expvar"
+	"github.com/gocql/gocql"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"log"
+	"time"
+	"tweet/app_errors"
+	"tweet/config"
+	"tweet/model"
+	"tweet/repository"
+)
+
+const (
+	schedulerLease      = "tweet-scheduler"
+	schedulerBatchLimit = 100
+)
+
+var schedulerMetrics = expvar.NewMap("scheduler")
+
+// Posts scheduled tweets when they are due, through the same path as tweets posted by users.
+// Replicas share a lease, only the one holding it posts. A tweet is posted under the id chosen
+// on its first attempt, so posting it again after a partial failure doesn't duplicate it.
+type TweetScheduler struct {
+	cassandraRepository repository.CassandraRepository
+	leaseRepository     repository.LeaseRepository
+	tweetService        *TweetService
+	tracer              trace.Tracer
+	holder              string
+	interval            time.Duration
+	leaseTtl            time.Duration
+	maxAttempts         int
+}
+
+func NewTweetScheduler(cassandraRepository repository.CassandraRepository, leaseRepository repository.LeaseRepository, tweetService *TweetService, tracer trace.Tracer) *TweetScheduler {
+	interval := config.GetDuration("SCHEDULER_INTERVAL", 10*time.Second)
+
+	return &TweetScheduler{
+		cassandraRepository: cassandraRepository,
+		leaseRepository:     leaseRepository,
+		tweetService:        tweetService,
+		tracer:              tracer,
+		holder:              gocql.TimeUUID().String(),
+		interval:            interval,
+		leaseTtl:            config.GetDuration("SCHEDULER_LEASE_TTL", 3*interval),
+		maxAttempts:         config.GetInt("SCHEDULER_MAX_ATTEMPTS", 10),
+	}
+}
+
+func (s *TweetScheduler) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				// another replica can take over without waiting for the lease to expire
+				if err := s.leaseRepository.ReleaseLease(context.Background(), schedulerLease, s.holder); err != nil {
+					log.Printf("Failed to release scheduler lease: %v", err)
+				}
+				return
+			case <-ticker.C:
+				s.PublishDue(ctx)
+			}
+		}
+	}()
+}
+
+func (s *TweetScheduler) PublishDue(ctx context.Context) {
+	schedulerCtx, span := s.tracer.Start(ctx, "TweetScheduler.PublishDue")
+	defer span.End()
+
+	if !s.holdLease(schedulerCtx) {
+		return
+	}
+
+	due, err := s.cassandraRepository.FindDueScheduledTweets(schedulerCtx, time.Now(), schedulerBatchLimit)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		log.Printf("Failed to find due scheduled tweets: %v", err)
+		return
+	}
+
+	schedulerMetrics.Set("due", expvarInt(len(due)))
+
+	for i, scheduled := range due {
+		if ctx.Err() != nil {
+			return
+		}
+		// lease is extended before every tweet, so a slow batch is not taken over halfway
+		if i > 0 && !s.holdLease(schedulerCtx) {
+			return
+		}
+
+		s.publish(schedulerCtx, scheduled)
+	}
+}
+
+func (s *TweetScheduler) holdLease(ctx context.Context) bool {
+	held, err := s.leaseRepository.AcquireLease(ctx, schedulerLease, s.holder, s.leaseTtl)
+	if err != nil {
+		trace.SpanFromContext(ctx).SetStatus(codes.Error, err.Error())
+		log.Printf("Failed to acquire scheduler lease: %v", err)
+		return false
+	}
+
+	return held
+}
+
+func (s *TweetScheduler) publish(ctx context.Context, due model.ScheduledTweet) {
+	schedulerCtx, span := s.tracer.Start(ctx, "TweetScheduler.publish")
+	defer span.End()
+	span.SetAttributes(attribute.String("scheduled.id", due.ID.String()), attribute.String("user", due.Username))
+
+	scheduled, err := s.cassandraRepository.FindScheduledTweet(schedulerCtx, due.Username, &due.ID)
+	if err == gocql.ErrNotFound {
+		// cancelled after it was read from the queue
+		s.removeDue(schedulerCtx, &due)
+		return
+	}
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		log.Printf("Failed to read scheduled tweet %s: %v", due.ID, err)
+		return
+	}
+	if !scheduled.PublishAt.Equal(due.PublishAt) || scheduled.LastError != "" {
+		// entry left behind by a reschedule or a failure
+		s.removeDue(schedulerCtx, &due)
+		return
+	}
+
+	// claim stops the owner from editing or cancelling the tweet while it is posted,
+	// a claim left by a replica that died while posting is taken over
+	claimed := scheduled
+	claimed.Version = scheduled.Version + 1
+	claimed.Publishing = true
+	if claimed.TweetId == nil {
+		tweetId := gocql.TimeUUID()
+		claimed.TweetId = &tweetId
+	}
+
+	applied, err := s.cassandraRepository.UpdateScheduledTweetState(schedulerCtx, &claimed, scheduled.Version)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		log.Printf("Failed to claim scheduled tweet %s: %v", scheduled.ID, err)
+		return
+	}
+	if !applied {
+		// edited or cancelled after it was read
+		return
+	}
+
+	// tweet saved by an earlier run isn't posted again, its events, mentions and hashtags were already written
+	posted := false
+	if scheduled.TweetId != nil {
+		_, err = s.cassandraRepository.FindTweet(schedulerCtx, scheduled.TweetId.String())
+		if err != nil && err != gocql.ErrNotFound {
+			span.SetStatus(codes.Error, err.Error())
+			log.Printf("Failed to check if scheduled tweet %s was posted: %v", scheduled.ID, err)
+			return
+		}
+		posted = err == nil
+	}
+
+	if !posted {
+		// tweet is posted on behalf of its owner
+		authCtx := context.WithValue(schedulerCtx, "authUser", model.AuthUser{Username: claimed.Username})
+
+		_, appErr := s.tweetService.createTweet(authCtx, *claimed.TweetId, model.Tweet{
+			Text:  claimed.Text,
+			Media: claimed.Media,
+		})
+		if appErr != nil {
+			span.SetStatus(codes.Error, appErr.Error())
+			s.retryOrFail(schedulerCtx, &claimed, appErr)
+			return
+		}
+
+		schedulerMetrics.Add("published", 1)
+	}
+	span.SetAttributes(attribute.String("tweet.id", claimed.TweetId.String()))
+
+	applied, err = s.cassandraRepository.DeleteScheduledTweet(schedulerCtx, &claimed)
+	if err != nil || !applied {
+		// claim stays, the next run finds the tweet already posted and only removes it
+		log.Printf("Scheduled tweet %s by %s was not removed after posting: %v", claimed.ID, claimed.Username, err)
+		return
+	}
+
+	// tweet holds its images now
+	err = s.cassandraRepository.DetachImages(schedulerCtx, scheduledImageUse(claimed.ID), claimed.Media)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
+
+// Tweets that failed with a server error are retried up to max attempts, other errors fail them right away
+func (s *TweetScheduler) retryOrFail(ctx context.Context, claimed *model.ScheduledTweet, appErr *app_errors.AppError) {
+	expectedVersion := claimed.Version
+
+	claimed.Version++
+	claimed.Publishing = false
+	claimed.Attempts++
+
+	retry := appErr.Code >= 500 && claimed.Attempts < s.maxAttempts
+	if !retry {
+		claimed.LastError = appErr.Message
+	}
+
+	applied, err := s.cassandraRepository.UpdateScheduledTweetState(ctx, claimed, expectedVersion)
+	if err != nil || !applied {
+		log.Printf("Scheduled tweet %s by %s was not released: %v", claimed.ID, claimed.Username, err)
+		return
+	}
+
+	if retry {
+		schedulerMetrics.Add("retried", 1)
+		log.Printf("Scheduled tweet %s by %s will be retried: %v", claimed.ID, claimed.Username, appErr)
+		return
+	}
+
+	schedulerMetrics.Add("failed", 1)
+	log.Printf("Scheduled tweet %s by %s failed after %d attempts: %v", claimed.ID, claimed.Username, claimed.Attempts, appErr)
+
+	// failed tweet stays with its owner until edited, which queues it again
+	s.removeDue(ctx, claimed)
+}
+
+func (s *TweetScheduler) removeDue(ctx context.Context, scheduled *model.ScheduledTweet) {
+	err := s.cassandraRepository.DeleteScheduledTweetDue(ctx, scheduled)
+	if err != nil {
+		trace.SpanFromContext(ctx).SetStatus(codes.Error, err.Error())
+		log.Printf("Scheduled tweet %s by %s was not removed from the queue: %v", scheduled.ID, scheduled.Username, err)
+	}
+}
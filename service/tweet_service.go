@@ -2,19 +2,39 @@ package service
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
 	"github.com/FTN-TwitterClone/grpc-stubs/proto/ads"
 	"github.com/FTN-TwitterClone/grpc-stubs/proto/social_graph"
 	"github.com/gocql/gocql"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/singleflight"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
 	"io"
+	"log"
 	"net/http"
 	"os"
+	"time"
 	"tweet/app_errors"
+	"tweet/config"
+	"tweet/entities"
+	"tweet/events"
 	"tweet/model"
 	"tweet/repository"
 	"tweet/service/circuit_breaker"
-	"tweet/tls"
+	"tweet/validation"
+)
+
+const (
+	maxMediaCount    = 4
+	maxAltTextLength = 1000
+	profilePageSize  = 20
 )
 
 type TweetService struct {
@@ -22,29 +42,66 @@ type TweetService struct {
 	cache               repository.RedisRepository
 	tracer              trace.Tracer
 	socialGraphCB       *circuit_breaker.SocialGraphCircuitBreaker
+	publisher           events.Publisher
+	imageLoads          singleflight.Group
+	hydrationWorkers    int
+	imageTimeout        time.Duration
+	editWindow          time.Duration
+	maxEdits            int
 }
 
-func NewTweetService(cassandraRepository repository.CassandraRepository, redisRepository repository.RedisRepository, tracer trace.Tracer, socialGraphCB *circuit_breaker.SocialGraphCircuitBreaker) *TweetService {
+func NewTweetService(cassandraRepository repository.CassandraRepository, redisRepository repository.RedisRepository, tracer trace.Tracer, socialGraphCB *circuit_breaker.SocialGraphCircuitBreaker, publisher events.Publisher) *TweetService {
+	// page hydration waits on a worker slot, with no slots it would never finish
+	hydrationWorkers := config.GetInt("HYDRATION_WORKERS", 8)
+	if hydrationWorkers < 1 {
+		hydrationWorkers = 1
+	}
+
 	return &TweetService{
-		cassandraRepository,
-		redisRepository,
-		tracer,
-		socialGraphCB,
+		cassandraRepository: cassandraRepository,
+		cache:               redisRepository,
+		tracer:              tracer,
+		socialGraphCB:       socialGraphCB,
+		publisher:           publisher,
+		hydrationWorkers:    hydrationWorkers,
+		imageTimeout:        config.GetDuration("IMAGE_LOAD_TIMEOUT", 2*time.Second),
+		editWindow:          config.GetDuration("TWEET_EDIT_WINDOW", 30*time.Minute),
+		maxEdits:            config.GetInt("TWEET_MAX_EDITS", 5),
 	}
 }
 
 func (s *TweetService) CreateTweet(ctx context.Context, tweet model.Tweet) (*model.TweetDTO, *app_errors.AppError) {
+	return s.createTweet(ctx, gocql.TimeUUID(), tweet)
+}
+
+// Tweet is posted under given id, posting it again with the same id overwrites the same rows
+func (s *TweetService) createTweet(ctx context.Context, id gocql.UUID, tweet model.Tweet) (*model.TweetDTO, *app_errors.AppError) {
 	serviceCtx, span := s.tracer.Start(ctx, "TweetService.CreateTweet")
 	defer span.End()
 
 	authUser := serviceCtx.Value("authUser").(model.AuthUser)
-	id := gocql.TimeUUID()
+
+	requestMedia := tweet.RequestMedia()
+
+	text, fieldErrs := validation.Text("text", tweet.Text, len(requestMedia))
+	if len(fieldErrs) > 0 {
+		appErr := app_errors.NewValidationError(fieldErrs)
+		span.SetStatus(codes.Error, appErr.Error())
+		return nil, appErr
+	}
+
+	media, appErr := s.validateMedia(serviceCtx, "media", requestMedia, authUser.Username)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		return nil, appErr
+	}
 
 	t := model.TweetDTO{
 		ID:               id,
 		PostedBy:         authUser.Username,
-		Text:             tweet.Text,
-		ImageId:          tweet.ImageId,
+		Text:             text,
+		Entities:         entities.Parse(text),
+		Media:            media,
 		Timestamp:        id.Time(),
 		LikesCount:       0,
 		LikedByMe:        false,
@@ -52,22 +109,39 @@ func (s *TweetService) CreateTweet(ctx context.Context, tweet model.Tweet) (*mod
 		OriginalPostedBy: "",
 		Ad:               false,
 	}
-	if len(tweet.ImageId) > 0 {
-		t.Image, _ = s.GetImage(serviceCtx, tweet.ImageId)
-	}
 
 	followers, err := s.socialGraphCB.GetMyFollowers(serviceCtx)
 	if err != nil {
 		span.SetStatus(codes.Error, err.Error())
+		t.Degraded = true
 	}
 
-	repoErr := s.cassandraRepository.SaveTweet(serviceCtx, &t, followers)
+	// images are attached before the tweet is saved, so orphan cleanup never sees a posted tweet's images as unused
+	repoErr := s.cassandraRepository.AttachImages(serviceCtx, tweetImageUse(t.ID), t.Media)
+	if repoErr != nil {
+		span.SetStatus(codes.Error, repoErr.Error())
+		return nil, &app_errors.AppError{Code: 500, Message: repoErr.Error()}
+	}
+
+	repoErr = s.cassandraRepository.SaveTweet(serviceCtx, &t, followers)
 
 	if repoErr != nil {
 		span.SetStatus(codes.Error, repoErr.Error())
+		s.releaseUnsavedImages(serviceCtx, t.ID, t.Media)
 		return nil, &app_errors.AppError{Code: 500, Message: repoErr.Error()}
 	}
 
+	if t.Degraded {
+		s.queueFanout(serviceCtx, &t, nil, err)
+	}
+
+	s.publish(serviceCtx, events.TweetCreated, tweetCreatedData(&t))
+
+	s.saveMentions(serviceCtx, &t, nil)
+	s.saveHashtags(serviceCtx, &t)
+
+	t.Media, t.ImageUnavailable = s.loadMedia(serviceCtx, t.Media)
+
 	return &t, nil
 }
 
@@ -75,12 +149,28 @@ func (s *TweetService) CreateAd(ctx context.Context, ad model.Ad, authUser model
 	serviceCtx, span := s.tracer.Start(ctx, "TweetService.CreateAd")
 	defer span.End()
 
+	requestMedia := ad.Tweet.RequestMedia()
+
+	text, fieldErrs := validation.Text("tweet.text", ad.Tweet.Text, len(requestMedia))
+	if len(fieldErrs) > 0 {
+		appErr := app_errors.NewValidationError(fieldErrs)
+		span.SetStatus(codes.Error, appErr.Error())
+		return nil, appErr
+	}
+
+	media, appErr := s.validateMedia(serviceCtx, "tweet.media", requestMedia, authUser.Username)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		return nil, appErr
+	}
+
 	id := gocql.TimeUUID()
 	t := model.TweetDTO{
 		ID:               id,
 		PostedBy:         authUser.Username,
-		Text:             ad.Tweet.Text,
-		ImageId:          ad.Tweet.ImageId,
+		Text:             text,
+		Entities:         entities.Parse(text),
+		Media:            media,
 		Timestamp:        id.Time(),
 		LikesCount:       0,
 		LikedByMe:        false,
@@ -88,52 +178,67 @@ func (s *TweetService) CreateAd(ctx context.Context, ad model.Ad, authUser model
 		OriginalPostedBy: "",
 		Ad:               true,
 	}
-	if len(ad.Tweet.ImageId) > 0 {
-		t.Image, _ = s.GetImage(serviceCtx, ad.Tweet.ImageId)
-	}
 
-	followers, err := s.socialGraphCB.GetMyFollowers(serviceCtx)
-	if err != nil {
-		span.SetStatus(codes.Error, err.Error())
+	followers, followersErr := s.socialGraphCB.GetMyFollowers(serviceCtx)
+	if followersErr != nil {
+		span.SetStatus(codes.Error, followersErr.Error())
+		t.Degraded = true
 	}
 
-	targetGroupUsers, err := s.socialGraphCB.GetTargetGroupUsers(serviceCtx, ad.TargetGroup)
-	if err != nil {
-		span.SetStatus(codes.Error, err.Error())
+	targetGroupUsers, targetGroupErr := s.socialGraphCB.GetTargetGroupUsers(serviceCtx, ad.TargetGroup)
+	if targetGroupErr != nil {
+		span.SetStatus(codes.Error, targetGroupErr.Error())
+		t.Degraded = true
 	}
 
 	targetGroupUsers = append(targetGroupUsers, followers...)
 
-	repoErr := s.cassandraRepository.SaveTweet(serviceCtx, &t, targetGroupUsers)
+	adInfo := ads.AdInfo{
+		TweetId:  id.String(),
+		PostedBy: authUser.Username,
+		Town:     ad.TargetGroup.Town,
+		MinAge:   ad.TargetGroup.MinAge,
+		MaxAge:   ad.TargetGroup.MaxAge,
+		Gender:   ad.TargetGroup.Gender,
+	}
+
+	adInfoEvent, eventErr := newAdsEvent(id.String(), adInfoEventType, &adInfo)
+	if eventErr != nil {
+		span.SetStatus(codes.Error, eventErr.Error())
+		return nil, &app_errors.AppError{Code: 500, Message: eventErr.Error()}
+	}
 
+	repoErr := s.cassandraRepository.SaveAdTargetGroup(serviceCtx, &id, &ad.TargetGroup)
 	if repoErr != nil {
 		span.SetStatus(codes.Error, repoErr.Error())
 		return nil, &app_errors.AppError{Code: 500, Message: repoErr.Error()}
 	}
 
-	conn, gRPCErr := tls.GetgRPCConnection("ads:9001")
-	defer conn.Close()
-	if gRPCErr != nil {
-		span.SetStatus(codes.Error, gRPCErr.Error())
-		return nil, &app_errors.AppError{Code: 500, Message: gRPCErr.Error()}
+	repoErr = s.cassandraRepository.AttachImages(serviceCtx, tweetImageUse(t.ID), t.Media)
+	if repoErr != nil {
+		span.SetStatus(codes.Error, repoErr.Error())
+		return nil, &app_errors.AppError{Code: 500, Message: repoErr.Error()}
 	}
 
-	adsService := ads.NewAdsServiceClient(conn)
+	repoErr = s.cassandraRepository.SaveTweet(serviceCtx, &t, targetGroupUsers, adInfoEvent)
 
-	adInfo := ads.AdInfo{
-		TweetId:  id.String(),
-		PostedBy: authUser.Username,
-		Town:     ad.TargetGroup.Town,
-		MinAge:   ad.TargetGroup.MinAge,
-		MaxAge:   ad.TargetGroup.MaxAge,
-		Gender:   ad.TargetGroup.Gender,
+	if repoErr != nil {
+		span.SetStatus(codes.Error, repoErr.Error())
+		s.releaseUnsavedImages(serviceCtx, t.ID, t.Media)
+		return nil, &app_errors.AppError{Code: 500, Message: repoErr.Error()}
 	}
 
-	_, responseErr := adsService.SaveAdInfo(serviceCtx, &adInfo)
-	if responseErr != nil {
-		span.SetStatus(codes.Error, responseErr.Error())
+	// followers are resolved again on replay, target group only if it wasn't resolved now
+	if targetGroupErr != nil {
+		s.queueFanout(serviceCtx, &t, &ad.TargetGroup, targetGroupErr)
+	} else if followersErr != nil {
+		s.queueFanout(serviceCtx, &t, nil, followersErr)
 	}
 
+	s.publish(serviceCtx, events.TweetCreated, tweetCreatedData(&t))
+
+	t.Media, t.ImageUnavailable = s.loadMedia(serviceCtx, t.Media)
+
 	return &t, nil
 }
 
@@ -154,35 +259,44 @@ func (s *TweetService) CreateLike(ctx context.Context, id string) (*model.Like,
 		TweetId:  tweetId,
 	}
 
-	err = s.cassandraRepository.SaveLike(serviceCtx, &l)
-
+	// ads service learns about the like only if the tweet is known to be an ad, so it must be read
+	tweet, err := s.cassandraRepository.FindTweet(serviceCtx, id)
+	if err == gocql.ErrNotFound {
+		return nil, &app_errors.AppError{Code: 404, Message: "Tweet not found"}
+	}
 	if err != nil {
 		span.SetStatus(codes.Error, err.Error())
 		return nil, &app_errors.AppError{Code: 500, Message: err.Error()}
 	}
 
-	if isAd, rErr := s.cassandraRepository.IsAd(serviceCtx, &tweetId); rErr == nil && isAd {
-		conn, gRPCErr := tls.GetgRPCConnection("ads:9001")
-		defer conn.Close()
-		if gRPCErr != nil {
-			span.SetStatus(codes.Error, gRPCErr.Error())
-			return nil, &app_errors.AppError{Code: 500, Message: gRPCErr.Error()}
-		}
-
-		adsService := ads.NewAdsServiceClient(conn)
-
+	var outboxEvents []model.OutboxEvent
+	if tweet.Ad {
 		likeEvent := ads.LikeEvent{
 			Username: authUser.Username,
 			TweetId:  id,
 		}
 
-		_, responseErr := adsService.SaveLikeEvent(serviceCtx, &likeEvent)
-
-		if responseErr != nil {
-			span.SetStatus(codes.Error, responseErr.Error())
+		event, eventErr := newAdsEvent(id, likeEventType, &likeEvent)
+		if eventErr != nil {
+			span.SetStatus(codes.Error, eventErr.Error())
+			return nil, &app_errors.AppError{Code: 500, Message: eventErr.Error()}
 		}
+		outboxEvents = append(outboxEvents, event)
+	}
+
+	err = s.cassandraRepository.SaveLike(serviceCtx, &l, outboxEvents...)
+
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, &app_errors.AppError{Code: 500, Message: err.Error()}
 	}
 
+	s.publish(serviceCtx, events.TweetLiked, events.TweetLikedData{
+		TweetId:  id,
+		PostedBy: tweet.PostedBy,
+		Username: authUser.Username,
+	})
+
 	return &l, nil
 }
 
@@ -198,34 +312,43 @@ func (s *TweetService) DeleteLike(ctx context.Context, id string) (string, *app_
 		return "", &app_errors.AppError{Code: 500, Message: err.Error()}
 	}
 
-	err = s.cassandraRepository.DeleteLike(serviceCtx, &tweetId, authUser.Username)
+	// ads service learns about the unlike only if the tweet is known to be an ad, so it must be read
+	tweet, err := s.cassandraRepository.FindTweet(serviceCtx, id)
+	if err == gocql.ErrNotFound {
+		return "", &app_errors.AppError{Code: 404, Message: "Tweet not found"}
+	}
 	if err != nil {
 		span.SetStatus(codes.Error, err.Error())
 		return "", &app_errors.AppError{Code: 500, Message: err.Error()}
 	}
 
-	if isAd, rErr := s.cassandraRepository.IsAd(serviceCtx, &tweetId); rErr == nil && isAd {
-		conn, gRPCErr := tls.GetgRPCConnection("ads:9001")
-		defer conn.Close()
-		if gRPCErr != nil {
-			span.SetStatus(codes.Error, gRPCErr.Error())
-			return "", &app_errors.AppError{Code: 500, Message: gRPCErr.Error()}
-		}
-
-		adsService := ads.NewAdsServiceClient(conn)
-
+	var outboxEvents []model.OutboxEvent
+	if tweet.Ad {
 		unlikeEvent := ads.UnlikeEvent{
 			Username: authUser.Username,
 			TweetId:  id,
 		}
 
-		_, responseErr := adsService.SaveUnlikeEvent(serviceCtx, &unlikeEvent)
-
-		if responseErr != nil {
-			span.SetStatus(codes.Error, responseErr.Error())
+		event, eventErr := newAdsEvent(id, unlikeEventType, &unlikeEvent)
+		if eventErr != nil {
+			span.SetStatus(codes.Error, eventErr.Error())
+			return "", &app_errors.AppError{Code: 500, Message: eventErr.Error()}
 		}
+		outboxEvents = append(outboxEvents, event)
 	}
 
+	err = s.cassandraRepository.DeleteLike(serviceCtx, &tweetId, authUser.Username, outboxEvents...)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return "", &app_errors.AppError{Code: 500, Message: err.Error()}
+	}
+
+	s.publish(serviceCtx, events.TweetUnliked, events.TweetUnlikedData{
+		TweetId:  id,
+		PostedBy: tweet.PostedBy,
+		Username: authUser.Username,
+	})
+
 	return id, nil
 }
 
@@ -247,34 +370,66 @@ func (s *TweetService) GetTimelineTweets(ctx context.Context, username string, l
 		return nil, &app_errors.AppError{Code: 403}
 	}
 
-	tweets, repoErr := s.cassandraRepository.GetTimelineTweets(serviceCtx, username, lastTweetId)
+	pinnedId := s.findPinnedTweet(serviceCtx, username)
+
+	// pinned tweet is left out of the pages, one more is read so the page stays full
+	limit := profilePageSize
+	if pinnedId != nil {
+		limit++
+	}
+
+	tweets, repoErr := s.cassandraRepository.GetTimelineTweets(serviceCtx, username, lastTweetId, limit)
 	if repoErr != nil {
 		span.SetStatus(codes.Error, repoErr.Error())
 		return nil, &app_errors.AppError{Code: 500, Message: repoErr.Error()}
 	}
 
-	var responseTweets []model.TweetDTO
-	for _, tweet := range tweets {
-		if tweet.Retweet {
-			targetUser.Username = tweet.OriginalPostedBy
-			visibility, err = s.socialGraphCB.CheckVisibility(serviceCtx, &targetUser)
-
-			if err != nil && err.Code == 503 {
-				continue
-			}
-
-			if !visibility {
-				tweet.Text = ""
-			} else if len(tweet.ImageId) > 0 {
-				tweet.Image, _ = s.GetImage(serviceCtx, tweet.ImageId)
-			}
-
-		} else if len(tweet.ImageId) > 0 { // if photo is present
-			tweet.Image, _ = s.GetImage(serviceCtx, tweet.ImageId)
-		}
-		responseTweets = append(responseTweets, tweet)
+	tweets = s.withPinnedTweet(serviceCtx, pinnedId, lastTweetId, tweets)
+
+	// pinned tweet is hydrated together with the page, so its images and visibility are handled the same way
+	responseTweets := s.hydrateTweets(serviceCtx, tweets)
+
+	return &responseTweets, nil
+}
+
+// Tweets mentioning authenticated user, tweets of authors user can't see are left out
+func (s *TweetService) GetMentions(ctx context.Context, lastTweetId string) (*[]model.TweetDTO, *app_errors.AppError) {
+	serviceCtx, span := s.tracer.Start(ctx, "TweetService.GetMentions")
+	defer span.End()
+
+	authUser := serviceCtx.Value("authUser").(model.AuthUser)
+
+	tweets, err := s.cassandraRepository.GetMentionTweets(serviceCtx, entities.NormalizeUsername(authUser.Username), lastTweetId)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, &app_errors.AppError{Code: 500, Message: err.Error()}
 	}
 
+	responseTweets := s.hydrateTweets(serviceCtx, s.filterVisibleAuthors(serviceCtx, tweets))
+
+	return &responseTweets, nil
+}
+
+// Tweets with given hashtag from all authors user can see
+func (s *TweetService) GetHashtagTweets(ctx context.Context, tag string, lastTweetId string) (*[]model.TweetDTO, *app_errors.AppError) {
+	serviceCtx, span := s.tracer.Start(ctx, "TweetService.GetHashtagTweets")
+	defer span.End()
+
+	if !entities.ValidHashtag(tag) {
+		return nil, &app_errors.AppError{Code: 400, Message: "Invalid hashtag"}
+	}
+	if _, err := gocql.ParseUUID(lastTweetId); len(lastTweetId) > 0 && err != nil {
+		return nil, &app_errors.AppError{Code: 400, Message: "Invalid beforeId"}
+	}
+
+	tweets, err := s.cassandraRepository.GetHashtagTweets(serviceCtx, entities.NormalizeHashtag(tag), lastTweetId)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, &app_errors.AppError{Code: 500, Message: err.Error()}
+	}
+
+	responseTweets := s.hydrateTweets(serviceCtx, s.filterVisibleAuthors(serviceCtx, tweets))
+
 	return &responseTweets, nil
 }
 
@@ -291,7 +446,6 @@ func (s *TweetService) GetHomeFeed(ctx context.Context, lastTweetId string) (*[]
 	serviceCtx, span := s.tracer.Start(ctx, "TweetService.GetHomeFeed")
 	defer span.End()
 
-	targetUser := social_graph.SocialGraphUsername{}
 	authUser := serviceCtx.Value("authUser").(model.AuthUser)
 
 	tweets, err := s.cassandraRepository.GetFeedTweets(serviceCtx, authUser.Username, lastTweetId)
@@ -300,27 +454,7 @@ func (s *TweetService) GetHomeFeed(ctx context.Context, lastTweetId string) (*[]
 		return nil, &app_errors.AppError{Code: 500, Message: err.Error()}
 	}
 
-	var responseTweets []model.TweetDTO
-	for _, tweet := range tweets {
-		if tweet.Retweet {
-			targetUser.Username = tweet.OriginalPostedBy
-			visible, err := s.socialGraphCB.CheckVisibility(serviceCtx, &targetUser)
-
-			if err != nil && err.Code == 503 {
-				continue
-			}
-
-			if !visible {
-				tweet.Text = ""
-			} else if len(tweet.ImageId) > 0 {
-				tweet.Image, _ = s.GetImage(serviceCtx, tweet.ImageId)
-			}
-
-		} else if len(tweet.ImageId) > 0 { // if photo is present
-			tweet.Image, _ = s.GetImage(serviceCtx, tweet.ImageId)
-		}
-		responseTweets = append(responseTweets, tweet)
-	}
+	responseTweets := s.hydrateTweets(serviceCtx, tweets)
 
 	return &responseTweets, nil
 }
@@ -360,19 +494,18 @@ func (s *TweetService) Retweet(ctx context.Context, tweetId string) (*model.Twee
 		ID:               id,
 		PostedBy:         authUser.Username,
 		Text:             tweet.Text,
-		ImageId:          tweet.ImageId,
+		Entities:         tweet.Entities,
+		Media:            tweet.Media,
 		Timestamp:        id.Time(),
 		Retweet:          true,
 		OriginalPostedBy: tweet.PostedBy,
+		OriginalTweetId:  &tweet.ID,
+		EditedAt:         tweet.EditedAt,
 		LikedByMe:        false,
 		LikesCount:       0,
 		Ad:               tweet.Ad,
 	}
 
-	if len(tweet.ImageId) > 0 {
-		t.Image, _ = s.GetImage(serviceCtx, tweet.ImageId)
-	}
-
 	followers, sbErr := s.socialGraphCB.GetMyFollowers(serviceCtx)
 
 	if sbErr != nil && sbErr.Code == 503 {
@@ -380,18 +513,411 @@ func (s *TweetService) Retweet(ctx context.Context, tweetId string) (*model.Twee
 		return nil, &app_errors.AppError{Code: 503, Message: "Service unavailable"}
 	}
 
+	// retweet holds images of the original too, they are released when the retweet is deleted
+	err = s.cassandraRepository.AttachImages(serviceCtx, tweetImageUse(t.ID), t.Media)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, &app_errors.AppError{Code: 500, Message: err.Error()}
+	}
+
 	err = s.cassandraRepository.SaveTweet(serviceCtx, &t, followers)
 
 	if err != nil {
 		span.SetStatus(codes.Error, err.Error())
+		s.releaseUnsavedImages(serviceCtx, t.ID, t.Media)
 		return nil, &app_errors.AppError{Code: 500, Message: err.Error()}
 	}
 
+	s.publish(serviceCtx, events.TweetCreated, tweetCreatedData(&t))
+	s.publish(serviceCtx, events.TweetRetweeted, events.TweetRetweetedData{
+		TweetId:          tweetId,
+		RetweetId:        id.String(),
+		OriginalPostedBy: tweet.PostedBy,
+		Username:         authUser.Username,
+	})
+
+	t.Media, t.ImageUnavailable = s.loadMedia(serviceCtx, t.Media)
+
 	return &t, nil
 }
 
+func (s *TweetService) DeleteTweet(ctx context.Context, id string) *app_errors.AppError {
+	serviceCtx, span := s.tracer.Start(ctx, "TweetService.DeleteTweet")
+	defer span.End()
+
+	authUser := serviceCtx.Value("authUser").(model.AuthUser)
+
+	if _, err := gocql.ParseUUID(id); err != nil {
+		return &app_errors.AppError{Code: 400, Message: "Invalid tweet id"}
+	}
+
+	tweet, err := s.cassandraRepository.FindTweet(serviceCtx, id)
+	if err == gocql.ErrNotFound {
+		return &app_errors.AppError{Code: 404, Message: "Tweet not found"}
+	}
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return &app_errors.AppError{Code: 500, Message: err.Error()}
+	}
+
+	if tweet.PostedBy != authUser.Username {
+		return &app_errors.AppError{Code: 403, Message: "You can delete only your tweets"}
+	}
+
+	// retweets would keep showing text and media of the original, they go first so a failed delete can be retried
+	if !tweet.Retweet {
+		err = s.deleteRetweets(serviceCtx, &tweet)
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			return &app_errors.AppError{Code: 500, Message: err.Error()}
+		}
+	}
+
+	err = s.deleteTweet(serviceCtx, &tweet)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return &app_errors.AppError{Code: 500, Message: err.Error()}
+	}
+
+	return nil
+}
+
+func (s *TweetService) deleteRetweets(ctx context.Context, original *model.Tweet) error {
+	retweetIds, err := s.cassandraRepository.FindRetweetIds(ctx, &original.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, retweetId := range retweetIds {
+		retweet, err := s.cassandraRepository.FindTweet(ctx, retweetId.String())
+		if err == gocql.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if err = s.deleteTweet(ctx, &retweet); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *TweetService) deleteTweet(ctx context.Context, tweet *model.Tweet) error {
+	err := s.cassandraRepository.DeleteTweet(ctx, tweet)
+	if err != nil {
+		return err
+	}
+
+	// images are released only after the tweet is gone, one that fails to be released is kept
+	err = s.cassandraRepository.DetachImages(ctx, tweetImageUse(tweet.ID), tweet.Media)
+	if err != nil {
+		trace.SpanFromContext(ctx).SetStatus(codes.Error, err.Error())
+		log.Printf("Images of deleted tweet %s were not released: %v", tweet.ID, err)
+	}
+
+	s.publish(ctx, events.TweetDeleted, events.TweetDeletedData{
+		TweetId:  tweet.ID.String(),
+		PostedBy: tweet.PostedBy,
+	})
+
+	return nil
+}
+
+// Author can edit text of a tweet within edit window after posting, media stays the same.
+// Every version is kept, the one tweet was posted with is version 0.
+func (s *TweetService) EditTweet(ctx context.Context, id string, edited model.Tweet) (*model.TweetDTO, *app_errors.AppError) {
+	serviceCtx, span := s.tracer.Start(ctx, "TweetService.EditTweet")
+	defer span.End()
+
+	authUser := serviceCtx.Value("authUser").(model.AuthUser)
+
+	if _, err := gocql.ParseUUID(id); err != nil {
+		return nil, &app_errors.AppError{Code: 400, Message: "Invalid tweet id"}
+	}
+
+	tweet, err := s.cassandraRepository.FindTweet(serviceCtx, id)
+	if err == gocql.ErrNotFound {
+		return nil, &app_errors.AppError{Code: 404, Message: "Tweet not found"}
+	}
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, &app_errors.AppError{Code: 500, Message: err.Error()}
+	}
+
+	if tweet.PostedBy != authUser.Username {
+		return nil, &app_errors.AppError{Code: 403, Message: "You can edit only your tweets"}
+	}
+
+	if tweet.Retweet {
+		return nil, &app_errors.AppError{Code: 406, Message: "You cant edit a retweet"}
+	}
+
+	if time.Since(tweet.ID.Time()) > s.editWindow {
+		return nil, &app_errors.AppError{Code: 403, Message: fmt.Sprintf("Tweet can be edited only within %s after posting", s.editWindow)}
+	}
+
+	text, fieldErrs := validation.Text("text", edited.Text, len(tweet.Media))
+	if len(fieldErrs) > 0 {
+		appErr := app_errors.NewValidationError(fieldErrs)
+		span.SetStatus(codes.Error, appErr.Error())
+		return nil, appErr
+	}
+
+	edits, err := s.cassandraRepository.FindTweetEdits(serviceCtx, &tweet.ID)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, &app_errors.AppError{Code: 500, Message: err.Error()}
+	}
+
+	// version 0 is saved on first edit, tweets that were never edited have no history
+	if len(edits) == 0 {
+		original := model.TweetEdit{
+			TweetId:  tweet.ID,
+			Version:  0,
+			Text:     tweet.Text,
+			Entities: tweet.Entities,
+			EditedAt: tweet.ID.Time(),
+		}
+
+		// applied or not, version 0 is the same for concurrent first edits
+		_, err = s.cassandraRepository.SaveTweetEdit(serviceCtx, &original)
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			return nil, &app_errors.AppError{Code: 500, Message: err.Error()}
+		}
+		edits = append(edits, original)
+	}
+
+	if len(edits) > s.maxEdits {
+		return nil, &app_errors.AppError{Code: 409, Message: fmt.Sprintf("Tweet can be edited at most %d times", s.maxEdits)}
+	}
+
+	now := time.Now()
+	previous := tweet.Entities
+	tweet.Text = text
+	tweet.Entities = entities.Parse(text)
+	tweet.EditedAt = &now
+
+	edit := model.TweetEdit{
+		TweetId:  tweet.ID,
+		Version:  edits[len(edits)-1].Version + 1,
+		Text:     tweet.Text,
+		Entities: tweet.Entities,
+		EditedAt: now,
+	}
+
+	outboxEvents, appErr := s.adEditedEvents(serviceCtx, &tweet)
+	if appErr != nil {
+		span.SetStatus(codes.Error, appErr.Error())
+		return nil, appErr
+	}
+
+	applied, err := s.cassandraRepository.SaveTweetEdit(serviceCtx, &edit)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, &app_errors.AppError{Code: 500, Message: err.Error()}
+	}
+	if !applied {
+		return nil, &app_errors.AppError{Code: 409, Message: "Tweet was edited at the same time, try again"}
+	}
+
+	err = s.cassandraRepository.EditTweet(serviceCtx, &tweet, previous, outboxEvents...)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, &app_errors.AppError{Code: 500, Message: err.Error()}
+	}
+
+	t := model.TweetDTO{
+		ID:               tweet.ID,
+		PostedBy:         tweet.PostedBy,
+		Text:             tweet.Text,
+		Entities:         tweet.Entities,
+		Media:            tweet.Media,
+		Timestamp:        tweet.ID.Time(),
+		Retweet:          false,
+		OriginalPostedBy: "",
+		EditedAt:         tweet.EditedAt,
+		Ad:               tweet.Ad,
+	}
+
+	if !t.Ad {
+		s.saveMentions(serviceCtx, &t, previous)
+		s.saveHashtags(serviceCtx, &t)
+	}
+
+	s.publish(serviceCtx, events.TweetEdited, events.TweetEditedData{
+		TweetId:  id,
+		PostedBy: tweet.PostedBy,
+		Text:     tweet.Text,
+		Version:  edit.Version,
+		MediaIds: mediaIds(t.Media),
+		Ad:       tweet.Ad,
+	})
+
+	t.LikesCount, _ = s.cassandraRepository.CountLikes(serviceCtx, &t.ID)
+	t.LikedByMe, _ = s.cassandraRepository.LikedByMe(serviceCtx, &t.ID)
+	t.BookmarkedByMe, _ = s.cassandraRepository.BookmarkedByMe(serviceCtx, &t.ID)
+	t.Media, t.ImageUnavailable = s.loadMedia(serviceCtx, t.Media)
+
+	return &t, nil
+}
+
+// Ads service has no call for edits, it is sent the ad's info again through the outbox.
+// Ads posted before target groups were kept can't be described again and are skipped.
+func (s *TweetService) adEditedEvents(ctx context.Context, tweet *model.Tweet) ([]model.OutboxEvent, *app_errors.AppError) {
+	if !tweet.Ad {
+		return nil, nil
+	}
+
+	targetGroup, err := s.cassandraRepository.FindAdTargetGroup(ctx, &tweet.ID)
+	if err == gocql.ErrNotFound {
+		log.Printf("Target group of ad %s is unknown, ads service is not told about the edit", tweet.ID)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, &app_errors.AppError{Code: 500, Message: err.Error()}
+	}
+
+	adInfo := ads.AdInfo{
+		TweetId:  tweet.ID.String(),
+		PostedBy: tweet.PostedBy,
+		Town:     targetGroup.Town,
+		MinAge:   targetGroup.MinAge,
+		MaxAge:   targetGroup.MaxAge,
+		Gender:   targetGroup.Gender,
+	}
+
+	event, err := newAdsEvent(tweet.ID.String(), adInfoEventType, &adInfo)
+	if err != nil {
+		return nil, &app_errors.AppError{Code: 500, Message: err.Error()}
+	}
+
+	return []model.OutboxEvent{event}, nil
+}
+
+// Versions of tweet text, oldest first. Tweet that was never edited has only version 0.
+func (s *TweetService) GetTweetHistory(ctx context.Context, id string) (*[]model.TweetEdit, *app_errors.AppError) {
+	serviceCtx, span := s.tracer.Start(ctx, "TweetService.GetTweetHistory")
+	defer span.End()
+
+	if _, err := gocql.ParseUUID(id); err != nil {
+		return nil, &app_errors.AppError{Code: 400, Message: "Invalid tweet id"}
+	}
+
+	tweet, err := s.cassandraRepository.FindTweet(serviceCtx, id)
+	if err == gocql.ErrNotFound {
+		return nil, &app_errors.AppError{Code: 404, Message: "Tweet not found"}
+	}
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, &app_errors.AppError{Code: 500, Message: err.Error()}
+	}
+
+	// history of a retweet is the history of its original tweet
+	historyId := tweet.ID
+	author := tweet.PostedBy
+	if tweet.Retweet && tweet.OriginalTweetId != nil {
+		historyId = *tweet.OriginalTweetId
+		author = tweet.OriginalPostedBy
+	}
+
+	targetUser := social_graph.SocialGraphUsername{
+		Username: author,
+	}
+
+	visibility, sbErr := s.socialGraphCB.CheckVisibility(serviceCtx, &targetUser)
+	if sbErr != nil && sbErr.Code == 503 {
+		span.SetStatus(codes.Error, sbErr.Error())
+		return nil, &app_errors.AppError{Code: 503, Message: "Service unavailable"}
+	}
+
+	if !visibility {
+		return nil, &app_errors.AppError{Code: 403}
+	}
+
+	edits, err := s.cassandraRepository.FindTweetEdits(serviceCtx, &historyId)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, &app_errors.AppError{Code: 500, Message: err.Error()}
+	}
+
+	if len(edits) == 0 {
+		edits = append(edits, model.TweetEdit{
+			TweetId:  historyId,
+			Version:  0,
+			Text:     tweet.Text,
+			Entities: tweet.Entities,
+			EditedAt: historyId.Time(),
+		})
+	}
+
+	return &edits, nil
+}
+
+// Pinned tweet leads the first page of profile timeline, pinning another tweet replaces it
+func (s *TweetService) PinTweet(ctx context.Context, id string) *app_errors.AppError {
+	serviceCtx, span := s.tracer.Start(ctx, "TweetService.PinTweet")
+	defer span.End()
+
+	authUser := serviceCtx.Value("authUser").(model.AuthUser)
+
+	tweetId, err := gocql.ParseUUID(id)
+	if err != nil {
+		return &app_errors.AppError{Code: 400, Message: "Invalid tweet id"}
+	}
+
+	tweet, err := s.cassandraRepository.FindTweet(serviceCtx, id)
+	if err == gocql.ErrNotFound {
+		return &app_errors.AppError{Code: 404, Message: "Tweet not found"}
+	}
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return &app_errors.AppError{Code: 500, Message: err.Error()}
+	}
+
+	if tweet.PostedBy != authUser.Username {
+		return &app_errors.AppError{Code: 403, Message: "You can pin only your tweets"}
+	}
+
+	if tweet.Retweet {
+		return &app_errors.AppError{Code: 406, Message: "You cant pin a retweet"}
+	}
+
+	err = s.cassandraRepository.PinTweet(serviceCtx, authUser.Username, &tweetId)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return &app_errors.AppError{Code: 500, Message: err.Error()}
+	}
+
+	return nil
+}
+
+// Unpinning a tweet that is not pinned does nothing
+func (s *TweetService) UnpinTweet(ctx context.Context, id string) *app_errors.AppError {
+	serviceCtx, span := s.tracer.Start(ctx, "TweetService.UnpinTweet")
+	defer span.End()
+
+	authUser := serviceCtx.Value("authUser").(model.AuthUser)
+
+	tweetId, err := gocql.ParseUUID(id)
+	if err != nil {
+		return &app_errors.AppError{Code: 400, Message: "Invalid tweet id"}
+	}
+
+	err = s.cassandraRepository.UnpinTweet(serviceCtx, authUser.Username, &tweetId)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return &app_errors.AppError{Code: 500, Message: err.Error()}
+	}
+
+	return nil
+}
+
 func (s *TweetService) SaveImage(ctx context.Context, req *http.Request) (*string, *app_errors.AppError) {
-	_, span := s.tracer.Start(ctx, "TweetService.SaveImage")
+	serviceCtx, span := s.tracer.Start(ctx, "TweetService.SaveImage")
 	defer span.End()
 
 	// left shift 32 << 20 which results in 32*2^20 = 33554432
@@ -407,40 +933,335 @@ func (s *TweetService) SaveImage(ctx context.Context, req *http.Request) (*strin
 	}
 	defer f.Close()
 	imageName := gocql.TimeUUID().String()
-	fullPath := os.Getenv("IMAGES") + "/" + imageName
-	file, err := os.OpenFile(fullPath, os.O_WRONLY|os.O_CREATE, os.ModePerm)
+	uploadPath := imagePath(imageName + ".upload")
+	file, err := os.OpenFile(uploadPath, os.O_WRONLY|os.O_CREATE, os.ModePerm)
 	if err != nil {
 		return nil, &app_errors.AppError{Code: 500, Message: err.Error()}
 	}
-	defer file.Close()
-	// Copy the file to the destination path
-	_, err = io.Copy(file, f)
+	// Copy the file to the upload path, hashing it on the way
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(file, hash), f)
+	file.Close()
+	if err != nil {
+		os.Remove(uploadPath)
+		return nil, &app_errors.AppError{Code: 500, Message: err.Error()}
+	}
+
+	// same content is stored only once, named by its hash.
+	// Reference is taken before the file is checked, content with a reference is never deleted.
+	contentHash := hex.EncodeToString(hash.Sum(nil))
+	err = s.cassandraRepository.IncrementImageRefs(serviceCtx, contentHash)
+	if err != nil {
+		os.Remove(uploadPath)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, &app_errors.AppError{Code: 500, Message: err.Error()}
+	}
+
+	if _, err = os.Stat(imagePath(contentHash)); err == nil {
+		os.Remove(uploadPath)
+	} else if err = os.Rename(uploadPath, imagePath(contentHash)); err != nil {
+		os.Remove(uploadPath)
+		return nil, &app_errors.AppError{Code: 500, Message: err.Error()}
+	}
+
+	authUser := serviceCtx.Value("authUser").(model.AuthUser)
+	imageInfo := model.Image{
+		ID:         imageName,
+		UploadedBy: authUser.Username,
+		Size:       size,
+		Hash:       contentHash,
+		UploadedAt: time.Now(),
+	}
+
+	// dimensions are best effort, formats unknown to image package are still accepted
+	if _, err = f.Seek(0, io.SeekStart); err == nil {
+		if config, _, err := image.DecodeConfig(f); err == nil {
+			imageInfo.Width = config.Width
+			imageInfo.Height = config.Height
+		}
+	}
+
+	err = s.cassandraRepository.SaveImageInfo(serviceCtx, &imageInfo)
 	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
 		return nil, &app_errors.AppError{Code: 500, Message: err.Error()}
 	}
+
 	return &imageName, nil
 }
 
-func (s *TweetService) GetImage(ctx context.Context, imageId string) ([]byte, error) {
+// Reads image content by its hash, images uploaded before deduplication are read by their id
+func (s *TweetService) GetImage(ctx context.Context, blobKey string) ([]byte, error) {
 	serviceCtx, span := s.tracer.Start(ctx, "TweetService.GetImage")
 	defer span.End()
 
-	image, err := s.cache.Get(serviceCtx, imageId)
-	if err != nil {
-		//time.Sleep(10 * time.Second) // proof of concept
+	image, err := s.cache.Get(serviceCtx, blobKey)
+	if err == nil {
+		return image, nil
+	}
+
+	// concurrent misses for the same image share one read and one cache fill.
+	// Shared load doesn't belong to any of the requests waiting for it, so it isn't cancelled with the first one.
+	loaded, err, shared := s.imageLoads.Do(blobKey, func() (interface{}, error) {
+		loadCtx, cancel := context.WithTimeout(context.Background(), s.imageTimeout)
+		defer cancel()
 
-		fullPath := os.Getenv("IMAGES") + "/" + imageId
-		image, err = os.ReadFile(fullPath)
+		loadCtx, loadSpan := s.tracer.Start(loadCtx, "TweetService.loadImage", trace.WithLinks(trace.LinkFromContext(serviceCtx)))
+		defer loadSpan.End()
+
+		//time.Sleep(10 * time.Second) // proof of concept
 
+		image, err := os.ReadFile(imagePath(blobKey))
 		if err != nil {
-			span.SetStatus(500, err.Error())
+			loadSpan.SetStatus(codes.Error, err.Error())
 			return nil, err
 		}
 
-		err = s.cache.Post(serviceCtx, imageId, image)
+		err = s.cache.Post(loadCtx, blobKey, image)
 		if err != nil {
-			span.SetStatus(500, err.Error())
+			loadSpan.SetStatus(codes.Error, err.Error())
 		}
+
+		return image, nil
+	})
+	span.SetAttributes(attribute.Bool("shared", shared))
+
+	if err != nil {
+		span.SetStatus(500, err.Error())
+		return nil, err
 	}
-	return image, nil
+
+	return loaded.([]byte), nil
+}
+
+// Key a tweet's images are attached by
+func tweetImageUse(tweetId gocql.UUID) string {
+	return "tweet:" + tweetId.String()
+}
+
+// Images attached for a tweet that wasn't saved go back to orphan cleanup
+func (s *TweetService) releaseUnsavedImages(ctx context.Context, tweetId gocql.UUID, media []model.Media) {
+	err := s.cassandraRepository.DetachImages(ctx, tweetImageUse(tweetId), media)
+	if err != nil {
+		log.Printf("Images of unsaved tweet %s were not released: %v", tweetId, err)
+	}
+}
+
+// Attachments of previous that current no longer references
+func removedMedia(previous []model.Media, current []model.Media) []model.Media {
+	kept := make(map[string]bool, len(current))
+	for _, m := range current {
+		kept[m.ID] = true
+	}
+
+	var removed []model.Media
+	for _, m := range previous {
+		if !kept[m.ID] {
+			removed = append(removed, m)
+		}
+	}
+
+	return removed
+}
+
+// Checks that attachments reference images uploaded by the poster and fills in stored dimensions
+
+func (s *TweetService) validateMedia(ctx context.Context, field string, media []model.Media, username string) ([]model.Media, *app_errors.AppError) {
+	if len(media) > maxMediaCount {
+		return nil, mediaError(field, fmt.Sprintf("Tweet can have at most %d images", maxMediaCount))
+	}
+
+	validated := make([]model.Media, 0, len(media))
+	seen := make(map[string]bool)
+	for i, m := range media {
+		if seen[m.ID] {
+			return nil, mediaError(fmt.Sprintf("%s[%d].id", field, i), fmt.Sprintf("Image %s is attached more than once", m.ID))
+		}
+		seen[m.ID] = true
+
+		if len([]rune(m.AltText)) > maxAltTextLength {
+			return nil, mediaError(fmt.Sprintf("%s[%d].altText", field, i), fmt.Sprintf("Alt text can have at most %d characters", maxAltTextLength))
+		}
+
+		imageInfo, err := s.cassandraRepository.FindImage(ctx, m.ID)
+		if err != nil {
+			return nil, mediaError(fmt.Sprintf("%s[%d].id", field, i), fmt.Sprintf("Image %s does not exist", m.ID))
+		}
+
+		if imageInfo.UploadedBy != username {
+			return nil, &app_errors.AppError{Code: 403, Message: fmt.Sprintf("Image %s is not yours", m.ID)}
+		}
+
+		validated = append(validated, model.Media{
+			ID:       m.ID,
+			AltText:  m.AltText,
+			Width:    imageInfo.Width,
+			Height:   imageInfo.Height,
+			Position: i,
+			Hash:     imageInfo.Hash,
+		})
+	}
+
+	return validated, nil
+}
+
+func mediaError(field string, message string) *app_errors.AppError {
+	return app_errors.NewValidationError([]app_errors.FieldError{{Field: field, Message: message}})
+}
+
+// Tweet is already in author's feed, delivery to followers is replayed by FanoutReplayer.
+// Delivery to target group of an ad is replayed when targetGroup is given.
+func (s *TweetService) queueFanout(ctx context.Context, tweet *model.TweetDTO, targetGroup *model.TargetGroup, cause *app_errors.AppError) {
+	fanout := model.PendingFanout{
+		TweetId:     tweet.ID,
+		PostedBy:    tweet.PostedBy,
+		TargetGroup: targetGroup,
+		Attempts:    0,
+		LastError:   cause.Error(),
+	}
+
+	err := s.cassandraRepository.SavePendingFanout(ctx, &fanout)
+	if err != nil {
+		fanoutMetrics.Add("lost", 1)
+		log.Printf("Fan-out of tweet %s by %s was not queued and won't be replayed: %v (cause: %v)", tweet.ID, tweet.PostedBy, err, cause)
+		return
+	}
+
+	fanoutMetrics.Add("queued", 1)
+}
+
+// Profile is shown without the pinned tweet when it can't be read
+func (s *TweetService) findPinnedTweet(ctx context.Context, username string) *gocql.UUID {
+	pinnedId, err := s.cassandraRepository.FindPinnedTweet(ctx, username)
+	if err != nil {
+		if err != gocql.ErrNotFound {
+			trace.SpanFromContext(ctx).RecordError(err)
+		}
+		return nil
+	}
+
+	return &pinnedId
+}
+
+// Puts pinned tweet in front of the first page and leaves it out of the pages, so it is shown once.
+// Page is cut to page size, it was read with one extra tweet to make up for the pinned one.
+func (s *TweetService) withPinnedTweet(ctx context.Context, pinnedId *gocql.UUID, lastTweetId string, tweets []model.TweetDTO) []model.TweetDTO {
+	if pinnedId == nil {
+		return tweets
+	}
+
+	var page []model.TweetDTO
+	for _, tweet := range tweets {
+		if tweet.ID != *pinnedId && len(page) < profilePageSize {
+			page = append(page, tweet)
+		}
+	}
+
+	if len(lastTweetId) > 0 {
+		return page
+	}
+
+	pinned, err := s.cassandraRepository.FindTweet(ctx, pinnedId.String())
+	if err != nil {
+		if err != gocql.ErrNotFound {
+			trace.SpanFromContext(ctx).RecordError(err)
+		}
+		return page
+	}
+
+	t := s.toDTO(ctx, &pinned)
+	t.Pinned = true
+
+	return append([]model.TweetDTO{t}, page...)
+}
+
+// Mention timeline is best effort, tweet is already saved when it fails.
+// Users mentioned in previous version of an edited tweet are not notified again.
+func (s *TweetService) saveMentions(ctx context.Context, tweet *model.TweetDTO, previous []model.Entity) {
+	notified := make(map[string]bool)
+	for _, username := range entities.Mentions(previous) {
+		notified[username] = true
+	}
+
+	var usernames []string
+	for _, username := range entities.Mentions(tweet.Entities) {
+		if username != entities.NormalizeUsername(tweet.PostedBy) {
+			usernames = append(usernames, username)
+		}
+	}
+
+	if len(usernames) == 0 {
+		return
+	}
+
+	err := s.cassandraRepository.SaveMentions(ctx, tweet, usernames)
+	if err != nil {
+		trace.SpanFromContext(ctx).RecordError(err)
+		log.Printf("Mentions of tweet %s were not saved: %v", tweet.ID, err)
+	}
+
+	for _, username := range usernames {
+		if notified[username] {
+			continue
+		}
+		s.publish(ctx, events.TweetMentioned, events.TweetMentionedData{
+			TweetId:  tweet.ID.String(),
+			PostedBy: tweet.PostedBy,
+			Username: username,
+		})
+	}
+}
+
+// Hashtag timelines are best effort, tweet is already saved when it fails
+func (s *TweetService) saveHashtags(ctx context.Context, tweet *model.TweetDTO) {
+	tags := entities.Hashtags(tweet.Entities)
+	if len(tags) == 0 {
+		return
+	}
+
+	err := s.cassandraRepository.SaveHashtags(ctx, tweet, tags)
+	if err != nil {
+		trace.SpanFromContext(ctx).RecordError(err)
+		log.Printf("Hashtags of tweet %s were not saved: %v", tweet.ID, err)
+	}
+}
+
+// Events are published after the change is stored, failure to publish doesn't fail the request
+func (s *TweetService) publish(ctx context.Context, eventType string, data interface{}) {
+	span := trace.SpanFromContext(ctx)
+
+	event, err := events.NewEvent(ctx, eventType, data)
+	if err == nil {
+		err = s.publisher.Publish(ctx, event)
+	}
+
+	if err != nil {
+		span.RecordError(err)
+		log.Printf("Event %s was not published: %v", eventType, err)
+	}
+}
+
+func tweetCreatedData(tweet *model.TweetDTO) events.TweetCreatedData {
+	return events.TweetCreatedData{
+		TweetId:          tweet.ID.String(),
+		PostedBy:         tweet.PostedBy,
+		Text:             tweet.Text,
+		MediaIds:         mediaIds(tweet.Media),
+		Ad:               tweet.Ad,
+		Retweet:          tweet.Retweet,
+		OriginalPostedBy: tweet.OriginalPostedBy,
+	}
+}
+
+func mediaIds(media []model.Media) []string {
+	ids := make([]string, 0, len(media))
+	for _, m := range media {
+		ids = append(ids, m.ID)
+	}
+
+	return ids
+}
+
+func imagePath(name string) string {
+	return os.Getenv("IMAGES") + "/" + name
 }
@@ -0,0 +1,545 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"github.com/gocql/gocql"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"hash/fnv"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+	"tweet/config"
+	"tweet/entities"
+	"tweet/events"
+	"tweet/model"
+	"tweet/repository"
+)
+
+// Number of delivery queue partitions, deliveries of one webhook are always in the same one
+const webhookShards = 8
+
+const (
+	// deliveries of a shard are split into partitions by time of their next attempt, a drained partition is deleted whole
+	webhookDeliveryBucket = time.Minute
+	// deliveries can still be queued into a bucket that just ended, because of clock skew between replicas
+	webhookDeliveryGrace = time.Minute
+	// where worker starts in a shard it never delivered before
+	webhookDeliveryLookback = 24 * time.Hour
+)
+
+const (
+	webhookBatchLimit    = 100
+	webhookDelivered     = "delivered"
+	webhookFailed        = "failed"
+	webhookGaveUp        = "gave_up"
+	webhookDropped       = "dropped"
+	webhookResponseLimit = 4 << 10
+)
+
+var webhookMetrics = expvar.NewMap("webhooks")
+
+// Queues events for webhooks subscribed to the account they are about.
+// It is a Publisher, so deliveries are queued at the same points other events are published.
+// Events are matched to webhooks in the background, requests that publish them don't wait for it.
+// Event that doesn't fit into a full queue is lost, like events still queued on shutdown.
+type WebhookDispatcher struct {
+	cassandraRepository repository.CassandraRepository
+	tracer              trace.Tracer
+	queue               chan events.Event
+	workers             int
+}
+
+func NewWebhookDispatcher(cassandraRepository repository.CassandraRepository, tracer trace.Tracer) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		cassandraRepository: cassandraRepository,
+		tracer:              tracer,
+		queue:               make(chan events.Event, config.GetInt("WEBHOOK_DISPATCH_QUEUE", 1000)),
+		workers:             config.GetInt("WEBHOOK_DISPATCH_WORKERS", 4),
+	}
+}
+
+func (d *WebhookDispatcher) Start(ctx context.Context) {
+	for i := 0; i < d.workers; i++ {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case event := <-d.queue:
+					d.dispatch(ctx, event)
+				}
+			}
+		}()
+	}
+}
+
+func (d *WebhookDispatcher) Publish(ctx context.Context, event events.Event) error {
+	select {
+	case d.queue <- event:
+		return nil
+	default:
+		webhookMetrics.Add("lost", 1)
+		return errors.New("webhook dispatch queue is full")
+	}
+}
+
+// Runs after the request that published the event, its trace is continued from the event
+func (d *WebhookDispatcher) dispatch(ctx context.Context, event events.Event) {
+	dispatchCtx, span := d.tracer.Start(events.ContextFromEvent(ctx, event), "WebhookDispatcher.dispatch")
+	defer span.End()
+
+	account, err := webhookAccount(event)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		log.Printf("Event %s can't be matched to webhooks: %v", event.Type, err)
+		return
+	}
+
+	// mentioned usernames are in lower case, webhooks are looked up the same way for every event
+	webhooks, err := d.cassandraRepository.FindWebhooksByAccount(dispatchCtx, entities.NormalizeUsername(account))
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		webhookMetrics.Add("lost", 1)
+		log.Printf("Failed to find webhooks of %s, event %s is lost: %v", account, event.Type, err)
+		return
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return
+	}
+
+	for _, webhook := range webhooks {
+		if !webhook.Enabled || !subscribedTo(&webhook, event.Type) {
+			continue
+		}
+
+		delivery := model.WebhookDelivery{
+			Shard:         webhookShard(webhook.ID),
+			DeliveryId:    gocql.TimeUUID(),
+			WebhookId:     webhook.ID,
+			EventType:     event.Type,
+			Payload:       string(payload),
+			Attempts:      0,
+			NextAttemptAt: time.Now(),
+		}
+		delivery.Bucket = webhookBucket(delivery.NextAttemptAt)
+
+		err = d.cassandraRepository.SaveWebhookDelivery(dispatchCtx, &delivery)
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			webhookMetrics.Add("lost", 1)
+			log.Printf("Failed to queue %s for webhook %s: %v", event.Type, webhook.ID, err)
+			continue
+		}
+		webhookMetrics.Add("queued", 1)
+	}
+}
+
+func (d *WebhookDispatcher) Close() error {
+	return nil
+}
+
+// Retweets are reported to the account that was retweeted, mentions to the mentioned account
+// and other events to the author
+func webhookAccount(event events.Event) (string, error) {
+	var data struct {
+		PostedBy         string `json:"postedBy"`
+		OriginalPostedBy string `json:"originalPostedBy"`
+		Username         string `json:"username"`
+	}
+
+	if err := json.Unmarshal(event.Data, &data); err != nil {
+		return "", err
+	}
+
+	switch event.Type {
+	case events.TweetRetweeted:
+		return data.OriginalPostedBy, nil
+	case events.TweetMentioned:
+		return data.Username, nil
+	}
+	return data.PostedBy, nil
+}
+
+func subscribedTo(webhook *model.Webhook, eventType string) bool {
+	for _, e := range webhook.Events {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+func webhookShard(webhookId gocql.UUID) int {
+	h := fnv.New32a()
+	h.Write(webhookId.Bytes())
+	return int(h.Sum32() % webhookShards)
+}
+
+func webhookBucket(t time.Time) time.Time {
+	return t.Truncate(webhookDeliveryBucket)
+}
+
+func webhookLease(shard int) string {
+	return "webhooks-" + strconv.Itoa(shard)
+}
+
+// Sends queued deliveries, failed ones are retried with backoff until maxAttempts.
+// Webhook is disabled after disableAfter consecutive failures, its queued deliveries are dropped.
+// Replicas take a lease per shard, so every delivery is sent by one replica at a time.
+// Endpoints are called only on public addresses, the address is checked when connecting.
+type WebhookWorker struct {
+	cassandraRepository repository.CassandraRepository
+	leaseRepository     repository.LeaseRepository
+	tracer              trace.Tracer
+	client              *http.Client
+	holder              string
+	leaseTtl            time.Duration
+	pollInterval        time.Duration
+	retryDelay          time.Duration
+	maxBackoff          time.Duration
+	maxAttempts         int
+	disableAfter        int
+}
+
+func NewWebhookWorker(cassandraRepository repository.CassandraRepository, leaseRepository repository.LeaseRepository, tracer trace.Tracer) *WebhookWorker {
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		// runs with the resolved address, so a host that resolves to a private address later is caught too
+		Control: func(network string, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+				return fmt.Errorf("webhook address %s is not public", host)
+			}
+			return nil
+		},
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// proxy would be dialed instead of the endpoint, its address is not the one that has to be checked
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &WebhookWorker{
+		cassandraRepository: cassandraRepository,
+		leaseRepository:     leaseRepository,
+		tracer:              tracer,
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   config.GetDuration("WEBHOOK_TIMEOUT", 5*time.Second),
+			// redirect is treated as failure, endpoint has to be updated instead
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		holder:       gocql.TimeUUID().String(),
+		leaseTtl:     config.GetDuration("WEBHOOK_LEASE_TTL", 30*time.Second),
+		pollInterval: config.GetDuration("WEBHOOK_POLL_INTERVAL", time.Second),
+		retryDelay:   config.GetDuration("WEBHOOK_RETRY_DELAY", 10*time.Second),
+		maxBackoff:   config.GetDuration("WEBHOOK_MAX_BACKOFF", time.Hour),
+		maxAttempts:  config.GetInt("WEBHOOK_MAX_ATTEMPTS", 10),
+		disableAfter: config.GetInt("WEBHOOK_DISABLE_AFTER", 50),
+	}
+}
+
+func (w *WebhookWorker) Start(ctx context.Context) {
+	for shard := 0; shard < webhookShards; shard++ {
+		go w.deliverShard(ctx, shard)
+	}
+}
+
+func (w *WebhookWorker) deliverShard(ctx context.Context, shard int) {
+	for {
+		select {
+		case <-ctx.Done():
+			// another replica can take over without waiting for the lease to expire
+			if err := w.leaseRepository.ReleaseLease(context.Background(), webhookLease(shard), w.holder); err != nil {
+				log.Printf("Failed to release webhook lease of shard %d: %v", shard, err)
+			}
+			return
+		case <-time.After(w.pollInterval):
+		}
+
+		w.deliverBatch(ctx, shard)
+	}
+}
+
+func (w *WebhookWorker) holdLease(ctx context.Context, shard int) bool {
+	held, err := w.leaseRepository.AcquireLease(ctx, webhookLease(shard), w.holder, w.leaseTtl)
+	if err != nil {
+		log.Printf("Failed to acquire webhook lease of shard %d: %v", shard, err)
+		return false
+	}
+
+	return held
+}
+
+// Delivers what is due in the oldest bucket that may still have deliveries.
+// A failed delivery moves to the bucket of its next attempt, so it doesn't hold back the rest of the shard.
+func (w *WebhookWorker) deliverBatch(ctx context.Context, shard int) {
+	if !w.holdLease(ctx, shard) {
+		return
+	}
+
+	// cursor is read on every batch, it may have been moved by the previous holder of the lease
+	cursor, err := w.cassandraRepository.FindWebhookCursor(ctx, shard)
+	if err == gocql.ErrNotFound {
+		cursor = model.WebhookCursor{Shard: shard, Bucket: webhookBucket(time.Now().Add(-webhookDeliveryLookback))}
+	} else if err != nil {
+		log.Printf("Failed to read webhook cursor of shard %d: %v", shard, err)
+		return
+	}
+
+	for ctx.Err() == nil {
+		now := time.Now()
+		deliveries, err := w.cassandraRepository.FindDueWebhookDeliveries(ctx, shard, cursor.Bucket, now, webhookBatchLimit)
+		if err != nil {
+			log.Printf("Failed to read webhook deliveries of shard %d: %v", shard, err)
+			return
+		}
+
+		if len(deliveries) > 0 {
+			w.deliverAll(ctx, shard, deliveries)
+			return
+		}
+
+		// bucket is drained, it is left only when no more deliveries can be queued into it
+		next := cursor.Bucket.Add(webhookDeliveryBucket)
+		if now.Before(next.Add(webhookDeliveryGrace)) {
+			return
+		}
+
+		if err = w.cassandraRepository.DeleteWebhookDeliveryBucket(ctx, shard, cursor.Bucket); err != nil {
+			log.Printf("Failed to delete webhook delivery bucket of shard %d: %v", shard, err)
+			return
+		}
+
+		cursor = model.WebhookCursor{Shard: shard, Bucket: next}
+		if err = w.cassandraRepository.SaveWebhookCursor(ctx, &cursor); err != nil {
+			log.Printf("Failed to save webhook cursor of shard %d: %v", shard, err)
+			return
+		}
+
+		if !w.holdLease(ctx, shard) {
+			return
+		}
+	}
+}
+
+func (w *WebhookWorker) deliverAll(ctx context.Context, shard int, deliveries []model.WebhookDelivery) {
+	webhooks := make(map[gocql.UUID]*model.Webhook)
+	// endpoint that just failed is not called again in the same batch, its other deliveries wait for its retry
+	failing := make(map[gocql.UUID]time.Time)
+	for _, delivery := range deliveries {
+		if ctx.Err() != nil {
+			return
+		}
+		// lease is extended before every delivery, so a slow batch is not taken over halfway
+		if !w.holdLease(ctx, shard) {
+			return
+		}
+
+		if retryAt, ok := failing[delivery.WebhookId]; ok {
+			w.postpone(ctx, delivery, retryAt)
+			continue
+		}
+
+		webhook, ok := webhooks[delivery.WebhookId]
+		if !ok {
+			found, err := w.cassandraRepository.FindWebhook(ctx, &delivery.WebhookId)
+			if err != nil && err != gocql.ErrNotFound {
+				log.Printf("Failed to read webhook %s: %v", delivery.WebhookId, err)
+				continue
+			}
+			if err == nil {
+				webhook = &found
+			}
+			webhooks[delivery.WebhookId] = webhook
+		}
+
+		if retryAt, ok := w.deliver(ctx, webhook, delivery); !ok {
+			failing[delivery.WebhookId] = retryAt
+		}
+	}
+}
+
+// Reports whether the endpoint accepted the delivery or it didn't have to be sent,
+// and when the endpoint is tried again if it didn't
+func (w *WebhookWorker) deliver(ctx context.Context, webhook *model.Webhook, delivery model.WebhookDelivery) (time.Time, bool) {
+	var event events.Event
+	_ = json.Unmarshal([]byte(delivery.Payload), &event)
+
+	// delivery continues the trace of the request that caused the event
+	deliveryCtx, span := w.tracer.Start(events.ContextFromEvent(ctx, event), "WebhookWorker.deliver")
+	defer span.End()
+	span.SetAttributes(attribute.String("webhook.id", delivery.WebhookId.String()), attribute.String("event.type", delivery.EventType))
+
+	if webhook == nil {
+		w.removeDelivery(deliveryCtx, &delivery)
+		return time.Time{}, true
+	}
+
+	attempt := model.WebhookAttempt{
+		WebhookId:  webhook.ID,
+		AttemptId:  gocql.TimeUUID(),
+		DeliveryId: delivery.DeliveryId,
+		EventType:  delivery.EventType,
+		Attempt:    delivery.Attempts + 1,
+	}
+
+	if !webhook.Enabled {
+		attempt.Outcome = webhookDropped
+		attempt.Error = webhook.DisabledReason
+		webhookMetrics.Add(webhookDropped, 1)
+		w.saveAttempt(deliveryCtx, &attempt)
+		w.removeDelivery(deliveryCtx, &delivery)
+		return time.Time{}, true
+	}
+
+	var err error
+	start := time.Now()
+	attempt.StatusCode, err = w.send(deliveryCtx, webhook, &delivery)
+	attempt.DurationMs = time.Since(start).Milliseconds()
+
+	if err == nil {
+		attempt.Outcome = webhookDelivered
+		webhookMetrics.Add(webhookDelivered, 1)
+		w.saveAttempt(deliveryCtx, &attempt)
+		w.removeDelivery(deliveryCtx, &delivery)
+
+		if webhook.Failures > 0 {
+			webhook.Failures = 0
+			w.updateStatus(deliveryCtx, webhook)
+		}
+		return time.Time{}, true
+	}
+
+	span.SetStatus(codes.Error, err.Error())
+	attempt.Error = err.Error()
+
+	retry := delivery
+	retry.Attempts++
+	retry.NextAttemptAt = time.Now().Add(w.backoff(retry.Attempts))
+	retry.Bucket = webhookBucket(retry.NextAttemptAt)
+
+	if retry.Attempts >= w.maxAttempts {
+		attempt.Outcome = webhookGaveUp
+		webhookMetrics.Add(webhookGaveUp, 1)
+		w.removeDelivery(deliveryCtx, &delivery)
+	} else {
+		attempt.Outcome = webhookFailed
+		webhookMetrics.Add(webhookFailed, 1)
+		if moveErr := w.cassandraRepository.RescheduleWebhookDelivery(deliveryCtx, &delivery, &retry); moveErr != nil {
+			log.Printf("Failed to reschedule webhook delivery %s: %v", delivery.DeliveryId, moveErr)
+		}
+	}
+	w.saveAttempt(deliveryCtx, &attempt)
+
+	webhook.Failures++
+	if webhook.Failures >= w.disableAfter {
+		webhook.Enabled = false
+		webhook.DisabledReason = fmt.Sprintf("disabled after %d consecutive failures, last: %s", webhook.Failures, err.Error())
+		webhookMetrics.Add("disabled", 1)
+		log.Printf("Webhook %s of %s is disabled: %s", webhook.ID, webhook.Owner, webhook.DisabledReason)
+	}
+	w.updateStatus(deliveryCtx, webhook)
+
+	return retry.NextAttemptAt, false
+}
+
+// Body is the event envelope, signature is HMAC-SHA256 of "<timestamp>.<body>" with webhook's secret
+func (w *WebhookWorker) send(ctx context.Context, webhook *model.Webhook, delivery *model.WebhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewBufferString(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "tweet-webhooks")
+	req.Header.Set("X-Webhook-Id", delivery.DeliveryId.String())
+	req.Header.Set("X-Webhook-Event", delivery.EventType)
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature", "sha256="+signWebhook(webhook.Secret, timestamp, delivery.Payload))
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, webhookResponseLimit))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint responded with %d", resp.StatusCode)
+	}
+
+	return resp.StatusCode, nil
+}
+
+func signWebhook(secret string, timestamp string, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "." + payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Delivery waits for the next attempt of its endpoint without counting as an attempt
+func (w *WebhookWorker) postpone(ctx context.Context, delivery model.WebhookDelivery, at time.Time) {
+	postponed := delivery
+	postponed.NextAttemptAt = at
+	postponed.Bucket = webhookBucket(at)
+
+	if err := w.cassandraRepository.RescheduleWebhookDelivery(ctx, &delivery, &postponed); err != nil {
+		log.Printf("Failed to postpone webhook delivery %s: %v", delivery.DeliveryId, err)
+	}
+}
+
+func (w *WebhookWorker) removeDelivery(ctx context.Context, delivery *model.WebhookDelivery) {
+	if err := w.cassandraRepository.DeleteWebhookDelivery(ctx, delivery); err != nil {
+		log.Printf("Failed to delete webhook delivery %s: %v", delivery.DeliveryId, err)
+	}
+}
+
+func (w *WebhookWorker) saveAttempt(ctx context.Context, attempt *model.WebhookAttempt) {
+	if err := w.cassandraRepository.SaveWebhookAttempt(ctx, attempt); err != nil {
+		log.Printf("Failed to log attempt of webhook delivery %s: %v", attempt.DeliveryId, err)
+	}
+}
+
+func (w *WebhookWorker) updateStatus(ctx context.Context, webhook *model.Webhook) {
+	if err := w.cassandraRepository.UpdateWebhookStatus(ctx, webhook); err != nil {
+		log.Printf("Failed to update webhook %s: %v", webhook.ID, err)
+	}
+}
+
+// Exponential backoff with jitter, capped at maxBackoff
+func (w *WebhookWorker) backoff(attempts int) time.Duration {
+	backoff := w.retryDelay << (attempts - 1)
+	if backoff > w.maxBackoff || backoff <= 0 {
+		backoff = w.maxBackoff
+	}
+
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+}
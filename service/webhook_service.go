@@ -0,0 +1,291 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"github.com/gocql/gocql"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"net"
+	"net/url"
+	"strings"
+	"tweet/app_errors"
+	"tweet/entities"
+	"tweet/events"
+	"tweet/model"
+	"tweet/repository"
+)
+
+const (
+	maxWebhooksPerOwner  = 10
+	webhookAttemptsLimit = 100
+)
+
+// Events partners can subscribe to, all of them are about tweets of the subscribed account
+var webhookEvents = map[string]bool{
+	events.TweetCreated:   true,
+	events.TweetLiked:     true,
+	events.TweetUnliked:   true,
+	events.TweetRetweeted: true,
+	events.TweetDeleted:   true,
+	events.TweetMentioned: true,
+	events.TweetEdited:    true,
+}
+
+type WebhookService struct {
+	cassandraRepository repository.CassandraRepository
+	tracer              trace.Tracer
+}
+
+func NewWebhookService(cassandraRepository repository.CassandraRepository, tracer trace.Tracer) *WebhookService {
+	return &WebhookService{
+		cassandraRepository: cassandraRepository,
+		tracer:              tracer,
+	}
+}
+
+// Users can subscribe to their own account, admins to any account
+func (s *WebhookService) CreateWebhook(ctx context.Context, webhook model.Webhook) (*model.Webhook, *app_errors.AppError) {
+	serviceCtx, span := s.tracer.Start(ctx, "WebhookService.CreateWebhook")
+	defer span.End()
+
+	authUser := serviceCtx.Value("authUser").(model.AuthUser)
+
+	if len(webhook.Account) == 0 {
+		webhook.Account = authUser.Username
+	}
+	webhook.Account = entities.NormalizeUsername(webhook.Account)
+	if webhook.Account != entities.NormalizeUsername(authUser.Username) && authUser.Role != "ROLE_ADMIN" {
+		return nil, &app_errors.AppError{Code: 403, Message: "You can subscribe only to your own account"}
+	}
+
+	endpoint, err := url.Parse(webhook.URL)
+	if err != nil || endpoint.Scheme != "https" || len(endpoint.Host) == 0 {
+		return nil, &app_errors.AppError{Code: 400, Message: "Webhook url must be an absolute https url"}
+	}
+	if appErr := checkWebhookHost(serviceCtx, endpoint.Hostname()); appErr != nil {
+		return nil, appErr
+	}
+
+	if len(webhook.Events) == 0 {
+		return nil, &app_errors.AppError{Code: 400, Message: "Webhook must subscribe to at least one event"}
+	}
+	subscribed := make(map[string]bool)
+	for _, event := range webhook.Events {
+		if !webhookEvents[event] {
+			return nil, &app_errors.AppError{Code: 400, Message: fmt.Sprintf("Unknown event %s", event)}
+		}
+		subscribed[event] = true
+	}
+
+	existing, err := s.cassandraRepository.FindWebhooksByOwner(serviceCtx, authUser.Username)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, &app_errors.AppError{Code: 500, Message: err.Error()}
+	}
+	if len(existing) >= maxWebhooksPerOwner {
+		return nil, &app_errors.AppError{Code: 409, Message: fmt.Sprintf("You can have at most %d webhooks", maxWebhooksPerOwner)}
+	}
+
+	secret, err := newWebhookSecret()
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, &app_errors.AppError{Code: 500, Message: err.Error()}
+	}
+
+	id := gocql.TimeUUID()
+	w := model.Webhook{
+		ID:        id,
+		Owner:     authUser.Username,
+		Account:   webhook.Account,
+		URL:       endpoint.String(),
+		Secret:    secret,
+		Events:    make([]string, 0, len(subscribed)),
+		Enabled:   true,
+		Failures:  0,
+		CreatedAt: id.Time(),
+	}
+	for event := range subscribed {
+		w.Events = append(w.Events, event)
+	}
+
+	err = s.cassandraRepository.SaveWebhook(serviceCtx, &w)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, &app_errors.AppError{Code: 500, Message: err.Error()}
+	}
+
+	return &w, nil
+}
+
+func (s *WebhookService) GetWebhooks(ctx context.Context) ([]model.Webhook, *app_errors.AppError) {
+	serviceCtx, span := s.tracer.Start(ctx, "WebhookService.GetWebhooks")
+	defer span.End()
+
+	authUser := serviceCtx.Value("authUser").(model.AuthUser)
+
+	webhooks, err := s.cassandraRepository.FindWebhooksByOwner(serviceCtx, authUser.Username)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, &app_errors.AppError{Code: 500, Message: err.Error()}
+	}
+
+	for i := range webhooks {
+		webhooks[i].Secret = ""
+	}
+
+	if webhooks == nil {
+		webhooks = []model.Webhook{}
+	}
+
+	return webhooks, nil
+}
+
+func (s *WebhookService) DeleteWebhook(ctx context.Context, id string) *app_errors.AppError {
+	serviceCtx, span := s.tracer.Start(ctx, "WebhookService.DeleteWebhook")
+	defer span.End()
+
+	webhook, appErr := s.findOwnWebhook(serviceCtx, id)
+	if appErr != nil {
+		return appErr
+	}
+
+	// queued deliveries are dropped by the worker once it can't find the webhook
+	err := s.cassandraRepository.DeleteWebhook(serviceCtx, &webhook.ID)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return &app_errors.AppError{Code: 500, Message: err.Error()}
+	}
+
+	return nil
+}
+
+// Enables webhook that was disabled after too many failures
+func (s *WebhookService) EnableWebhook(ctx context.Context, id string) (*model.Webhook, *app_errors.AppError) {
+	serviceCtx, span := s.tracer.Start(ctx, "WebhookService.EnableWebhook")
+	defer span.End()
+
+	webhook, appErr := s.findOwnWebhook(serviceCtx, id)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	webhook.Enabled = true
+	webhook.Failures = 0
+	webhook.DisabledReason = ""
+
+	err := s.cassandraRepository.UpdateWebhookStatus(serviceCtx, webhook)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, &app_errors.AppError{Code: 500, Message: err.Error()}
+	}
+
+	webhook.Secret = ""
+
+	return webhook, nil
+}
+
+func (s *WebhookService) GetWebhookDeliveries(ctx context.Context, id string) ([]model.WebhookAttempt, *app_errors.AppError) {
+	serviceCtx, span := s.tracer.Start(ctx, "WebhookService.GetWebhookDeliveries")
+	defer span.End()
+
+	webhook, appErr := s.findOwnWebhook(serviceCtx, id)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	attempts, err := s.cassandraRepository.FindWebhookAttempts(serviceCtx, &webhook.ID, webhookAttemptsLimit)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, &app_errors.AppError{Code: 500, Message: err.Error()}
+	}
+
+	if attempts == nil {
+		attempts = []model.WebhookAttempt{}
+	}
+
+	return attempts, nil
+}
+
+// Webhooks of other users are reported as missing
+func (s *WebhookService) findOwnWebhook(ctx context.Context, id string) (*model.Webhook, *app_errors.AppError) {
+	authUser := ctx.Value("authUser").(model.AuthUser)
+
+	webhookId, err := gocql.ParseUUID(id)
+	if err != nil {
+		return nil, &app_errors.AppError{Code: 400, Message: "Invalid webhook id"}
+	}
+
+	webhook, err := s.cassandraRepository.FindWebhook(ctx, &webhookId)
+	if err == gocql.ErrNotFound || (err == nil && webhook.Owner != authUser.Username) {
+		return nil, &app_errors.AppError{Code: 404, Message: "Webhook not found"}
+	}
+	if err != nil {
+		return nil, &app_errors.AppError{Code: 500, Message: err.Error()}
+	}
+
+	return &webhook, nil
+}
+
+func newWebhookSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(secret), nil
+}
+
+// Addresses that are not public but are not covered by net.IP methods
+var nonPublicNetworks = mustParseCIDRs("0.0.0.0/8", "100.64.0.0/10", "192.0.0.0/24", "198.18.0.0/15", "240.0.0.0/4", "64:ff9b::/96")
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+// Webhooks must not reach this service's own network, e.g. loopback, private or cloud metadata addresses
+func publicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return false
+	}
+	for _, network := range nonPublicNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// Every address the host resolves to has to be public. Host can resolve differently later,
+// the worker checks the address again when it connects.
+func checkWebhookHost(ctx context.Context, host string) *app_errors.AppError {
+	invalid := &app_errors.AppError{Code: 400, Message: "Webhook url must point to a public address"}
+
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return invalid
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil || len(addrs) == 0 {
+		return &app_errors.AppError{Code: 400, Message: "Webhook host can't be resolved"}
+	}
+	for _, addr := range addrs {
+		if !publicIP(addr.IP) {
+			return invalid
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,141 @@
+package tls
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Keeps client certificate and trusted CA up to date with files on disk.
+// Files are checked on every handshake and reloaded when their modification time changes.
+type certReloader struct {
+	certPath string
+	keyPath  string
+	caPath   string
+
+	mu       sync.Mutex
+	cert     *tls.Certificate
+	certPool *x509.CertPool
+	modTimes [3]time.Time
+}
+
+func newCertReloader(certPath string, keyPath string, caPath string) (*certReloader, error) {
+	r := &certReloader{
+		certPath: certPath,
+		keyPath:  keyPath,
+		caPath:   caPath,
+	}
+
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *certReloader) reload() error {
+	modTimes, err := r.readModTimes()
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.cert != nil && modTimes == r.modTimes {
+		return nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certPath, r.keyPath)
+	if err != nil {
+		return err
+	}
+
+	trustedCert, err := ioutil.ReadFile(r.caPath)
+	if err != nil {
+		return err
+	}
+
+	certPool := x509.NewCertPool()
+	if !certPool.AppendCertsFromPEM(trustedCert) {
+		return errors.New("failed to append trusted certificate to certificate pool")
+	}
+
+	if r.cert != nil {
+		log.Println("Reloaded gRPC client certificates")
+	}
+
+	r.cert = &cert
+	r.certPool = certPool
+	r.modTimes = modTimes
+
+	return nil
+}
+
+func (r *certReloader) readModTimes() ([3]time.Time, error) {
+	var modTimes [3]time.Time
+	for i, path := range []string{r.certPath, r.keyPath, r.caPath} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return modTimes, err
+		}
+		modTimes[i] = info.ModTime()
+	}
+
+	return modTimes, nil
+}
+
+// Failed reload keeps previously loaded certificates
+func (r *certReloader) current() (*tls.Certificate, *x509.CertPool) {
+	if err := r.reload(); err != nil {
+		log.Printf("Failed to reload gRPC client certificates: %v", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.cert, r.certPool
+}
+
+// Client TLS config for long-lived connections, certificates are reloaded when files change.
+// Server certificate is verified manually against the current CA pool, since RootCAs can't be swapped.
+func GetReloadingClientTLSConfig() (*tls.Config, error) {
+	reloader, err := newCertReloader(os.Getenv("CERT"), os.Getenv("KEY"), os.Getenv("CA_CERT"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, _ := reloader.current()
+			return cert, nil
+		},
+		InsecureSkipVerify: true,
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			_, certPool := reloader.current()
+
+			if len(cs.PeerCertificates) == 0 {
+				return errors.New("server did not present a certificate")
+			}
+
+			opts := x509.VerifyOptions{
+				DNSName:       cs.ServerName,
+				Roots:         certPool,
+				Intermediates: x509.NewCertPool(),
+			}
+			for _, cert := range cs.PeerCertificates[1:] {
+				opts.Intermediates.AddCert(cert)
+			}
+
+			_, err := cs.PeerCertificates[0].Verify(opts)
+			return err
+		},
+		MinVersion: tls.VersionTLS13,
+		MaxVersion: tls.VersionTLS13,
+	}, nil
+}
@@ -1,12 +1,8 @@
 package tls
 
 import (
-	"context"
 	"crypto/tls"
 	"crypto/x509"
-	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials"
 	"io/ioutil"
 	"log"
 	"os"
@@ -61,48 +57,3 @@ func GetgRPCServerTLSConfig() *tls.Config {
 		MaxVersion:   tls.VersionTLS13,
 	}
 }
-
-func GetgRPCClientTLSConfig() *tls.Config {
-	clientCertPath := os.Getenv("CERT")
-	clientKeyPath := os.Getenv("KEY")
-	caCertPath := os.Getenv("CA_CERT")
-
-	clientCert, err := tls.LoadX509KeyPair(clientCertPath, clientKeyPath)
-	if err != nil {
-		log.Fatalf("Failed to load client certificate and key. %s.", err)
-	}
-
-	trustedCert, err := ioutil.ReadFile(caCertPath)
-	if err != nil {
-		log.Fatalf("Failed to load trusted certificate. %s.", err)
-	}
-
-	certPool := x509.NewCertPool()
-	if !certPool.AppendCertsFromPEM(trustedCert) {
-		log.Fatalf("Failed to append trusted certificate to certificate pool. %s.", err)
-	}
-
-	return &tls.Config{
-		Certificates: []tls.Certificate{clientCert},
-		RootCAs:      certPool,
-		MinVersion:   tls.VersionTLS13,
-		MaxVersion:   tls.VersionTLS13,
-	}
-}
-
-func GetgRPCConnection(address string) (*grpc.ClientConn, error) {
-	creds := credentials.NewTLS(GetgRPCClientTLSConfig())
-
-	conn, err := grpc.DialContext(
-		context.Background(),
-		address,
-		grpc.WithTransportCredentials(creds),
-		grpc.WithUnaryInterceptor(otelgrpc.UnaryClientInterceptor()),
-	)
-
-	if err != nil {
-		log.Fatalf("Failed to start gRPC connection: %v", err)
-	}
-
-	return conn, err
-}
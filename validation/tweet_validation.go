@@ -0,0 +1,126 @@
+package validation
+
+import (
+	"fmt"
+	"golang.org/x/text/unicode/norm"
+	"strings"
+	"tweet/app_errors"
+	"tweet/config"
+	"tweet/entities"
+	"unicode"
+)
+
+// Weighted length as counted by Twitter: most latin, greek, cyrillic and similar characters
+// weigh 1, others (CJK, emoji...) weigh 2 and every link weighs as much as 23 light characters.
+const (
+	MaxWeightedLength = 280
+	urlWeightedLength = 23
+	scale             = 100
+	defaultWeight     = 200
+	lightWeight       = 100
+)
+
+// Code point ranges that weigh 1
+var lightRanges = [][2]rune{
+	{0x0000, 0x10FF},
+	{0x2000, 0x200D},
+	{0x2010, 0x201F},
+	{0x2032, 0x2037},
+}
+
+// Checks and normalizes tweet text, errors are reported for field
+func Text(field string, text string, mediaCount int) (string, []app_errors.FieldError) {
+	var errs []app_errors.FieldError
+
+	text = Normalize(text)
+
+	if len(strings.TrimSpace(text)) == 0 && mediaCount == 0 {
+		return text, append(errs, app_errors.FieldError{Field: field, Message: "Text and image can't be blank"})
+	}
+
+	// line breaks and tabs are the only control characters kept in text
+	for _, r := range text {
+		if r != '\n' && r != '\t' && unicode.IsControl(r) {
+			errs = append(errs, app_errors.FieldError{Field: field, Message: fmt.Sprintf("Control character %U is not allowed", r)})
+			break
+		}
+	}
+
+	maxNewlines := config.GetInt("TWEET_MAX_NEWLINES", 20)
+	if newlines := strings.Count(text, "\n"); newlines > maxNewlines {
+		errs = append(errs, app_errors.FieldError{Field: field, Message: fmt.Sprintf("Text can have at most %d line breaks", maxNewlines)})
+	}
+
+	if length := WeightedLength(text); length > MaxWeightedLength {
+		errs = append(errs, app_errors.FieldError{Field: field, Message: fmt.Sprintf("Text is %d characters long, limit is %d", length, MaxWeightedLength)})
+	}
+
+	return text, errs
+}
+
+// Composes text to NFC and turns CRLF and CR line ends into LF
+func Normalize(text string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+	return norm.NFC.String(text)
+}
+
+// Length of text the way Twitter counts it, rounded down
+func WeightedLength(text string) int {
+	runes := []rune(text)
+
+	var links []bool
+	for _, entity := range entities.Parse(text) {
+		if entity.Type != entities.URL {
+			continue
+		}
+		if links == nil {
+			links = make([]bool, len(runes))
+		}
+		for i := entity.Start; i < entity.End; i++ {
+			links[i] = true
+		}
+	}
+
+	weight := 0
+	for i := 0; i < len(runes); i++ {
+		if links != nil && links[i] {
+			weight += urlWeightedLength * scale
+			for i+1 < len(runes) && links[i+1] {
+				i++
+			}
+			continue
+		}
+
+		// emoji modifiers and everything joined to previous emoji count as part of it
+		if isEmojiModifier(runes[i]) {
+			continue
+		}
+		if runes[i] == '\u200d' && i > 0 && isEmoji(runes[i-1]) {
+			i++
+			continue
+		}
+
+		weight += runeWeight(runes[i])
+	}
+
+	return weight / scale
+}
+
+func runeWeight(r rune) int {
+	for _, lightRange := range lightRanges {
+		if r >= lightRange[0] && r <= lightRange[1] {
+			return lightWeight
+		}
+	}
+	return defaultWeight
+}
+
+// Variation selectors and skin tones
+func isEmojiModifier(r rune) bool {
+	return r == '\ufe0e' || r == '\ufe0f' || (r >= 0x1f3fb && r <= 0x1f3ff)
+}
+
+func isEmoji(r rune) bool {
+	return (r >= 0x1f000 && r <= 0x1faff) || (r >= 0x2600 && r <= 0x27bf) || isEmojiModifier(r)
+}
@@ -0,0 +1,220 @@
+package validation
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"tweet/app_errors"
+)
+
+func TestWeightedLength(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		expected int
+	}{
+		{
+			name:     "empty",
+			text:     "",
+			expected: 0,
+		},
+		{
+			name:     "ascii",
+			text:     "hello world",
+			expected: 11,
+		},
+		{
+			name:     "latin, greek and cyrillic are light",
+			text:     "café αβγ привет",
+			expected: 15,
+		},
+		{
+			name:     "punctuation in light ranges",
+			text:     "“quoted” – ‘a’",
+			expected: 14,
+		},
+		{
+			name:     "cjk weighs 2",
+			text:     "你好世界",
+			expected: 8,
+		},
+		{
+			name:     "mixed cjk and ascii",
+			text:     "hi 日本",
+			expected: 7,
+		},
+		{
+			name:     "emoji weighs 2",
+			text:     "😀",
+			expected: 2,
+		},
+		{
+			name:     "variation selector is folded",
+			text:     "❤️",
+			expected: 2,
+		},
+		{
+			name:     "skin tone is folded",
+			text:     "👍🏽",
+			expected: 2,
+		},
+		{
+			name:     "zwj sequence counts as one emoji",
+			text:     "👨‍👩‍👧‍👦",
+			expected: 2,
+		},
+		{
+			name:     "zwj sequence with skin tones",
+			text:     "👩🏽‍💻 ok",
+			expected: 5,
+		},
+		{
+			name:     "zwj after text is light",
+			text:     "a‍b",
+			expected: 3,
+		},
+		{
+			name:     "url has fixed weight",
+			text:     "https://example.com/a/very/long/path/that/is/much/longer/than/twenty/three",
+			expected: 23,
+		},
+		{
+			name:     "short url has fixed weight",
+			text:     "see https://t.co",
+			expected: 27,
+		},
+		{
+			name:     "every url is counted",
+			text:     "https://a.com https://b.com",
+			expected: 47,
+		},
+		{
+			name:     "url after cjk",
+			text:     "你好 https://example.com",
+			expected: 28,
+		},
+		{
+			name:     "newlines and tabs are light",
+			text:     "a\nb\tc",
+			expected: 5,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if actual := WeightedLength(test.text); actual != test.expected {
+				t.Errorf("WeightedLength(%q) = %d, expected %d", test.text, actual, test.expected)
+			}
+		})
+	}
+}
+
+func TestText(t *testing.T) {
+	tests := []struct {
+		name       string
+		text       string
+		mediaCount int
+		expected   string
+		errs       []app_errors.FieldError
+	}{
+		{
+			name:     "valid",
+			text:     "hello #go",
+			expected: "hello #go",
+		},
+		{
+			name:     "blank",
+			text:     " \n ",
+			expected: " \n ",
+			errs:     []app_errors.FieldError{{Field: "text", Message: "Text and image can't be blank"}},
+		},
+		{
+			name:       "blank with image",
+			text:       "",
+			mediaCount: 1,
+			expected:   "",
+		},
+		{
+			name:     "crlf is normalized",
+			text:     "a\r\nb",
+			expected: "a\nb",
+		},
+		{
+			name:     "cr is normalized",
+			text:     "a\rb",
+			expected: "a\nb",
+		},
+		{
+			name:     "text is composed",
+			text:     "cafe\u0301",
+			expected: "café",
+		},
+		{
+			name:     "tab is allowed",
+			text:     "a\tb",
+			expected: "a\tb",
+		},
+		{
+			name:     "control character",
+			text:     "a\x1bb",
+			expected: "a\x1bb",
+			errs:     []app_errors.FieldError{{Field: "text", Message: "Control character U+001B is not allowed"}},
+		},
+		{
+			name:     "null character",
+			text:     "a\x00",
+			expected: "a\x00",
+			errs:     []app_errors.FieldError{{Field: "text", Message: "Control character U+0000 is not allowed"}},
+		},
+		{
+			name:     "newlines at limit",
+			text:     strings.Repeat("a\r\n", 20) + "a",
+			expected: strings.Repeat("a\n", 20) + "a",
+		},
+		{
+			name:     "too many newlines",
+			text:     strings.Repeat("a\n", 21) + "a",
+			expected: strings.Repeat("a\n", 21) + "a",
+			errs:     []app_errors.FieldError{{Field: "text", Message: "Text can have at most 20 line breaks"}},
+		},
+		{
+			name:     "at length limit",
+			text:     strings.Repeat("a", 280),
+			expected: strings.Repeat("a", 280),
+		},
+		{
+			name:     "over length limit",
+			text:     strings.Repeat("a", 281),
+			expected: strings.Repeat("a", 281),
+			errs:     []app_errors.FieldError{{Field: "text", Message: "Text is 281 characters long, limit is 280"}},
+		},
+		{
+			name:     "cjk at length limit",
+			text:     strings.Repeat("字", 140),
+			expected: strings.Repeat("字", 140),
+		},
+		{
+			name:     "cjk over length limit",
+			text:     strings.Repeat("字", 141),
+			expected: strings.Repeat("字", 141),
+			errs:     []app_errors.FieldError{{Field: "text", Message: "Text is 282 characters long, limit is 280"}},
+		},
+		{
+			name:     "long url fits",
+			text:     strings.Repeat("a", 256) + " https://example.com/" + strings.Repeat("x", 300),
+			expected: strings.Repeat("a", 256) + " https://example.com/" + strings.Repeat("x", 300),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual, errs := Text("text", test.text, test.mediaCount)
+			if actual != test.expected {
+				t.Errorf("Text(%q) = %q, expected %q", test.text, actual, test.expected)
+			}
+			if !reflect.DeepEqual(errs, test.errs) {
+				t.Errorf("Text(%q) errors = %v, expected %v", test.text, errs, test.errs)
+			}
+		})
+	}
+}